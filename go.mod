@@ -4,6 +4,9 @@ go 1.19
 
 require (
 	github.com/google/uuid v1.3.0
+	github.com/gorilla/websocket v1.5.3
 	github.com/mattn/go-sqlite3 v1.14.15
 	golang.org/x/crypto v0.0.0-20220926161630-eccd6366d1be
 )
+
+require golang.org/x/text v0.21.0
@@ -1,11 +1,18 @@
 package app
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
 	"forum/internal/config"
 	"forum/internal/delivery"
+	"forum/internal/mail"
+	"forum/internal/model"
 	"forum/internal/repository"
 	"forum/internal/server"
 	"forum/internal/service"
+	"forum/internal/storage"
 	"log"
 )
 
@@ -23,8 +30,47 @@ func Run(cfgFilePath string) error {
 		return err
 	}
 
+	// Without a configured secret, image links are signed with a random one and stop working when
+	// the server restarts, which pages rendered afterwards make up for.
+	if cfg.Uploads.URLSecret == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return err
+		}
+		cfg.Uploads.URLSecret = hex.EncodeToString(secret)
+	}
+
+	storage, err := storage.New(cfg)
+	if err != nil {
+		return err
+	}
+
+	sender, err := mail.New(cfg)
+	if err != nil {
+		return err
+	}
+	templates, err := mail.ParseTemplates("web/mail")
+	if err != nil {
+		return err
+	}
+
 	repository := repository.NewRepository(db, cfg)
-	service := service.NewService(repository)
+
+	// The first account of a new forum is its administrator. One that already has accounts gets
+	// its administrator from the configuration instead.
+	if cfg.Auth.Admin != "" {
+		if err := repository.UpdateUserRole(cfg.Auth.Admin, model.RoleAdmin); err != nil {
+			return fmt.Errorf("make %s an administrator: %w", cfg.Auth.Admin, err)
+		}
+	}
+	service := service.NewService(repository, storage, sender, templates, cfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go service.Mail.Run(ctx)
+	go service.Digest.Run(ctx)
+	go service.Auth.Run(ctx)
+
 	handler := delivery.NewHandler(service)
 
 	server := server.NewServer(cfg, handler)
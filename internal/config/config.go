@@ -19,6 +19,56 @@ type Config struct {
 		DBName     string `json:"dbname"`
 		CtxTimeout int    `json:"timeout"`
 	}
+
+	Forum struct {
+		CommentMaxDepth int `json:"commentMaxDepth"`
+	}
+
+	Auth struct {
+		VerifyExpiry     int    `json:"verifyExpiry"`
+		ResendCooldown   int    `json:"resendCooldown"`
+		UnverifiedExpiry int    `json:"unverifiedExpiry"`
+		ResetExpiry      int    `json:"resetExpiry"`
+		Admin            string `json:"admin"`
+	}
+
+	Chat struct {
+		HistorySize int `json:"historySize"`
+		RateLimit   int `json:"rateLimit"`
+		RatePeriod  int `json:"ratePeriod"`
+	}
+
+	Mail struct {
+		Sender       string `json:"sender"`
+		Host         string `json:"host"`
+		Port         int    `json:"port"`
+		Username     string `json:"username"`
+		Password     string `json:"password"`
+		From         string `json:"from"`
+		BaseURL      string `json:"baseUrl"`
+		PollInterval int    `json:"pollInterval"`
+		RetryDelay   int    `json:"retryDelay"`
+		MaxAttempts  int    `json:"maxAttempts"`
+	}
+
+	Uploads struct {
+		Storage           string `json:"storage"`
+		Dir               string `json:"dir"`
+		MaxImageSize      int64  `json:"maxImageSize"`
+		MaxImageDimension int    `json:"maxImageDimension"`
+		MaxImagesPerPost  int    `json:"maxImagesPerPost"`
+		URLSecret         string `json:"urlSecret"`
+		URLExpiry         int    `json:"urlExpiry"`
+
+		S3 struct {
+			Endpoint  string `json:"endpoint"`
+			Region    string `json:"region"`
+			Bucket    string `json:"bucket"`
+			AccessKey string `json:"accessKey"`
+			SecretKey string `json:"secretKey"`
+			PathStyle bool   `json:"pathStyle"`
+		}
+	}
 }
 
 func NewConfig(cfgFilePath string) *Config {
@@ -0,0 +1,100 @@
+package delivery
+
+import (
+	"errors"
+	"forum/internal/model"
+	"forum/internal/service"
+	"log"
+	"net/http"
+)
+
+func (h *Handler) adminUsers(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(model.User)
+	if r.URL.Path != "/admin/users" {
+		h.errorPage(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		log.Println("Admin Users: Method not allowed")
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	users, err := h.Service.Role.GetAllUsers(user)
+	if err != nil {
+		log.Printf("Admin Users: Get All Users: %v", err)
+		if errors.Is(err, service.ErrPermissionDenied) {
+			h.errorPage(w, http.StatusForbidden, err.Error())
+			return
+		}
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	info := model.Info{
+		User:                user,
+		Users:               users,
+		Roles:               model.Roles(),
+		UnreadMessages:      h.unreadMessages(user),
+		UnreadNotifications: h.unreadNotifications(user),
+	}
+
+	if err := h.tmpl.ExecuteTemplate(w, "admin_users.html", info); err != nil {
+		log.Printf("Admin Users: Execute: %v", err)
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (h *Handler) setUserRole(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(model.User)
+	if r.Method != http.MethodPost {
+		log.Println("Set User Role: Method not allowed")
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		log.Printf("Set User Role: Parse Form: %v", err)
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	username, ok := r.Form["username"]
+	if !ok {
+		log.Println("Set User Role: Parse Form: username field not found")
+		h.errorPage(w, http.StatusBadRequest, "username field not found")
+		return
+	}
+
+	roleName, ok := r.Form["role"]
+	if !ok {
+		log.Println("Set User Role: Parse Form: role field not found")
+		h.errorPage(w, http.StatusBadRequest, "role field not found")
+		return
+	}
+
+	role, ok := model.ParseRole(roleName[0])
+	if !ok {
+		log.Printf("Set User Role: unknown role %q", roleName[0])
+		h.errorPage(w, http.StatusBadRequest, service.ErrInvalidRole.Error())
+		return
+	}
+
+	if err := h.Service.Role.SetRole(user, username[0], role); err != nil {
+		log.Printf("Set User Role: %v", err)
+		switch {
+		case errors.Is(err, service.ErrPermissionDenied):
+			h.errorPage(w, http.StatusForbidden, err.Error())
+		case errors.Is(err, service.ErrUserNotFound):
+			h.errorPage(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, service.ErrInvalidRole):
+			h.errorPage(w, http.StatusBadRequest, err.Error())
+		default:
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
@@ -0,0 +1,342 @@
+package delivery
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"forum/internal/model"
+	"forum/internal/service"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	apiPrefix       = "/api/v1"
+	apiMaxBodyBytes = 1 << 20
+)
+
+// apiRoute is one endpoint of the JSON API. Pattern segments written as {name} match any value,
+// which reaches the handler through params. Request and Response hold zero values of the body
+// types; together with Query they are only read to describe the endpoint in the OpenAPI document.
+type apiRoute struct {
+	Method  string
+	Pattern string
+	Summary string
+	// Auth requires a signed-in caller; Permission, when set, also requires that permission.
+	Auth       bool
+	Permission model.Permission
+	Query      []string
+	Request    interface{}
+	Status     int
+	Response   interface{}
+	Handle     func(h *Handler, w http.ResponseWriter, r *http.Request, params map[string]string) error
+}
+
+// apiPostFilterQuery lists the query parameters service.ParsePostFilter understands.
+var apiPostFilterQuery = []string{"category", "author", "from", "to", "minScore", "sort", "cursor", "limit"}
+
+var apiRoutes = []apiRoute{
+	{
+		Method: http.MethodPost, Pattern: "/auth/signup", Summary: "Create an account",
+		Request: apiSignUpRequest{}, Status: http.StatusCreated, Response: model.User{},
+		Handle: (*Handler).apiSignUp,
+	},
+	{
+		Method: http.MethodPost, Pattern: "/auth/signin", Summary: "Open a session and get its bearer token",
+		Request: apiSignInRequest{}, Status: http.StatusOK, Response: apiSession{},
+		Handle: (*Handler).apiSignIn,
+	},
+	{
+		Method: http.MethodPost, Pattern: "/auth/signout", Summary: "Close the session of the bearer token", Auth: true,
+		Status: http.StatusNoContent,
+		Handle: (*Handler).apiSignOut,
+	},
+	{
+		Method: http.MethodGet, Pattern: "/me", Summary: "Get the signed-in user", Auth: true,
+		Status: http.StatusOK, Response: model.User{},
+		Handle: (*Handler).apiMe,
+	},
+
+	{
+		Method: http.MethodGet, Pattern: "/posts", Summary: "List posts, filtered and paged like the home page",
+		Query: apiPostFilterQuery, Status: http.StatusOK, Response: apiPostList{},
+		Handle: (*Handler).apiGetPosts,
+	},
+	{
+		Method: http.MethodPost, Pattern: "/posts", Summary: "Create a post", Permission: model.PermCreatePost,
+		Request: apiPostRequest{}, Status: http.StatusCreated, Response: model.Post{},
+		Handle: (*Handler).apiCreatePost,
+	},
+	{
+		Method: http.MethodGet, Pattern: "/posts/{id}", Summary: "Get a post",
+		Status: http.StatusOK, Response: model.Post{},
+		Handle: (*Handler).apiGetPost,
+	},
+	{
+		Method: http.MethodPut, Pattern: "/posts/{id}", Summary: "Edit a post", Auth: true,
+		Request: apiPostRequest{}, Status: http.StatusOK, Response: model.Post{},
+		Handle: (*Handler).apiUpdatePost,
+	},
+	{
+		Method: http.MethodDelete, Pattern: "/posts/{id}", Summary: "Delete a post", Auth: true,
+		Status: http.StatusNoContent,
+		Handle: (*Handler).apiDeletePost,
+	},
+	{
+		Method: http.MethodPost, Pattern: "/posts/{id}/like", Summary: "Toggle a like on a post", Permission: model.PermVote,
+		Status: http.StatusOK, Response: model.Post{},
+		Handle: (*Handler).apiLikePost,
+	},
+	{
+		Method: http.MethodPost, Pattern: "/posts/{id}/dislike", Summary: "Toggle a dislike on a post", Permission: model.PermVote,
+		Status: http.StatusOK, Response: model.Post{},
+		Handle: (*Handler).apiDislikePost,
+	},
+	{
+		Method: http.MethodGet, Pattern: "/posts/{id}/comments", Summary: "List comment threads of a post",
+		Query: []string{"cursor"}, Status: http.StatusOK, Response: apiCommentList{},
+		Handle: (*Handler).apiGetComments,
+	},
+	{
+		Method: http.MethodPost, Pattern: "/posts/{id}/comments", Summary: "Comment on a post or reply to a comment", Permission: model.PermComment,
+		Request: apiCommentRequest{}, Status: http.StatusCreated, Response: model.Commentary{},
+		Handle: (*Handler).apiCreateComment,
+	},
+
+	{
+		Method: http.MethodGet, Pattern: "/comments/{id}", Summary: "Get a comment",
+		Status: http.StatusOK, Response: model.Commentary{},
+		Handle: (*Handler).apiGetComment,
+	},
+	{
+		Method: http.MethodPut, Pattern: "/comments/{id}", Summary: "Edit a comment", Auth: true,
+		Request: apiCommentUpdateRequest{}, Status: http.StatusOK, Response: model.Commentary{},
+		Handle: (*Handler).apiUpdateComment,
+	},
+	{
+		Method: http.MethodDelete, Pattern: "/comments/{id}", Summary: "Delete a comment", Auth: true,
+		Status: http.StatusNoContent,
+		Handle: (*Handler).apiDeleteComment,
+	},
+	{
+		Method: http.MethodPost, Pattern: "/comments/{id}/like", Summary: "Toggle a like on a comment", Permission: model.PermVote,
+		Status: http.StatusOK, Response: model.Commentary{},
+		Handle: (*Handler).apiLikeComment,
+	},
+	{
+		Method: http.MethodPost, Pattern: "/comments/{id}/dislike", Summary: "Toggle a dislike on a comment", Permission: model.PermVote,
+		Status: http.StatusOK, Response: model.Commentary{},
+		Handle: (*Handler).apiDislikeComment,
+	},
+
+	{
+		Method: http.MethodGet, Pattern: "/users/{username}", Summary: "Get a user",
+		Status: http.StatusOK, Response: model.User{},
+		Handle: (*Handler).apiGetUser,
+	},
+	{
+		Method: http.MethodGet, Pattern: "/users/{username}/posts", Summary: "List posts a user created, liked, disliked or commented on",
+		Query: append([]string{"posts"}, apiPostFilterQuery...), Status: http.StatusOK, Response: apiPostList{},
+		Handle: (*Handler).apiGetUserPosts,
+	},
+
+	{
+		Method: http.MethodGet, Pattern: "/categories", Summary: "List categories with their activity",
+		Status: http.StatusOK, Response: apiCategoryList{},
+		Handle: (*Handler).apiGetCategories,
+	},
+	{
+		Method: http.MethodGet, Pattern: "/search", Summary: "Search posts and comments",
+		Query: []string{"q"}, Status: http.StatusOK, Response: apiSearchResults{},
+		Handle: (*Handler).apiSearch,
+	},
+}
+
+func (h *Handler) api(w http.ResponseWriter, r *http.Request) {
+	// Only bearer tokens sign API calls in. A session cookie would let any other site make calls on
+	// the user's behalf from their browser.
+	if _, bearer := sessionToken(r); !bearer {
+		r = r.WithContext(context.WithValue(r.Context(), ctxKeyUser, model.User{}))
+	}
+	user := r.Context().Value(ctxKeyUser).(model.User)
+	path := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, apiPrefix), "/")
+
+	var allowed []string
+	for _, route := range apiRoutes {
+		params, ok := matchAPIPattern(route.Pattern, path)
+		if !ok {
+			continue
+		}
+		if route.Method != r.Method {
+			allowed = append(allowed, route.Method)
+			continue
+		}
+
+		if (route.Auth || route.Permission != 0) && user == (model.User{}) {
+			h.apiError(w, errAPIUnauthorized)
+			return
+		}
+		// Tokens without the read scope can still act, but not look at anything as their owner.
+		if route.Method == http.MethodGet && user.Scopes != 0 && user.Scopes&model.ScopeRead == 0 {
+			h.apiError(w, errAPIReadScope)
+			return
+		}
+		if route.Permission != 0 {
+			if err := h.Service.Role.CheckPermission(user, route.Permission); err != nil {
+				h.apiError(w, err)
+				return
+			}
+		}
+
+		if err := route.Handle(h, w, r, params); err != nil {
+			h.apiError(w, err)
+		}
+		return
+	}
+
+	if len(allowed) != 0 {
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		h.apiError(w, errAPIMethodNotAllowed)
+		return
+	}
+	h.apiError(w, errAPINotFound)
+}
+
+func matchAPIPattern(pattern, path string) (map[string]string, bool) {
+	patternParts := strings.Split(strings.Trim(pattern, "/"), "/")
+	pathParts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(patternParts) != len(pathParts) {
+		return nil, false
+	}
+
+	params := make(map[string]string)
+	for i, part := range patternParts {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			if pathParts[i] == "" {
+				return nil, false
+			}
+			params[strings.Trim(part, "{}")] = pathParts[i]
+			continue
+		}
+		if part != pathParts[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// apiError is the error object every failed API call answers with, under an "error" key.
+type apiError struct {
+	Status  int    `json:"-"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type apiErrorResponse struct {
+	Error *apiError `json:"error"`
+}
+
+func (e *apiError) Error() string {
+	return e.Message
+}
+
+var (
+	errAPINotFound         = &apiError{Status: http.StatusNotFound, Code: "not_found", Message: "resource not found"}
+	errAPIMethodNotAllowed = &apiError{Status: http.StatusMethodNotAllowed, Code: "method_not_allowed", Message: "method not allowed"}
+	errAPIUnauthorized     = &apiError{Status: http.StatusUnauthorized, Code: "unauthorized", Message: "sign in required"}
+	errAPIInternal         = &apiError{Status: http.StatusInternalServerError, Code: "internal_error", Message: "internal server error"}
+	errAPIReadScope        = &apiError{Status: http.StatusForbidden, Code: "insufficient_scope", Message: "token lacks the read scope"}
+)
+
+// apiErrorStatuses maps service errors to the status and code API clients see. The first match
+// wins, and the message is the sentinel's own text so internal context never leaks out.
+var apiErrorStatuses = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{sql.ErrNoRows, http.StatusNotFound, "not_found"},
+	{service.ErrUserNotFound, http.StatusNotFound, "not_found"},
+	{service.ErrCategoryNotFound, http.StatusNotFound, "not_found"},
+	{service.ErrSessionNotFound, http.StatusNotFound, "not_found"},
+	{service.ErrUnverified, http.StatusForbidden, "unverified"},
+	{service.ErrPermissionDenied, http.StatusForbidden, "permission_denied"},
+	{service.ErrUserExist, http.StatusConflict, "conflict"},
+	{service.ErrUsernameConfusable, http.StatusConflict, "conflict"},
+	{service.ErrCategoryExists, http.StatusConflict, "conflict"},
+	{service.ErrCommentDeleted, http.StatusConflict, "conflict"},
+	{service.ErrInvalidQuery, http.StatusBadRequest, "invalid_query"},
+	{service.ErrInvalidSearch, http.StatusBadRequest, "invalid_query"},
+	{service.ErrInvalidEmail, http.StatusBadRequest, "validation_failed"},
+	{service.ErrInvalidUsernameLen, http.StatusBadRequest, "validation_failed"},
+	{service.ErrInvalidUsernameChar, http.StatusBadRequest, "validation_failed"},
+	{service.ErrConfirmPassword, http.StatusBadRequest, "validation_failed"},
+	{service.ErrInvalidPostTitle, http.StatusBadRequest, "validation_failed"},
+	{service.ErrInvalidPostContent, http.StatusBadRequest, "validation_failed"},
+	{service.ErrPostTitleLen, http.StatusBadRequest, "validation_failed"},
+	{service.ErrPostContentLen, http.StatusBadRequest, "validation_failed"},
+	{service.ErrInvalidCategory, http.StatusBadRequest, "validation_failed"},
+	{service.ErrInvalidComment, http.StatusBadRequest, "validation_failed"},
+	{service.ErrInvalidCommentChar, http.StatusBadRequest, "validation_failed"},
+	{service.ErrCommentLen, http.StatusBadRequest, "validation_failed"},
+	{service.ErrInvalidParent, http.StatusBadRequest, "validation_failed"},
+	{service.ErrInvalidRole, http.StatusBadRequest, "validation_failed"},
+}
+
+func toAPIError(err error) *apiError {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	for _, known := range apiErrorStatuses {
+		if errors.Is(err, known.err) {
+			message := known.err.Error()
+			if known.err == sql.ErrNoRows {
+				message = errAPINotFound.Message
+			}
+			return &apiError{Status: known.status, Code: known.code, Message: message}
+		}
+	}
+	return errAPIInternal
+}
+
+func (h *Handler) apiError(w http.ResponseWriter, err error) {
+	apiErr := toAPIError(err)
+	if apiErr.Status == http.StatusInternalServerError {
+		log.Printf("API: %v", err)
+	}
+	writeJSON(w, apiErr.Status, apiErrorResponse{Error: apiErr})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	if body == nil {
+		w.WriteHeader(status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("API: encode response: %v", err)
+	}
+}
+
+// decodeJSON reads a request body into v, refusing unknown fields and oversized bodies.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, apiMaxBodyBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return &apiError{Status: http.StatusBadRequest, Code: "invalid_body", Message: "invalid request body: " + err.Error()}
+	}
+	return nil
+}
+
+func apiID(params map[string]string) (int, error) {
+	id, err := strconv.Atoi(params["id"])
+	if err != nil || id < 1 {
+		return 0, errAPINotFound
+	}
+	return id, nil
+}
@@ -0,0 +1,90 @@
+package delivery
+
+import (
+	"errors"
+	"forum/internal/model"
+	"forum/internal/service"
+	"net/http"
+	"time"
+)
+
+type apiSignUpRequest struct {
+	Email           string `json:"email"`
+	Username        string `json:"username"`
+	Password        string `json:"password"`
+	ConfirmPassword string `json:"confirmPassword"`
+}
+
+type apiSignInRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type apiSession struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+var (
+	errAPIInvalidCredentials = &apiError{Status: http.StatusUnauthorized, Code: "invalid_credentials", Message: "wrong username or password"}
+	errAPIPersonalToken      = &apiError{Status: http.StatusBadRequest, Code: "personal_token", Message: "personal access tokens are revoked from the profile page"}
+)
+
+func (h *Handler) apiSignUp(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	var request apiSignUpRequest
+	if err := decodeJSON(w, r, &request); err != nil {
+		return err
+	}
+
+	newUser := model.User{
+		Email:           request.Email,
+		Username:        request.Username,
+		Password:        request.Password,
+		ConfirmPassword: request.ConfirmPassword,
+	}
+	if err := h.Service.Auth.CreateUser(newUser); err != nil {
+		return err
+	}
+
+	user, err := h.Service.User.GetUserByUsername(request.Username)
+	if err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusCreated, user)
+	return nil
+}
+
+func (h *Handler) apiSignIn(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	var request apiSignInRequest
+	if err := decodeJSON(w, r, &request); err != nil {
+		return err
+	}
+
+	session, err := h.Service.Auth.CreateSession(request.Username, request.Password, r.UserAgent(), clientIP(r))
+	if err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			return errAPIInvalidCredentials
+		}
+		return err
+	}
+	writeJSON(w, http.StatusOK, apiSession{Token: session.Token, ExpiresAt: session.ExpirationTime})
+	return nil
+}
+
+func (h *Handler) apiSignOut(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	if user := r.Context().Value(ctxKeyUser).(model.User); user.Scopes != 0 {
+		return errAPIPersonalToken
+	}
+	token, _ := sessionToken(r)
+	if err := h.Service.Auth.DeleteToken(token); err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusNoContent, nil)
+	return nil
+}
+
+func (h *Handler) apiMe(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	user := r.Context().Value(ctxKeyUser).(model.User)
+	writeJSON(w, http.StatusOK, user)
+	return nil
+}
@@ -0,0 +1,148 @@
+package delivery
+
+import (
+	"fmt"
+	"forum/internal/model"
+	"net/http"
+)
+
+type apiCommentRequest struct {
+	Content  string `json:"content"`
+	ParentID int    `json:"parentId"`
+}
+
+type apiCommentUpdateRequest struct {
+	Content string `json:"content"`
+}
+
+type apiCommentList struct {
+	Comments []model.Commentary `json:"comments"`
+	model.Page
+}
+
+func (h *Handler) apiGetComments(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	id, err := apiID(params)
+	if err != nil {
+		return err
+	}
+
+	if _, err := h.Service.Post.GetPostByID(id); err != nil {
+		return err
+	}
+
+	comments, page, err := h.Service.Commentary.GetCommentariesByPostID(id, r.URL.Query().Get("cursor"))
+	if err != nil {
+		return err
+	}
+	if comments == nil {
+		comments = []model.Commentary{}
+	}
+	writeJSON(w, http.StatusOK, apiCommentList{Comments: comments, Page: page})
+	return nil
+}
+
+func (h *Handler) apiCreateComment(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	user := r.Context().Value(ctxKeyUser).(model.User)
+	postId, err := apiID(params)
+	if err != nil {
+		return err
+	}
+
+	if _, err := h.Service.Post.GetPostByID(postId); err != nil {
+		return err
+	}
+
+	var request apiCommentRequest
+	if err := decodeJSON(w, r, &request); err != nil {
+		return err
+	}
+
+	id, err := h.Service.Commentary.CreateCommentary(model.Commentary{
+		PostID:   postId,
+		ParentID: request.ParentID,
+		Author:   user.Username,
+		Content:  request.Content,
+	})
+	if err != nil {
+		return err
+	}
+
+	comment, err := h.Service.Commentary.GetCommentaryById(id)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Location", fmt.Sprintf("%s/comments/%d", apiPrefix, comment.ID))
+	writeJSON(w, http.StatusCreated, comment)
+	return nil
+}
+
+func (h *Handler) apiGetComment(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	id, err := apiID(params)
+	if err != nil {
+		return err
+	}
+
+	comment, err := h.Service.Commentary.GetCommentaryById(id)
+	if err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusOK, comment)
+	return nil
+}
+
+func (h *Handler) apiUpdateComment(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	user := r.Context().Value(ctxKeyUser).(model.User)
+	id, err := apiID(params)
+	if err != nil {
+		return err
+	}
+
+	var request apiCommentUpdateRequest
+	if err := decodeJSON(w, r, &request); err != nil {
+		return err
+	}
+
+	if err := h.Service.Commentary.UpdateCommentary(user, model.Commentary{ID: id, Content: request.Content}); err != nil {
+		return err
+	}
+	return h.apiGetComment(w, r, params)
+}
+
+func (h *Handler) apiDeleteComment(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	user := r.Context().Value(ctxKeyUser).(model.User)
+	id, err := apiID(params)
+	if err != nil {
+		return err
+	}
+
+	if err := h.Service.Commentary.DeleteCommentary(user, id); err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusNoContent, nil)
+	return nil
+}
+
+func (h *Handler) apiLikeComment(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	return h.apiVoteComment(w, r, params, h.Service.VoteComment.LikeCommentary)
+}
+
+func (h *Handler) apiDislikeComment(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	return h.apiVoteComment(w, r, params, h.Service.VoteComment.DislikeCommentary)
+}
+
+// apiVoteComment toggles the caller's vote on a comment and answers with the comment's new counts.
+func (h *Handler) apiVoteComment(w http.ResponseWriter, r *http.Request, params map[string]string, vote func(commentId int, username string) error) error {
+	user := r.Context().Value(ctxKeyUser).(model.User)
+	id, err := apiID(params)
+	if err != nil {
+		return err
+	}
+
+	if _, err := h.Service.Commentary.GetCommentaryById(id); err != nil {
+		return err
+	}
+	if err := vote(id, user.Username); err != nil {
+		return err
+	}
+	return h.apiGetComment(w, r, params)
+}
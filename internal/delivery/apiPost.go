@@ -0,0 +1,143 @@
+package delivery
+
+import (
+	"fmt"
+	"forum/internal/model"
+	"forum/internal/service"
+	"net/http"
+)
+
+type apiPostRequest struct {
+	Title      string   `json:"title"`
+	Content    string   `json:"content"`
+	Categories []string `json:"categories"`
+}
+
+type apiPostList struct {
+	Posts []model.Post `json:"posts"`
+	model.Page
+}
+
+func (h *Handler) apiGetPosts(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	filter, err := service.ParsePostFilter(r.URL.Query())
+	if err != nil {
+		return err
+	}
+
+	posts, page, err := h.Service.Post.GetAllPosts(filter)
+	if err != nil {
+		return err
+	}
+	if posts == nil {
+		posts = []model.Post{}
+	}
+	writeJSON(w, http.StatusOK, apiPostList{Posts: posts, Page: page})
+	return nil
+}
+
+func (h *Handler) apiCreatePost(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	user := r.Context().Value(ctxKeyUser).(model.User)
+	var request apiPostRequest
+	if err := decodeJSON(w, r, &request); err != nil {
+		return err
+	}
+
+	id, err := h.Service.Post.CreatePost(model.Post{
+		Title:    request.Title,
+		Content:  request.Content,
+		Author:   user.Username,
+		Category: formCategories(request.Categories),
+	}, nil)
+	if err != nil {
+		return err
+	}
+
+	post, err := h.Service.Post.GetPostByID(id)
+	if err != nil {
+		return err
+	}
+	h.signImageURLs(post.Images)
+	w.Header().Set("Location", fmt.Sprintf("%s/posts/%d", apiPrefix, post.ID))
+	writeJSON(w, http.StatusCreated, post)
+	return nil
+}
+
+func (h *Handler) apiGetPost(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	id, err := apiID(params)
+	if err != nil {
+		return err
+	}
+
+	post, err := h.Service.Post.GetPostByID(id)
+	if err != nil {
+		return err
+	}
+	h.signImageURLs(post.Images)
+	writeJSON(w, http.StatusOK, post)
+	return nil
+}
+
+func (h *Handler) apiUpdatePost(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	user := r.Context().Value(ctxKeyUser).(model.User)
+	id, err := apiID(params)
+	if err != nil {
+		return err
+	}
+
+	post, err := h.Service.Post.GetPostByID(id)
+	if err != nil {
+		return err
+	}
+
+	var request apiPostRequest
+	if err := decodeJSON(w, r, &request); err != nil {
+		return err
+	}
+	post.Title = request.Title
+	post.Content = request.Content
+	post.Category = formCategories(request.Categories)
+
+	if err := h.Service.Post.UpdatePost(user, post); err != nil {
+		return err
+	}
+	return h.apiGetPost(w, r, params)
+}
+
+func (h *Handler) apiDeletePost(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	user := r.Context().Value(ctxKeyUser).(model.User)
+	id, err := apiID(params)
+	if err != nil {
+		return err
+	}
+
+	if err := h.Service.Post.DeletePost(user, id); err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusNoContent, nil)
+	return nil
+}
+
+func (h *Handler) apiLikePost(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	return h.apiVotePost(w, r, params, h.Service.VotePost.LikePost)
+}
+
+func (h *Handler) apiDislikePost(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	return h.apiVotePost(w, r, params, h.Service.VotePost.DislikePost)
+}
+
+// apiVotePost toggles the caller's vote on a post and answers with the post's new counts.
+func (h *Handler) apiVotePost(w http.ResponseWriter, r *http.Request, params map[string]string, vote func(postId int, username string) error) error {
+	user := r.Context().Value(ctxKeyUser).(model.User)
+	id, err := apiID(params)
+	if err != nil {
+		return err
+	}
+
+	if _, err := h.Service.Post.GetPostByID(id); err != nil {
+		return err
+	}
+	if err := vote(id, user.Username); err != nil {
+		return err
+	}
+	return h.apiGetPost(w, r, params)
+}
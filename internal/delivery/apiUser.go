@@ -0,0 +1,86 @@
+package delivery
+
+import (
+	"forum/internal/model"
+	"net/http"
+	"time"
+)
+
+type apiSearchResults struct {
+	Results []model.SearchResult `json:"results"`
+}
+
+type apiCategoryStats struct {
+	model.Category
+	Posts        int        `json:"posts"`
+	LastActivity *time.Time `json:"lastActivity,omitempty"`
+}
+
+type apiCategoryList struct {
+	Categories []apiCategoryStats `json:"categories"`
+}
+
+func (h *Handler) apiGetUser(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	me := r.Context().Value(ctxKeyUser).(model.User)
+	user, err := h.Service.User.GetUserByUsername(params["username"])
+	if err != nil {
+		return err
+	}
+	if user.Username != me.Username {
+		user.Email = ""
+	}
+	writeJSON(w, http.StatusOK, user)
+	return nil
+}
+
+// apiGetUserPosts lists the user's posts chosen by the posts parameter, created by default.
+func (h *Handler) apiGetUserPosts(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	user, err := h.Service.User.GetUserByUsername(params["username"])
+	if err != nil {
+		return err
+	}
+
+	query := r.URL.Query()
+	if query.Get("posts") == "" {
+		query.Set("posts", "created")
+	}
+	posts, page, err := h.Service.User.GetPostByUsername(user.Username, query)
+	if err != nil {
+		return err
+	}
+	if posts == nil {
+		posts = []model.Post{}
+	}
+	writeJSON(w, http.StatusOK, apiPostList{Posts: posts, Page: page})
+	return nil
+}
+
+func (h *Handler) apiGetCategories(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	categories, err := h.Service.Category.GetCategoryIndex()
+	if err != nil {
+		return err
+	}
+
+	list := apiCategoryList{Categories: make([]apiCategoryStats, len(categories))}
+	for i, category := range categories {
+		list.Categories[i] = apiCategoryStats{Category: category, Posts: category.Posts}
+		if !category.LastActivity.IsZero() {
+			lastActivity := category.LastActivity
+			list.Categories[i].LastActivity = &lastActivity
+		}
+	}
+	writeJSON(w, http.StatusOK, list)
+	return nil
+}
+
+func (h *Handler) apiSearch(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	results, err := h.Service.Post.Search(r.URL.Query().Get("q"))
+	if err != nil {
+		return err
+	}
+	if results == nil {
+		results = []model.SearchResult{}
+	}
+	writeJSON(w, http.StatusOK, apiSearchResults{Results: results})
+	return nil
+}
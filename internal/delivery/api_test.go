@@ -0,0 +1,265 @@
+package delivery
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"forum/internal/config"
+	"forum/internal/mail"
+	"forum/internal/model"
+	"forum/internal/repository"
+	"forum/internal/service"
+	"forum/internal/storage"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestServer serves the forum from a fresh in-memory database, configured as configs/config.json is.
+func newTestServer(t *testing.T) (*httptest.Server, *sql.DB) {
+	t.Helper()
+	cfg := config.NewConfig("../../configs/config.json")
+	if cfg == nil {
+		t.Fatal("cannot read configs/config.json")
+	}
+	cfg.Db.DBName = "file:" + strings.ReplaceAll(t.Name(), "/", "_") + "?mode=memory&cache=shared"
+	cfg.Uploads.Dir = t.TempDir()
+	cfg.Uploads.URLSecret = "secret"
+
+	db, err := repository.InitDB(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := repository.CreateTables(db); err != nil {
+		t.Fatal(err)
+	}
+
+	storage, err := storage.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender, err := mail.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	templates, err := mail.ParseTemplates("../../web/mail")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The API renders no templates, so the handler goes without them.
+	handler := &Handler{Service: service.NewService(repository.NewRepository(db, cfg), storage, sender, templates, cfg)}
+	mux := http.NewServeMux()
+	handler.InitRoutes(mux)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, db
+}
+
+// apiCall sends body as JSON, signed in with the bearer token when one is given, and decodes the
+// answer into out when it is not nil.
+func apiCall(t *testing.T, server *httptest.Server, method, path, token string, body, out interface{}) *http.Response {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, server.URL+apiPrefix+path, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: decode answer: %v", method, path, err)
+		}
+	}
+	return resp
+}
+
+// apiTestUser is the part of a user answer the tests read back; roles are only ever written out.
+type apiTestUser struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+	Posts    int    `json:"posts"`
+}
+
+// checkAPIError checks that resp is a JSON error object with the given status and code, and nothing else.
+func checkAPIError(t *testing.T, resp *http.Response, body map[string]json.RawMessage, status int, code string) {
+	t.Helper()
+	if resp.StatusCode != status {
+		t.Errorf("status %d, want %d", resp.StatusCode, status)
+	}
+	if contentType := resp.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "application/json") {
+		t.Errorf("Content-Type %q, want JSON", contentType)
+	}
+	if len(body) != 1 || body["error"] == nil {
+		t.Fatalf("body has keys %v, want only error", body)
+	}
+	var apiErr map[string]string
+	if err := json.Unmarshal(body["error"], &apiErr); err != nil {
+		t.Fatal(err)
+	}
+	if len(apiErr) != 2 || apiErr["code"] != code || apiErr["message"] == "" {
+		t.Errorf("error %v, want code %q and a message", apiErr, code)
+	}
+}
+
+// signUpVerified creates an account through the API, confirms its email address and returns a
+// bearer token for it.
+func signUpVerified(t *testing.T, server *httptest.Server, db *sql.DB, username string) string {
+	t.Helper()
+	signUp := apiSignUpRequest{Email: username + "@example.com", Username: username, Password: "password", ConfirmPassword: "password"}
+	var user apiTestUser
+	if resp := apiCall(t, server, http.MethodPost, "/auth/signup", "", signUp, &user); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("sign up: status %d", resp.StatusCode)
+	}
+	// Following the emailed link only deletes the pending verification.
+	if _, err := db.Exec(`DELETE FROM email_verification WHERE userID = $1;`, user.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	var session apiSession
+	if resp := apiCall(t, server, http.MethodPost, "/auth/signin", "", apiSignInRequest{Username: username, Password: "password"}, &session); resp.StatusCode != http.StatusOK {
+		t.Fatalf("sign in: status %d", resp.StatusCode)
+	}
+	return session.Token
+}
+
+func TestAPIUnauthorized(t *testing.T) {
+	server, db := newTestServer(t)
+	token := signUpVerified(t, server, db, "alice")
+
+	tests := []struct {
+		name, method, path, token string
+		body                      interface{}
+	}{
+		{"no token", http.MethodGet, "/me", "", nil},
+		{"unknown token", http.MethodGet, "/me", "not-a-token", nil},
+		{"unknown personal token", http.MethodGet, "/me", model.APITokenPrefix + "0000", nil},
+		{"create post", http.MethodPost, "/posts", "", apiPostRequest{Title: "title", Content: "content", Categories: []string{"alem"}}},
+		{"sign out", http.MethodPost, "/auth/signout", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body map[string]json.RawMessage
+			resp := apiCall(t, server, tt.method, tt.path, tt.token, tt.body, &body)
+			checkAPIError(t, resp, body, http.StatusUnauthorized, "unauthorized")
+		})
+	}
+
+	t.Run("session cookie", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, server.URL+apiPrefix+"/me", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: token})
+		resp, err := server.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var body map[string]json.RawMessage
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		checkAPIError(t, resp, body, http.StatusUnauthorized, "unauthorized")
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		var body map[string]json.RawMessage
+		resp := apiCall(t, server, http.MethodPost, "/auth/signin", "", apiSignInRequest{Username: "alice", Password: "wrong"}, &body)
+		checkAPIError(t, resp, body, http.StatusUnauthorized, "invalid_credentials")
+	})
+}
+
+func TestAPIErrorShape(t *testing.T) {
+	server, db := newTestServer(t)
+	token := signUpVerified(t, server, db, "alice")
+
+	tests := []struct {
+		name, method, path string
+		body               interface{}
+		status             int
+		code               string
+	}{
+		{"unknown route", http.MethodGet, "/nothing", nil, http.StatusNotFound, "not_found"},
+		{"missing post", http.MethodGet, "/posts/1000", nil, http.StatusNotFound, "not_found"},
+		{"wrong method", http.MethodPatch, "/posts", nil, http.StatusMethodNotAllowed, "method_not_allowed"},
+		{"unknown field", http.MethodPost, "/posts", map[string]string{"headline": "title"}, http.StatusBadRequest, "invalid_body"},
+		{"empty title", http.MethodPost, "/posts", apiPostRequest{Content: "content", Categories: []string{"alem"}}, http.StatusBadRequest, "validation_failed"},
+		{"bad filter", http.MethodGet, "/posts?sort=sideways", nil, http.StatusBadRequest, "invalid_query"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body map[string]json.RawMessage
+			resp := apiCall(t, server, tt.method, tt.path, token, tt.body, &body)
+			checkAPIError(t, resp, body, tt.status, tt.code)
+		})
+	}
+}
+
+func TestAPIPostRoundTrip(t *testing.T) {
+	server, db := newTestServer(t)
+	token := signUpVerified(t, server, db, "alice")
+
+	created := make([]model.Post, 3)
+	for i := range created {
+		request := apiPostRequest{Title: fmt.Sprintf("post %d", i), Content: "content", Categories: []string{"alem", "study"}}
+		resp := apiCall(t, server, http.MethodPost, "/posts", token, request, &created[i])
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("create post: status %d", resp.StatusCode)
+		}
+		if want := fmt.Sprintf("%s/posts/%d", apiPrefix, created[i].ID); resp.Header.Get("Location") != want {
+			t.Errorf("Location %q, want %q", resp.Header.Get("Location"), want)
+		}
+		if created[i].Title != request.Title || created[i].Author != "alice" || len(created[i].Category) != 2 {
+			t.Errorf("created %+v from %+v", created[i], request)
+		}
+	}
+
+	var got model.Post
+	if resp := apiCall(t, server, http.MethodGet, fmt.Sprintf("/posts/%d", created[0].ID), "", nil, &got); resp.StatusCode != http.StatusOK {
+		t.Fatalf("get post: status %d", resp.StatusCode)
+	}
+	if got.ID != created[0].ID || got.Title != created[0].Title {
+		t.Errorf("got %+v, want %+v", got, created[0])
+	}
+
+	// Parameters the filter does not know, like those of a shared link, are ignored.
+	var list apiPostList
+	if resp := apiCall(t, server, http.MethodGet, "/posts?limit=2&utm_source=newsletter", "", nil, &list); resp.StatusCode != http.StatusOK {
+		t.Fatalf("list posts: status %d", resp.StatusCode)
+	}
+	if len(list.Posts) != 2 || list.Posts[0].ID != created[2].ID || list.Posts[1].ID != created[1].ID || list.Next == "" {
+		t.Fatalf("first page %+v, want the two newest posts and a next cursor", list)
+	}
+	var rest apiPostList
+	apiCall(t, server, http.MethodGet, "/posts?limit=2&cursor="+list.Next, "", nil, &rest)
+	if len(rest.Posts) != 1 || rest.Posts[0].ID != created[0].ID || rest.Next != "" {
+		t.Fatalf("second page %+v, want the oldest post only", rest)
+	}
+
+	var me apiTestUser
+	if resp := apiCall(t, server, http.MethodGet, "/me", token, nil, &me); resp.StatusCode != http.StatusOK {
+		t.Fatalf("me: status %d", resp.StatusCode)
+	}
+	if me.Username != "alice" || me.Posts != len(created) {
+		t.Errorf("me %+v, want alice with %d posts", me, len(created))
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"forum/internal/service"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -70,7 +72,8 @@ func (h *Handler) signUp(w http.ResponseWriter, r *http.Request) {
 				errors.Is(err, service.ErrInvalidUsernameChar) ||
 				errors.Is(err, service.ErrConfirmPassword) ||
 				errors.Is(err, service.ErrInvalidUsernameLen) ||
-				errors.Is(err, service.ErrUserExist) {
+				errors.Is(err, service.ErrUserExist) ||
+				errors.Is(err, service.ErrUsernameConfusable) {
 				h.errorPage(w, http.StatusBadRequest, err.Error())
 				return
 			}
@@ -78,9 +81,9 @@ func (h *Handler) signUp(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		user, err := h.Service.Auth.GenerateToken(username[0], password[0])
+		session, err := h.Service.Auth.CreateSession(username[0], password[0], r.UserAgent(), clientIP(r))
 		if err != nil {
-			log.Printf("Sign In: Generate Token: %v", err)
+			log.Printf("Sign In: Create Session: %v", err)
 			if errors.Is(err, service.ErrUserNotFound) {
 				h.errorPage(w, http.StatusBadRequest, err.Error())
 				return
@@ -91,12 +94,12 @@ func (h *Handler) signUp(w http.ResponseWriter, r *http.Request) {
 
 		http.SetCookie(w, &http.Cookie{
 			Name:    "session_token",
-			Value:   user.Token,
-			Expires: user.ExpirationTime,
+			Value:   session.Token,
+			Expires: session.ExpirationTime,
 			Path:    "/",
 		})
 
-		http.Redirect(w, r, "/", http.StatusSeeOther)
+		http.Redirect(w, r, "/auth/verify", http.StatusSeeOther)
 	default:
 		log.Println("Sign Up: Method not allowed")
 		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
@@ -139,9 +142,9 @@ func (h *Handler) signIn(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		user, err := h.Service.Auth.GenerateToken(username[0], password[0])
+		session, err := h.Service.Auth.CreateSession(username[0], password[0], r.UserAgent(), clientIP(r))
 		if err != nil {
-			log.Printf("Sign In: Generate Token: %v", err)
+			log.Printf("Sign In: Create Session: %v", err)
 			if errors.Is(err, service.ErrUserNotFound) {
 				h.errorPage(w, http.StatusBadRequest, err.Error())
 				return
@@ -152,8 +155,8 @@ func (h *Handler) signIn(w http.ResponseWriter, r *http.Request) {
 
 		http.SetCookie(w, &http.Cookie{
 			Name:    "session_token",
-			Value:   user.Token,
-			Expires: user.ExpirationTime,
+			Value:   session.Token,
+			Expires: session.ExpirationTime,
 			Path:    "/",
 		})
 
@@ -203,3 +206,213 @@ func (h *Handler) logout(w http.ResponseWriter, r *http.Request) {
 
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
+
+// verifyEmail confirms an email address when given the token of a verification link, and otherwise
+// shows signed-in users whether their address is confirmed.
+func (h *Handler) verifyEmail(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(model.User)
+	if r.Method != http.MethodGet {
+		log.Println("Verify Email: Method not allowed")
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	info := model.Info{
+		User:                user,
+		UnreadMessages:      h.unreadMessages(user),
+		UnreadNotifications: h.unreadNotifications(user),
+	}
+	if token := r.URL.Query().Get("token"); token != "" {
+		if err := h.Service.Auth.VerifyEmail(token); err != nil {
+			log.Printf("Verify Email: %v", err)
+			if errors.Is(err, service.ErrInvalidVerification) {
+				h.errorPage(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		info.Verified = true
+	} else if user == (model.User{}) {
+		h.errorPage(w, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+		return
+	}
+
+	if err := h.tmpl.ExecuteTemplate(w, "verify_email.html", info); err != nil {
+		log.Printf("Verify Email: Execute: %v", err)
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (h *Handler) resendVerification(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(model.User)
+	if user == (model.User{}) {
+		h.errorPage(w, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+		return
+	}
+	if r.Method != http.MethodPost {
+		log.Println("Resend Verification: Method not allowed")
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	if err := h.Service.Auth.ResendVerification(user); err != nil && !errors.Is(err, service.ErrAlreadyVerified) {
+		log.Printf("Resend Verification: %v", err)
+		if errors.Is(err, service.ErrResendCooldown) {
+			h.errorPage(w, http.StatusTooManyRequests, err.Error())
+			return
+		}
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	http.Redirect(w, r, "/auth/verify", http.StatusSeeOther)
+}
+
+// forgotPassword sends a password reset link. The page shown afterwards is the same whether or not
+// the address belongs to an account.
+func (h *Handler) forgotPassword(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		if err := h.tmpl.ExecuteTemplate(w, "forgot_password.html", model.Info{}); err != nil {
+			log.Printf("Forgot Password: Execute: %v", err)
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+		}
+	case http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			log.Printf("Forgot Password: Parse Form: %v", err)
+			h.errorPage(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if err := h.Service.Auth.RequestPasswordReset(r.PostForm.Get("email")); err != nil {
+			log.Printf("Forgot Password: Request Password Reset: %v", err)
+			if errors.Is(err, service.ErrInvalidEmail) {
+				h.errorPage(w, http.StatusBadRequest, service.ErrInvalidEmail.Error())
+				return
+			}
+			h.errorPage(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+
+		if err := h.tmpl.ExecuteTemplate(w, "forgot_password.html", model.Info{ResetSent: true}); err != nil {
+			log.Printf("Forgot Password: Execute: %v", err)
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+		}
+	default:
+		log.Println("Forgot Password: Method not allowed")
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+	}
+}
+
+// resetPassword shows the form of a password reset link, and sets the new password. The session
+// cookie is cleared as well, since the reset ended every session.
+func (h *Handler) resetPassword(w http.ResponseWriter, r *http.Request) {
+	// The page carries the token of the link, which must not end up in caches.
+	w.Header().Set("Cache-Control", "no-store")
+
+	switch r.Method {
+	case http.MethodGet:
+		token := r.URL.Query().Get("token")
+		if err := h.Service.Auth.CheckPasswordReset(token); err != nil {
+			log.Printf("Reset Password: Check Password Reset: %v", err)
+			if errors.Is(err, service.ErrInvalidReset) {
+				h.errorPage(w, http.StatusBadRequest, service.ErrInvalidReset.Error())
+				return
+			}
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		if err := h.tmpl.ExecuteTemplate(w, "reset_password.html", model.Info{ResetToken: token}); err != nil {
+			log.Printf("Reset Password: Execute: %v", err)
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+		}
+	case http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			log.Printf("Reset Password: Parse Form: %v", err)
+			h.errorPage(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if err := h.Service.Auth.ResetPassword(r.PostForm.Get("token"), r.PostForm.Get("password"), r.PostForm.Get("confirm-password")); err != nil {
+			log.Printf("Reset Password: %v", err)
+			if errors.Is(err, service.ErrInvalidReset) {
+				h.errorPage(w, http.StatusBadRequest, service.ErrInvalidReset.Error())
+				return
+			}
+			if errors.Is(err, service.ErrConfirmPassword) {
+				h.errorPage(w, http.StatusBadRequest, service.ErrConfirmPassword.Error())
+				return
+			}
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:    "session_token",
+			Value:   "",
+			Expires: time.Time{},
+			Path:    "/",
+		})
+		if err := h.tmpl.ExecuteTemplate(w, "reset_password.html", model.Info{ResetDone: true}); err != nil {
+			log.Printf("Reset Password: Execute: %v", err)
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+		}
+	default:
+		log.Println("Reset Password: Method not allowed")
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+	}
+}
+
+func (h *Handler) revokeSession(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(model.User)
+	if user == (model.User{}) {
+		h.errorPage(w, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		log.Println("Revoke Session: Method not allowed")
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/auth/sessions/revoke/"))
+	if err != nil {
+		log.Println(err)
+		h.errorPage(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	sessions, err := h.Service.Auth.GetSessions(user.ID)
+	if err != nil {
+		log.Printf("Revoke Session: Get Sessions: %v", err)
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err := h.Service.Auth.RevokeSession(user.ID, id); err != nil {
+		log.Printf("Revoke Session: %v", err)
+		if errors.Is(err, service.ErrSessionNotFound) {
+			h.errorPage(w, http.StatusNotFound, err.Error())
+			return
+		}
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	for _, session := range sessions {
+		if session.ID == id && session.ID == user.SessionID {
+			http.SetCookie(w, &http.Cookie{
+				Name:    "session_token",
+				Value:   "",
+				Expires: time.Time{},
+				Path:    "/",
+			})
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+	}
+
+	http.Redirect(w, r, "/profile/"+user.Username+"?posts=created", http.StatusSeeOther)
+}
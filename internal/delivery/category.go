@@ -0,0 +1,213 @@
+package delivery
+
+import (
+	"errors"
+	"forum/internal/model"
+	"forum/internal/service"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+func (h *Handler) categoriesPage(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(model.User)
+	if r.URL.Path != "/categories" {
+		h.errorPage(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		log.Println("Categories: Method not allowed")
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	categories, err := h.Service.Category.GetCategoryIndex()
+	if err != nil {
+		log.Printf("Categories: Get Category Index: %v", err)
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	info := model.Info{
+		User:                user,
+		Categories:          categories,
+		UnreadMessages:      h.unreadMessages(user),
+		UnreadNotifications: h.unreadNotifications(user),
+	}
+	if user != (model.User{}) {
+		followed, err := h.Service.Digest.GetFollowedCategories(user)
+		if err != nil {
+			log.Printf("Categories: Get Followed Categories: %v", err)
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		info.FollowedCategories = model.CategorySlugs(followed)
+	}
+
+	if err := h.tmpl.ExecuteTemplate(w, "categories.html", info); err != nil {
+		log.Printf("Categories: Execute: %v", err)
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (h *Handler) adminCategories(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(model.User)
+	if r.URL.Path != "/admin/categories" {
+		h.errorPage(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		log.Println("Admin Categories: Method not allowed")
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	categories, err := h.Service.Category.GetAllCategories(user)
+	if err != nil {
+		log.Printf("Admin Categories: Get All Categories: %v", err)
+		if errors.Is(err, service.ErrPermissionDenied) {
+			h.errorPage(w, http.StatusForbidden, err.Error())
+			return
+		}
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	info := model.Info{
+		User:                user,
+		Categories:          categories,
+		UnreadMessages:      h.unreadMessages(user),
+		UnreadNotifications: h.unreadNotifications(user),
+	}
+
+	if err := h.tmpl.ExecuteTemplate(w, "admin_categories.html", info); err != nil {
+		log.Printf("Admin Categories: Execute: %v", err)
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (h *Handler) createCategory(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(model.User)
+	if r.Method != http.MethodPost {
+		log.Println("Create Category: Method not allowed")
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	category, ok := h.parseCategoryForm(w, r, "Create Category")
+	if !ok {
+		return
+	}
+
+	if err := h.Service.Category.CreateCategory(user, category); err != nil {
+		log.Printf("Create Category: %v", err)
+		h.categoryError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/categories", http.StatusSeeOther)
+}
+
+func (h *Handler) updateCategory(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(model.User)
+	if r.Method != http.MethodPost {
+		log.Println("Update Category: Method not allowed")
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	category, ok := h.parseCategoryForm(w, r, "Update Category")
+	if !ok {
+		return
+	}
+
+	if err := h.Service.Category.UpdateCategory(user, category); err != nil {
+		log.Printf("Update Category: %v", err)
+		h.categoryError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/categories", http.StatusSeeOther)
+}
+
+func (h *Handler) archiveCategory(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(model.User)
+	if r.Method != http.MethodPost {
+		log.Println("Archive Category: Method not allowed")
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		log.Printf("Archive Category: Parse Form: %v", err)
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	slug, ok := r.Form["slug"]
+	if !ok {
+		log.Println("Archive Category: Parse Form: slug field not found")
+		h.errorPage(w, http.StatusBadRequest, "slug field not found")
+		return
+	}
+
+	archived := r.Form.Get("archived") == "true"
+	if err := h.Service.Category.SetCategoryArchived(user, slug[0], archived); err != nil {
+		log.Printf("Archive Category: %v", err)
+		h.categoryError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/categories", http.StatusSeeOther)
+}
+
+// parseCategoryForm reads the slug, name, description and position fields shared by the create and
+// update forms. It writes the error page itself and reports false when the form is unusable.
+func (h *Handler) parseCategoryForm(w http.ResponseWriter, r *http.Request, action string) (model.Category, bool) {
+	if err := r.ParseForm(); err != nil {
+		log.Printf("%s: Parse Form: %v", action, err)
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return model.Category{}, false
+	}
+
+	for _, field := range []string{"slug", "name"} {
+		if _, ok := r.Form[field]; !ok {
+			log.Printf("%s: Parse Form: %s field not found", action, field)
+			h.errorPage(w, http.StatusBadRequest, field+" field not found")
+			return model.Category{}, false
+		}
+	}
+
+	category := model.Category{
+		Slug:        r.Form.Get("slug"),
+		Name:        r.Form.Get("name"),
+		Description: r.Form.Get("description"),
+	}
+
+	if position := r.Form.Get("position"); position != "" {
+		var err error
+		if category.Position, err = strconv.Atoi(position); err != nil {
+			log.Printf("%s: Parse Form: position: %v", action, err)
+			h.errorPage(w, http.StatusBadRequest, service.ErrInvalidCategory.Error())
+			return model.Category{}, false
+		}
+	}
+	return category, true
+}
+
+func (h *Handler) categoryError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrPermissionDenied):
+		h.errorPage(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, service.ErrCategoryNotFound):
+		h.errorPage(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, service.ErrCategoryExists):
+		h.errorPage(w, http.StatusConflict, err.Error())
+	case errors.Is(err, service.ErrInvalidCategory):
+		h.errorPage(w, http.StatusBadRequest, err.Error())
+	default:
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+	}
+}
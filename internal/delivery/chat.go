@@ -0,0 +1,257 @@
+package delivery
+
+import (
+	"encoding/json"
+	"errors"
+	"forum/internal/model"
+	"forum/internal/service"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// chatWriteWait is how long writing one frame to a chat socket may take.
+	chatWriteWait = 10 * time.Second
+	// chatPongWait is how long a chat socket may stay silent, pings included, before it is closed.
+	chatPongWait = 60 * time.Second
+	// chatPingInterval is how often the server pings a chat socket, well within chatPongWait.
+	chatPingInterval = chatPongWait * 9 / 10
+	// chatMaxFrame is the largest frame accepted from a chat socket.
+	chatMaxFrame = 4096
+	// chatSessionCheckInterval is how often an open chat socket checks the session it was opened
+	// with is still going.
+	chatSessionCheckInterval = time.Minute
+)
+
+// chatUpgrader turns chat requests into WebSocket connections. Its default origin check refuses
+// pages of other sites, which would otherwise be able to chat with the session cookie of a visitor.
+var chatUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// chatFrame is what the server sends on a chat socket: the history of the room when joining it, each
+// new message, and errors about messages the user sent.
+type chatFrame struct {
+	Type     string              `json:"type"`
+	Messages []model.ChatMessage `json:"messages,omitempty"`
+	Message  *model.ChatMessage  `json:"message,omitempty"`
+	Error    string              `json:"error,omitempty"`
+}
+
+// chatStatus picks the status shown for errors from the chat service.
+func chatStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrCategoryNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrPermissionDenied):
+		return http.StatusForbidden
+	}
+	return http.StatusInternalServerError
+}
+
+// chat serves /chat/{slug}, the chat room of a category, and /chat/{slug}/ws, the WebSocket its page
+// talks to.
+func (h *Handler) chat(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(model.User)
+	slug, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/chat/"), "/")
+	if action != "" && action != "ws" {
+		h.errorPage(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+	if r.Method != http.MethodGet {
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+	if action == "ws" {
+		h.chatSocket(w, r, user, slug)
+		return
+	}
+
+	category, messages, err := h.Service.Chat.GetChatHistory(slug)
+	if err != nil {
+		log.Println(err)
+		h.errorPage(w, chatStatus(err), err.Error())
+		return
+	}
+	info := model.Info{
+		User:                user,
+		Category:            category,
+		ChatMessages:        messages,
+		CanChat:             !category.Archived && h.Service.Role.CheckPermission(user, model.PermChat) == nil,
+		UnreadMessages:      h.unreadMessages(user),
+		UnreadNotifications: h.unreadNotifications(user),
+	}
+	if err := h.tmpl.ExecuteTemplate(w, "chat.html", info); err != nil {
+		log.Println(err)
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// chatSocket connects a signed-in user to the chat room of a category. The socket first receives
+// the history of the room, then every new message; what the user sends on it is posted to the room.
+// A socket reading too slowly is closed, and its page reconnects to catch up from the history.
+func (h *Handler) chatSocket(w http.ResponseWriter, r *http.Request, user model.User, slug string) {
+	if user == (model.User{}) {
+		h.errorPage(w, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+		return
+	}
+	category, err := h.Service.Category.GetCategory(slug)
+	if err != nil {
+		log.Println(err)
+		h.errorPage(w, chatStatus(err), err.Error())
+		return
+	}
+
+	// Subscribing before reading the history means no message falls in between; the ones in both
+	// are skipped below.
+	sub, _, _ := h.Service.Events.Subscribe(service.ChatTopic(category.ID), 0)
+	defer h.Service.Events.Unsubscribe(sub)
+	_, history, err := h.Service.Chat.GetChatHistory(slug)
+	if err != nil {
+		log.Println(err)
+		h.errorPage(w, chatStatus(err), err.Error())
+		return
+	}
+
+	conn, err := chatUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already answered the request.
+		log.Println(err)
+		return
+	}
+	defer conn.Close()
+
+	lastId := 0
+	if len(history) > 0 {
+		lastId = history[len(history)-1].ID
+	}
+	token, _ := sessionToken(r)
+	replies := make(chan chatFrame, 1)
+	done := make(chan struct{})
+	go h.readChat(conn, token, slug, replies, done)
+
+	write := func(frame chatFrame) error {
+		conn.SetWriteDeadline(time.Now().Add(chatWriteWait))
+		return conn.WriteJSON(frame)
+	}
+	if err := write(chatFrame{Type: "history", Messages: history}); err != nil {
+		return
+	}
+
+	ping := time.NewTicker(chatPingInterval)
+	defer ping.Stop()
+	sessionCheck := time.NewTicker(chatSessionCheckInterval)
+	defer sessionCheck.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case e, ok := <-sub.C:
+			if !ok {
+				conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too far behind"),
+					time.Now().Add(chatWriteWait))
+				return
+			}
+			message := e.Data.(model.ChatMessage)
+			if message.ID <= lastId {
+				continue
+			}
+			if err := write(chatFrame{Type: "message", Message: &message}); err != nil {
+				return
+			}
+		case frame := <-replies:
+			if err := write(frame); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(chatWriteWait)); err != nil {
+				return
+			}
+		case <-sessionCheck.C:
+			if _, ok := h.socketUser(token); !ok {
+				closeChatSession(conn)
+				return
+			}
+		}
+	}
+}
+
+// socketUser tells who the session a socket was opened with belongs to now. The socket outlives the
+// request that opened it, so it has to notice the session ending by signing out, expiring or being
+// revoked, and pick up changes to the user's role.
+func (h *Handler) socketUser(token string) (model.User, bool) {
+	user, err := h.Service.ParseToken(token)
+	if err != nil || user.ExpirationTime.Before(time.Now()) {
+		return model.User{}, false
+	}
+	return user, true
+}
+
+// closeChatSession tells the client its session ended, so it stops reconnecting.
+func closeChatSession(conn *websocket.Conn) {
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "session ended"),
+		time.Now().Add(chatWriteWait))
+}
+
+// readChat posts the messages sent on conn to the chat room, as the user the session token belongs
+// to, passing errors about them back through replies, until the socket or the session closes; then
+// it closes done.
+func (h *Handler) readChat(conn *websocket.Conn, token, slug string, replies chan<- chatFrame, done chan<- struct{}) {
+	defer close(done)
+	conn.SetReadLimit(chatMaxFrame)
+	conn.SetReadDeadline(time.Now().Add(chatPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(chatPongWait))
+	})
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Println(err)
+			}
+			return
+		}
+		conn.SetReadDeadline(time.Now().Add(chatPongWait))
+
+		var input struct {
+			Content string `json:"content"`
+		}
+		user, ok := h.socketUser(token)
+		if !ok {
+			closeChatSession(conn)
+			return
+		}
+		if err = json.Unmarshal(data, &input); err != nil {
+			err = service.ErrInvalidChatMessage
+		} else {
+			_, err = h.Service.Chat.SendChatMessage(user, slug, input.Content)
+		}
+		if err != nil {
+			select {
+			case replies <- chatFrame{Type: "error", Error: chatError(err)}:
+			default:
+				// The writer is still busy with the previous error, which says enough.
+			}
+		}
+	}
+}
+
+// chatError turns an error from sending a chat message into what the user is told about it.
+func chatError(err error) string {
+	for _, known := range []error{
+		service.ErrInvalidChatMessage, service.ErrChatMessageLen, service.ErrChatArchived, service.ErrChatRateLimited,
+		service.ErrPermissionDenied, service.ErrCategoryNotFound,
+	} {
+		if errors.Is(err, known) {
+			return known.Error()
+		}
+	}
+	log.Println(err)
+	return http.StatusText(http.StatusInternalServerError)
+}
@@ -0,0 +1,55 @@
+package delivery
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestChatSocketClosesWithSession(t *testing.T) {
+	server, db := newTestServer(t)
+	token := signUpVerified(t, server, db, "alice")
+
+	header := http.Header{"Cookie": {"session_token=" + token}}
+	conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/chat/alem/ws", header)
+	if err != nil {
+		t.Fatalf("dial: %v (%v)", err, resp)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	var frame chatFrame
+	if err := conn.ReadJSON(&frame); err != nil || frame.Type != "history" {
+		t.Fatalf("first frame %+v, %v, want the history", frame, err)
+	}
+	if err := conn.WriteJSON(map[string]string{"content": "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.ReadJSON(&frame); err != nil || frame.Type != "message" || frame.Message.Content != "hello" {
+		t.Fatalf("frame %+v, %v, want the message sent", frame, err)
+	}
+
+	if resp := apiCall(t, server, http.MethodPost, "/auth/signout", token, nil, nil); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("sign out: status %d", resp.StatusCode)
+	}
+	if err := conn.WriteJSON(map[string]string{"content": "still here?"}); err != nil {
+		t.Fatal(err)
+	}
+	err = conn.ReadJSON(&frame)
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != websocket.ClosePolicyViolation {
+		t.Fatalf("after signing out: frame %+v, %v, want the socket closed", frame, err)
+	}
+
+	var messages int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM chat_message;`).Scan(&messages); err != nil {
+		t.Fatal(err)
+	}
+	if messages != 1 {
+		t.Errorf("%d chat messages stored, want 1", messages)
+	}
+}
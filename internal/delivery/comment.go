@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"forum/internal/model"
+	"forum/internal/service"
 	"log"
 	"net/http"
 	"strconv"
@@ -80,3 +81,113 @@ func (h *Handler) dislikeComment(w http.ResponseWriter, r *http.Request) {
 
 	http.Redirect(w, r, fmt.Sprintf("/post/%d", comment.PostID), http.StatusSeeOther)
 }
+
+func (h *Handler) editComment(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(model.User)
+	if user == (model.User{}) {
+		h.errorPage(w, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		log.Println("method not allowed edit comment")
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/comment/edit/"))
+	if err != nil {
+		log.Println(err)
+		h.errorPage(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		log.Printf("Edit comment: Parse Form: %v", err)
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	content, ok := r.Form["comment"]
+	if !ok {
+		log.Printf("Edit comment: Parse Form: comment field not found")
+		h.errorPage(w, http.StatusBadRequest, "comment field not found")
+		return
+	}
+
+	comment, err := h.Service.Commentary.GetCommentaryById(id)
+	if err != nil {
+		log.Println(err)
+		if errors.Is(err, sql.ErrNoRows) {
+			h.errorPage(w, http.StatusNotFound, err.Error())
+			return
+		}
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	comment.Content = content[0]
+
+	if err := h.Service.Commentary.UpdateCommentary(user, comment); err != nil {
+		log.Println(err)
+		switch {
+		case errors.Is(err, service.ErrCommentLen) || errors.Is(err, service.ErrInvalidCommentChar):
+			h.errorPage(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, service.ErrPermissionDenied):
+			h.errorPage(w, http.StatusForbidden, err.Error())
+		case errors.Is(err, service.ErrCommentDeleted) || errors.Is(err, sql.ErrNoRows):
+			h.errorPage(w, http.StatusNotFound, err.Error())
+		default:
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/post/%d", comment.PostID), http.StatusSeeOther)
+}
+
+func (h *Handler) deleteComment(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(model.User)
+	if user == (model.User{}) {
+		h.errorPage(w, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		log.Println("method not allowed delete comment")
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/comment/delete/"))
+	if err != nil {
+		log.Println(err)
+		h.errorPage(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	comment, err := h.Service.Commentary.GetCommentaryById(id)
+	if err != nil {
+		log.Println(err)
+		if errors.Is(err, sql.ErrNoRows) {
+			h.errorPage(w, http.StatusNotFound, err.Error())
+			return
+		}
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err := h.Service.Commentary.DeleteCommentary(user, id); err != nil {
+		log.Println(err)
+		switch {
+		case errors.Is(err, service.ErrPermissionDenied):
+			h.errorPage(w, http.StatusForbidden, err.Error())
+		case errors.Is(err, service.ErrCommentDeleted) || errors.Is(err, sql.ErrNoRows):
+			h.errorPage(w, http.StatusNotFound, err.Error())
+		default:
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/post/%d", comment.PostID), http.StatusSeeOther)
+}
@@ -0,0 +1,124 @@
+package delivery
+
+import (
+	"errors"
+	"forum/internal/model"
+	"forum/internal/service"
+	"log"
+	"net/http"
+)
+
+// followCategory follows or unfollows the category named by the slug field, for digests.
+func (h *Handler) followCategory(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(model.User)
+	if user == (model.User{}) {
+		h.errorPage(w, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+		return
+	}
+	if r.Method != http.MethodPost {
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		log.Println(err)
+		h.errorPage(w, http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
+		return
+	}
+
+	var err error
+	if r.PostForm.Get("follow") == "true" {
+		err = h.Service.Digest.FollowCategory(user, r.PostForm.Get("slug"))
+	} else {
+		err = h.Service.Digest.UnfollowCategory(user, r.PostForm.Get("slug"))
+	}
+	if err != nil {
+		log.Println(err)
+		h.categoryError(w, err)
+		return
+	}
+	http.Redirect(w, r, "/categories", http.StatusSeeOther)
+}
+
+func (h *Handler) digestSettings(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(model.User)
+	if user == (model.User{}) {
+		h.errorPage(w, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+		return
+	}
+	if r.Method != http.MethodPost {
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		log.Println(err)
+		h.errorPage(w, http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
+		return
+	}
+
+	if err := h.Service.Digest.SetDigestFrequency(user, model.DigestFrequency(r.PostForm.Get("frequency"))); err != nil {
+		log.Println(err)
+		if errors.Is(err, service.ErrInvalidDigestFrequency) {
+			h.errorPage(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	http.Redirect(w, r, "/notifications", http.StatusSeeOther)
+}
+
+// unsubscribe serves the link at the bottom of digests. Opening it only asks to confirm, since mail
+// scanners follow links on their own; the confirmation POSTs back, as do mail clients offering their
+// own unsubscribe button (RFC 8058), and only that turns digests off.
+func (h *Handler) unsubscribe(w http.ResponseWriter, r *http.Request) {
+	// The page carries the token of the link, which must not end up in caches.
+	w.Header().Set("Cache-Control", "no-store")
+
+	switch r.Method {
+	case http.MethodGet:
+		token := r.URL.Query().Get("token")
+		if err := h.Service.Digest.CheckUnsubscribe(token); err != nil {
+			log.Println(err)
+			h.unsubscribeError(w, err)
+			return
+		}
+		if err := h.tmpl.ExecuteTemplate(w, "unsubscribe.html", model.Info{UnsubscribeToken: token}); err != nil {
+			log.Println(err)
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+		}
+	case http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			log.Println(err)
+			h.errorPage(w, http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
+			return
+		}
+		// One-click requests carry the token in the link and List-Unsubscribe=One-Click as the body.
+		token := r.PostForm.Get("token")
+		if token == "" {
+			token = r.URL.Query().Get("token")
+		}
+		if err := h.Service.Digest.Unsubscribe(token); err != nil {
+			log.Println(err)
+			h.unsubscribeError(w, err)
+			return
+		}
+		if r.PostForm.Get("List-Unsubscribe") == "One-Click" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		if err := h.tmpl.ExecuteTemplate(w, "unsubscribe.html", model.Info{Unsubscribed: true}); err != nil {
+			log.Println(err)
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+		}
+	default:
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+	}
+}
+
+func (h *Handler) unsubscribeError(w http.ResponseWriter, err error) {
+	if errors.Is(err, service.ErrInvalidUnsubscribe) {
+		h.errorPage(w, http.StatusNotFound, service.ErrInvalidUnsubscribe.Error())
+		return
+	}
+	h.errorPage(w, http.StatusInternalServerError, err.Error())
+}
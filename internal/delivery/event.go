@@ -0,0 +1,137 @@
+package delivery
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"forum/internal/event"
+	"forum/internal/model"
+	"forum/internal/service"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// heartbeatInterval is how often an idle event stream sends a comment, so proxies keep the
+	// connection open and dead ones are noticed.
+	heartbeatInterval = 15 * time.Second
+	// reconnectDelay is how long browsers wait before reconnecting a dropped event stream.
+	reconnectDelay = 3 * time.Second
+)
+
+// eventReload tells a page it missed events that are gone and has to be reloaded to catch up.
+const eventReload = "reload"
+
+// commentEvent is the data of a comment event: the comment rendered for the page receiving it.
+type commentEvent struct {
+	ID       int    `json:"id"`
+	ParentID int    `json:"parentId,omitempty"`
+	Depth    int    `json:"depth"`
+	HTML     string `json:"html"`
+}
+
+// postEvents streams what happens on a post as server-sent events: new comments and updated like
+// and dislike counts. A page reconnecting with Last-Event-ID first receives what it missed, or a
+// reload event if that is no longer known. A page reading too slowly is disconnected, and catches
+// up when its browser reconnects.
+func (h *Handler) postEvents(w http.ResponseWriter, r *http.Request, postId int) {
+	user := r.Context().Value(ctxKeyUser).(model.User)
+	if r.Method != http.MethodGet {
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		h.errorPage(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+
+	lastId := r.Header.Get("Last-Event-ID")
+	if lastId == "" {
+		// EventSource cannot set headers, so the first connection of a page passes the ID it was
+		// rendered with in the query.
+		lastId = r.URL.Query().Get("lastEventId")
+	}
+	var last uint64
+	if lastId != "" {
+		var err error
+		if last, err = strconv.ParseUint(lastId, 10, 64); err != nil {
+			h.errorPage(w, http.StatusBadRequest, "invalid Last-Event-ID")
+			return
+		}
+	}
+
+	sub, missed, complete := h.Service.Events.Subscribe(service.PostTopic(postId), last)
+	defer h.Service.Events.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if _, err := fmt.Fprintf(w, "retry: %d\n\n", reconnectDelay.Milliseconds()); err != nil {
+		return
+	}
+	if !complete {
+		if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: {}\n\n", h.Service.Events.LastID(), eventReload); err != nil {
+			return
+		}
+	}
+	for _, e := range missed {
+		if err := h.writeEvent(w, user, e); err != nil {
+			log.Println(err)
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-sub.C:
+			if !ok {
+				// The page fell behind and was dropped by the bus.
+				return
+			}
+			if err := h.writeEvent(w, user, e); err != nil {
+				log.Println(err)
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// writeEvent writes one event of the bus in the event stream format. Comments are rendered for user,
+// the same way the post page shows them.
+func (h *Handler) writeEvent(w http.ResponseWriter, user model.User, e event.Event) error {
+	data := e.Data
+	if comment, ok := e.Data.(model.Commentary); ok {
+		info := model.Info{
+			User:                user,
+			CanComment:          h.Service.Role.CheckPermission(user, model.PermComment) == nil,
+			CanEditAnyComment:   h.Service.Role.CheckPermission(user, model.PermEditAnyComment) == nil,
+			CanDeleteAnyComment: h.Service.Role.CheckPermission(user, model.PermDeleteAnyComment) == nil,
+		}
+		var html bytes.Buffer
+		if err := h.tmpl.ExecuteTemplate(&html, "commentary", map[string]interface{}{"Comment": comment, "Info": info}); err != nil {
+			return fmt.Errorf("delivery: write event: %w", err)
+		}
+		data = commentEvent{ID: comment.ID, ParentID: comment.ParentID, Depth: comment.Depth, HTML: html.String()}
+	}
+
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("delivery: write event: %w", err)
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, encoded)
+	return err
+}
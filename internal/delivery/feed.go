@@ -0,0 +1,316 @@
+package delivery
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"forum/internal/model"
+	"forum/internal/service"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const feedSize = 20
+
+// feed describes what a feed is about. Link and Self are paths on this site; the handler makes them
+// absolute using the request's host.
+type feed struct {
+	Title       string
+	Description string
+	Link        string
+	Self        string
+	Posts       []model.Post
+}
+
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID       string      `xml:"id"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle,omitempty"`
+	Updated  string      `xml:"updated"`
+	Links    []atomLink  `xml:"link"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Updated    string         `xml:"updated"`
+	Published  string         `xml:"published"`
+	Author     atomPerson     `xml:"author"`
+	Link       atomLink       `xml:"link"`
+	Categories []atomCategory `xml:"category"`
+	Content    atomText       `xml:"content"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+	URI  string `xml:"uri,omitempty"`
+}
+
+type atomCategory struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr,omitempty"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	AtomNS  string     `xml:"xmlns:atom,attr"`
+	DCNS    string     `xml:"xmlns:dc,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	AtomLink      atomLink  `xml:"atom:link"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	GUID        rssGUID  `xml:"guid"`
+	PubDate     string   `xml:"pubDate"`
+	Creator     string   `xml:"dc:creator"`
+	Categories  []string `xml:"category"`
+	Description string   `xml:"description"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+func (h *Handler) forumFeed(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/feed.atom" && r.URL.Path != "/feed.rss" {
+		h.errorPage(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	h.serveFeed(w, r, model.PostFilter{}, feed{
+		Title:       "Forum",
+		Description: "Latest posts on the forum",
+		Link:        "/",
+		Self:        r.URL.Path,
+	})
+}
+
+func (h *Handler) categoryFeed(w http.ResponseWriter, r *http.Request) {
+	slug, format, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/category/"), "/")
+	if !ok || (format != "feed.atom" && format != "feed.rss") {
+		h.errorPage(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	category, err := h.Service.Category.GetCategory(slug)
+	if err != nil {
+		log.Printf("Category Feed: %v", err)
+		if errors.Is(err, service.ErrCategoryNotFound) {
+			h.errorPage(w, http.StatusNotFound, err.Error())
+			return
+		}
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.serveFeed(w, r, model.PostFilter{Categories: []string{category.Slug}}, feed{
+		Title:       category.Name + " | Forum",
+		Description: category.Description,
+		Link:        "/?category=" + url.QueryEscape(category.Slug),
+		Self:        r.URL.Path,
+	})
+}
+
+// userFeed serves /profile/{username}/feed.atom and feed.rss, which userProfile hands over.
+func (h *Handler) userFeed(w http.ResponseWriter, r *http.Request, username string) {
+	user, err := h.Service.User.GetUserByUsername(username)
+	if err != nil {
+		log.Printf("User Feed: %v", err)
+		h.errorPage(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	h.serveFeed(w, r, model.PostFilter{Author: user.Username}, feed{
+		Title:       user.Username + " | Forum",
+		Description: "Latest posts by " + user.Username,
+		Link:        "/profile/" + url.PathEscape(user.Username) + "?posts=created",
+		Self:        r.URL.Path,
+	})
+}
+
+// serveFeed writes the newest posts matching filter as Atom or RSS 2.0, depending on the extension
+// of the requested path. There is no Last-Modified: deleting a post changes the document without
+// leaving a time behind, so only the ETag, which covers the whole document, says when it changed.
+func (h *Handler) serveFeed(w http.ResponseWriter, r *http.Request, filter model.PostFilter, f feed) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		log.Println("Feed: Method not allowed")
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	filter.Sort = model.SortNew
+	filter.Limit = feedSize
+	posts, _, err := h.Service.Post.GetAllPosts(filter)
+	if err != nil {
+		log.Printf("Feed: Get Posts: %v", err)
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for i := range posts {
+		posts[i].CreationTime = localTime(posts[i].CreationTime)
+		if !posts[i].UpdateTime.IsZero() {
+			posts[i].UpdateTime = localTime(posts[i].UpdateTime)
+		}
+	}
+	f.Posts = posts
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	base := scheme + "://" + r.Host
+
+	var document interface{}
+	contentType := "application/atom+xml; charset=utf-8"
+	if strings.HasSuffix(r.URL.Path, ".rss") {
+		document = rssDocument(f, base)
+		contentType = "application/rss+xml; charset=utf-8"
+	} else {
+		document = atomDocument(f, base)
+	}
+
+	var body bytes.Buffer
+	body.WriteString(xml.Header)
+	if err := xml.NewEncoder(&body).Encode(document); err != nil {
+		log.Printf("Feed: Encode: %v", err)
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	sum := sha256.Sum256(body.Bytes())
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	// ServeContent answers If-None-Match with 304 and handles HEAD.
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(body.Bytes()))
+}
+
+// localTime reads a time SQLite stored in local time, without a zone, which the driver hands back as
+// if it were UTC.
+func localTime(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.Local)
+}
+
+// postUpdated is when a post was last edited, or created if it never was.
+func postUpdated(post model.Post) time.Time {
+	if post.UpdateTime.IsZero() {
+		return post.CreationTime
+	}
+	return post.UpdateTime
+}
+
+// feedUpdated is when the latest of the posts was written or edited, or the zero time for an empty feed.
+func feedUpdated(posts []model.Post) time.Time {
+	var updated time.Time
+	for _, post := range posts {
+		if postUpdated(post).After(updated) {
+			updated = postUpdated(post)
+		}
+	}
+	return updated
+}
+
+func atomDocument(f feed, base string) atomFeed {
+	updated := feedUpdated(f.Posts)
+	if updated.IsZero() {
+		updated = time.Unix(0, 0)
+	}
+
+	doc := atomFeed{
+		ID:       base + f.Link,
+		Title:    f.Title,
+		Subtitle: f.Description,
+		Updated:  updated.UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: base + f.Self},
+			{Rel: "alternate", Type: "text/html", Href: base + f.Link},
+		},
+	}
+	for _, post := range f.Posts {
+		link := base + "/post/" + strconv.Itoa(post.ID)
+		entry := atomEntry{
+			ID:        link,
+			Title:     post.Title,
+			Updated:   postUpdated(post).UTC().Format(time.RFC3339),
+			Published: post.CreationTime.UTC().Format(time.RFC3339),
+			Author:    atomPerson{Name: post.Author, URI: base + "/profile/" + url.PathEscape(post.Author) + "?posts=created"},
+			Link:      atomLink{Rel: "alternate", Type: "text/html", Href: link},
+			Content:   atomText{Type: "text", Body: post.Content},
+		}
+		for _, category := range post.Category {
+			entry.Categories = append(entry.Categories, atomCategory{Term: category.Slug, Label: category.Name})
+		}
+		doc.Entries = append(doc.Entries, entry)
+	}
+	return doc
+}
+
+func rssDocument(f feed, base string) rssFeed {
+	channel := rssChannel{
+		Title:       f.Title,
+		Link:        base + f.Link,
+		Description: f.Description,
+		AtomLink:    atomLink{Rel: "self", Type: "application/rss+xml", Href: base + f.Self},
+	}
+	if channel.Description == "" {
+		channel.Description = f.Title
+	}
+	if updated := feedUpdated(f.Posts); !updated.IsZero() {
+		channel.LastBuildDate = updated.UTC().Format(time.RFC1123Z)
+	}
+
+	for _, post := range f.Posts {
+		link := base + "/post/" + strconv.Itoa(post.ID)
+		item := rssItem{
+			Title:   post.Title,
+			Link:    link,
+			GUID:    rssGUID{IsPermaLink: true, Value: link},
+			PubDate: post.CreationTime.UTC().Format(time.RFC1123Z),
+			Creator: post.Author,
+			// Readers render the description as HTML, so the plain text post is escaped for that first.
+			Description: strings.ReplaceAll(html.EscapeString(post.Content), "\n", "<br>"),
+		}
+		for _, category := range post.Category {
+			item.Categories = append(item.Categories, category.Name)
+		}
+		channel.Items = append(channel.Items, item)
+	}
+
+	return rssFeed{
+		Version: "2.0",
+		AtomNS:  "http://www.w3.org/2005/Atom",
+		DCNS:    "http://purl.org/dc/elements/1.1/",
+		Channel: channel,
+	}
+}
@@ -0,0 +1,54 @@
+package delivery
+
+import (
+	"fmt"
+	"forum/internal/model"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestFeedChangesWithEdits(t *testing.T) {
+	server, db := newTestServer(t)
+	token := signUpVerified(t, server, db, "alice")
+	var post model.Post
+	if resp := apiCall(t, server, http.MethodPost, "/posts", token, apiPostRequest{Title: "post", Content: "first", Categories: []string{"alem"}}, &post); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create post: status %d", resp.StatusCode)
+	}
+
+	get := func(header, value string) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/feed.atom", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		resp, err := server.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	first := get("", "")
+	etag := first.Header.Get("ETag")
+	if first.StatusCode != http.StatusOK || etag == "" || first.Header.Get("Last-Modified") != "" {
+		t.Fatalf("status %d, ETag %q, Last-Modified %q; want 200 with only an ETag", first.StatusCode, etag, first.Header.Get("Last-Modified"))
+	}
+	if resp := get("If-None-Match", etag); resp.StatusCode != http.StatusNotModified {
+		t.Errorf("unchanged feed: status %d, want 304", resp.StatusCode)
+	}
+
+	edit := apiPostRequest{Title: "post", Content: "edited", Categories: []string{"alem"}}
+	if resp := apiCall(t, server, http.MethodPut, fmt.Sprintf("/posts/%d", post.ID), token, edit, nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("edit post: status %d", resp.StatusCode)
+	}
+	if resp := get("If-None-Match", etag); resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") == etag {
+		t.Errorf("edited feed: status %d, ETag %q; want 200 with a new ETag", resp.StatusCode, resp.Header.Get("ETag"))
+	}
+	// A reader going by time alone gets the edit too.
+	if resp := get("If-Modified-Since", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)); resp.StatusCode != http.StatusOK {
+		t.Errorf("edited feed since an hour from now: status %d, want 200", resp.StatusCode)
+	}
+}
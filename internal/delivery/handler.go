@@ -1,6 +1,9 @@
 package delivery
 
 import (
+	"errors"
+	"forum/internal/markdown"
+	"forum/internal/model"
 	"forum/internal/service"
 	"html/template"
 	"net/http"
@@ -13,28 +16,115 @@ type Handler struct {
 
 func NewHandler(service *service.Service) *Handler {
 	return &Handler{
-		tmpl:    template.Must(template.ParseGlob("web/template/*.html")),
+		tmpl:    template.Must(template.New("").Funcs(templateFuncs).Funcs(template.FuncMap{"imageURL": service.Image.ImageURL}).ParseGlob("web/template/*.html")),
 		Service: service,
 	}
 }
 
+// contentCache holds the rendered Markdown of posts and comments shown recently.
+var contentCache = markdown.NewCache(1024)
+
+var templateFuncs = template.FuncMap{
+	"slugs":    model.CategorySlugs,
+	"markdown": contentCache.Render,
+	"contains": func(list []string, value string) bool {
+		for _, item := range list {
+			if item == value {
+				return true
+			}
+		}
+		return false
+	},
+	"dict": func(values ...interface{}) (map[string]interface{}, error) {
+		if len(values)%2 != 0 {
+			return nil, errors.New("dict: odd number of arguments")
+		}
+		dict := make(map[string]interface{}, len(values)/2)
+		for i := 0; i < len(values); i += 2 {
+			key, ok := values[i].(string)
+			if !ok {
+				return nil, errors.New("dict: keys must be strings")
+			}
+			dict[key] = values[i+1]
+		}
+		return dict, nil
+	},
+}
+
 func (h *Handler) InitRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/", h.userIdentity(h.homePage))
 
 	mux.HandleFunc("/auth/signup", h.signUp)
 	mux.HandleFunc("/auth/signin", h.signIn)
 	mux.HandleFunc("/auth/logout", h.logout)
+	mux.HandleFunc("/auth/verify", h.userIdentity(h.verifyEmail))
+	mux.HandleFunc("/auth/verify/resend", h.userIdentity(h.resendVerification))
+	mux.HandleFunc("/auth/forgot", h.forgotPassword)
+	mux.HandleFunc("/auth/reset", h.resetPassword)
+	mux.HandleFunc("/auth/sessions/revoke/", h.userIdentity(h.revokeSession))
 
 	mux.HandleFunc("/post/", h.userIdentity(h.postPage))
-	mux.HandleFunc("/post/create", h.userIdentity(h.createPost))
-	mux.HandleFunc("/post/like/", h.userIdentity(h.likePost))
-	mux.HandleFunc("/post/dislike/", h.userIdentity(h.dislikePost))
+	mux.HandleFunc("/post/create", h.userIdentity(h.requirePermission(model.PermCreatePost, h.createPost)))
+	mux.HandleFunc("/post/like/", h.userIdentity(h.requirePermission(model.PermVote, h.likePost)))
+	mux.HandleFunc("/post/dislike/", h.userIdentity(h.requirePermission(model.PermVote, h.dislikePost)))
+	mux.HandleFunc("/post/edit/", h.userIdentity(h.editPost))
+	mux.HandleFunc("/post/delete/", h.userIdentity(h.deletePost))
 
-	mux.HandleFunc("/comment/like/", h.userIdentity(h.likeComment))
-	mux.HandleFunc("/comment/dislike/", h.userIdentity(h.dislikeComment))
+	mux.HandleFunc("/comment/like/", h.userIdentity(h.requirePermission(model.PermVote, h.likeComment)))
+	mux.HandleFunc("/comment/dislike/", h.userIdentity(h.requirePermission(model.PermVote, h.dislikeComment)))
+	mux.HandleFunc("/comment/edit/", h.userIdentity(h.editComment))
+	mux.HandleFunc("/comment/delete/", h.userIdentity(h.deleteComment))
 
 	mux.HandleFunc("/profile/", h.userIdentity(h.userProfile))
+	mux.HandleFunc("/profile/tokens/create", h.userIdentity(h.createAPIToken))
+	mux.HandleFunc("/profile/tokens/revoke/", h.userIdentity(h.revokeAPIToken))
+
+	mux.HandleFunc("/messages", h.userIdentity(h.inbox))
+	mux.HandleFunc("/messages/", h.userIdentity(h.conversation))
+
+	mux.HandleFunc("/chat/", h.userIdentity(h.chat))
+
+	mux.HandleFunc("/notifications", h.userIdentity(h.notifications))
+	mux.HandleFunc("/notifications/read", h.userIdentity(h.readNotifications))
+	mux.HandleFunc("/notifications/preferences", h.userIdentity(h.notificationPreferences))
+	mux.HandleFunc("/notifications/digest", h.userIdentity(h.digestSettings))
+	mux.HandleFunc("/mail/unsubscribe", h.unsubscribe)
+
+	mux.HandleFunc("/search", h.userIdentity(h.search))
+	mux.HandleFunc("/categories", h.userIdentity(h.categoriesPage))
+	mux.HandleFunc("/categories/follow", h.userIdentity(h.followCategory))
+
+	mux.HandleFunc("/feed.atom", h.forumFeed)
+	mux.HandleFunc("/feed.rss", h.forumFeed)
+	mux.HandleFunc("/category/", h.categoryFeed)
+
+	mux.HandleFunc("/images/", h.image)
+
+	mux.HandleFunc("/admin/users", h.userIdentity(h.requirePermission(model.PermManageRoles, h.adminUsers)))
+	mux.HandleFunc("/admin/users/role", h.userIdentity(h.requirePermission(model.PermManageRoles, h.setUserRole)))
+	mux.HandleFunc("/admin/categories", h.userIdentity(h.requirePermission(model.PermManageCategories, h.adminCategories)))
+	mux.HandleFunc("/admin/categories/create", h.userIdentity(h.requirePermission(model.PermManageCategories, h.createCategory)))
+	mux.HandleFunc("/admin/categories/update", h.userIdentity(h.requirePermission(model.PermManageCategories, h.updateCategory)))
+	mux.HandleFunc("/admin/categories/archive", h.userIdentity(h.requirePermission(model.PermManageCategories, h.archiveCategory)))
+
+	mux.HandleFunc(apiPrefix+"/", h.userIdentity(h.api))
+	mux.HandleFunc("/api/openapi.json", h.openAPI)
 
 	mux.Handle("/static/css/", http.StripPrefix("/static/css", http.FileServer(http.Dir("./web/static/css"))))
+	mux.Handle("/static/js/", http.StripPrefix("/static/js", http.FileServer(http.Dir("./web/static/js"))))
 	mux.Handle("/static/img/", http.StripPrefix("/static/img", http.FileServer(http.Dir("./web/static/img"))))
 }
+
+// pageLinks turns the cursors of a page into links back to the requested URL, keeping its query
+// and swapping the cursor. A missing cursor gives an empty link.
+func pageLinks(r *http.Request, page model.Page) (prev, next string) {
+	link := func(cursor string) string {
+		if cursor == "" {
+			return ""
+		}
+		query := r.URL.Query()
+		query.Set("cursor", cursor)
+		return r.URL.Path + "?" + query.Encode()
+	}
+	return link(page.Prev), link(page.Next)
+}
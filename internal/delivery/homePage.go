@@ -1,7 +1,6 @@
 package delivery
 
 import (
-	"errors"
 	"forum/internal/model"
 	"forum/internal/service"
 	"log"
@@ -9,8 +8,6 @@ import (
 )
 
 func (h *Handler) homePage(w http.ResponseWriter, r *http.Request) {
-	var posts []model.Post
-	var err error
 	if r.URL.Path != "/" {
 		// log.Printf("home page: wrong url:\n")
 		h.errorPage(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
@@ -23,31 +20,36 @@ func (h *Handler) homePage(w http.ResponseWriter, r *http.Request) {
 	}
 	user := r.Context().Value(ctxKeyUser).(model.User)
 
-	if len(r.URL.Query()) == 0 {
-		posts, err = h.Service.Post.GetAllPosts()
-		if err != nil {
-			// log.Println(err)
-			log.Printf("home page: check query len: %v \n", err)
-			h.errorPage(w, http.StatusInternalServerError, err.Error())
-			return
-		}
-	} else {
-		posts, err = h.Service.Post.GetAllPostsByFilter(user, r.URL.Query())
-		if err != nil {
-			if errors.Is(err, service.ErrUserNotFound) {
-				log.Printf("home page: get post by filter: %v \n", err)
-				h.errorPage(w, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
-				return
-			}
-			h.errorPage(w, http.StatusInternalServerError, err.Error())
-			return
-		}
+	filter, err := service.ParsePostFilter(r.URL.Query())
+	if err != nil {
+		log.Printf("home page: parse post filter: %v \n", err)
+		h.errorPage(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	posts, page, err := h.Service.Post.GetAllPosts(filter)
+	if err != nil {
+		log.Printf("home page: get all posts: %v \n", err)
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	categories, err := h.Service.Category.GetCategories()
+	if err != nil {
+		log.Printf("home page: get categories: %v \n", err)
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
 	}
 
 	info := model.Info{
-		Posts: posts,
-		User:  user,
+		Posts:               posts,
+		User:                user,
+		Filter:              filter,
+		Categories:          categories,
+		UnreadMessages:      h.unreadMessages(user),
+		UnreadNotifications: h.unreadNotifications(user),
 	}
+	info.PrevPage, info.NextPage = pageLinks(r, page)
 
 	if err := h.tmpl.ExecuteTemplate(w, "index.html", info); err != nil {
 		h.errorPage(w, http.StatusInternalServerError, err.Error())
@@ -0,0 +1,70 @@
+package delivery
+
+import (
+	"errors"
+	"forum/internal/model"
+	"forum/internal/service"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// image serves a stored image or thumbnail through a link signed by the image service. Keys are
+// hashes of the file contents, so a response never changes and can be cached until the link runs out.
+func (h *Handler) image(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	key := strings.TrimPrefix(r.URL.Path, "/images/")
+	query := r.URL.Query()
+	expires, err := h.Service.Image.VerifyImageURL(key, query.Get("expires"), query.Get("signature"))
+	if err != nil {
+		log.Println(err)
+		h.errorPage(w, http.StatusForbidden, err.Error())
+		return
+	}
+	maxAge := int(time.Until(expires).Seconds())
+
+	etag := `"` + key + `"`
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	file, contentType, err := h.Service.Image.GetImage(key)
+	if err != nil {
+		log.Println(err)
+		if errors.Is(err, service.ErrImageNotFound) {
+			h.errorPage(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+			return
+		}
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "private, max-age="+strconv.Itoa(maxAge))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("ETag", etag)
+	if r.Method == http.MethodHead {
+		return
+	}
+	if _, err := io.Copy(w, file); err != nil {
+		log.Println(err)
+	}
+}
+
+// signImageURLs fills in the links API clients download the images of a post from.
+func (h *Handler) signImageURLs(images []model.Image) {
+	for i := range images {
+		images[i].URL = h.Service.Image.ImageURL(images[i].Key)
+		images[i].ThumbURL = h.Service.Image.ImageURL(images[i].ThumbKey)
+	}
+}
@@ -0,0 +1,165 @@
+package delivery
+
+import (
+	"errors"
+	"forum/internal/model"
+	"forum/internal/service"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// unreadMessages counts the messages waiting for user, for the badge next to the inbox link. The
+// count is left out rather than failing the page when it cannot be read.
+func (h *Handler) unreadMessages(user model.User) int {
+	count, err := h.Service.Message.CountUnread(user)
+	if err != nil {
+		log.Println(err)
+		return 0
+	}
+	return count
+}
+
+// messageErrorStatus picks the status shown for errors from the message service.
+func messageErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrUserNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrPermissionDenied), errors.Is(err, service.ErrMessageBlocked):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrInvalidMessage), errors.Is(err, service.ErrMessageLen), errors.Is(err, service.ErrMessageSelf),
+		errors.Is(err, service.ErrPeerBlocked), errors.Is(err, service.ErrBlockSelf):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+func (h *Handler) inbox(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(model.User)
+	if user == (model.User{}) {
+		h.errorPage(w, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+		return
+	}
+	if r.Method != http.MethodGet {
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	conversations, err := h.Service.Message.GetConversations(user)
+	if err != nil {
+		log.Println(err)
+		h.errorPage(w, messageErrorStatus(err), err.Error())
+		return
+	}
+	blocked, err := h.Service.Message.GetBlockedUsers(user)
+	if err != nil {
+		log.Println(err)
+		h.errorPage(w, messageErrorStatus(err), err.Error())
+		return
+	}
+
+	info := model.Info{
+		User:                user,
+		Conversations:       conversations,
+		BlockedUsers:        blocked,
+		UnreadMessages:      h.unreadMessages(user),
+		UnreadNotifications: h.unreadNotifications(user),
+	}
+	if err := h.tmpl.ExecuteTemplate(w, "messages.html", info); err != nil {
+		log.Println(err)
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// conversation serves /messages/{username}: the messages exchanged with that user, sending a new
+// one, and blocking or unblocking them.
+func (h *Handler) conversation(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(model.User)
+	if user == (model.User{}) {
+		h.errorPage(w, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+		return
+	}
+
+	username, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/messages/"), "/")
+	link := "/messages/" + url.PathEscape(username)
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		h.showConversation(w, user, username)
+	case action == "" && r.Method == http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			log.Println(err)
+			h.errorPage(w, http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
+			return
+		}
+		if _, err := h.Service.Message.SendMessage(user, username, r.PostForm.Get("content")); err != nil {
+			log.Println(err)
+			h.errorPage(w, messageErrorStatus(err), err.Error())
+			return
+		}
+		http.Redirect(w, r, link, http.StatusSeeOther)
+	case (action == "block" || action == "unblock") && r.Method == http.MethodPost:
+		var err error
+		if action == "block" {
+			err = h.Service.Message.BlockUser(user, username)
+		} else {
+			err = h.Service.Message.UnblockUser(user, username)
+		}
+		if err != nil {
+			log.Println(err)
+			h.errorPage(w, messageErrorStatus(err), err.Error())
+			return
+		}
+		http.Redirect(w, r, link, http.StatusSeeOther)
+	case action == "" || action == "block" || action == "unblock":
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+	default:
+		h.errorPage(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+	}
+}
+
+func (h *Handler) showConversation(w http.ResponseWriter, user model.User, username string) {
+	peer, err := h.Service.User.GetUserByUsername(username)
+	if err != nil {
+		log.Println(err)
+		h.errorPage(w, http.StatusNotFound, service.ErrUserNotFound.Error())
+		return
+	}
+	if err := h.Service.Message.MarkRead(user, peer.Username); err != nil {
+		log.Println(err)
+		h.errorPage(w, messageErrorStatus(err), err.Error())
+		return
+	}
+	messages, err := h.Service.Message.GetMessages(user, peer.Username)
+	if err != nil {
+		log.Println(err)
+		h.errorPage(w, messageErrorStatus(err), err.Error())
+		return
+	}
+	blocked, err := h.Service.Message.IsBlocked(user, peer.Username)
+	if err != nil {
+		log.Println(err)
+		h.errorPage(w, messageErrorStatus(err), err.Error())
+		return
+	}
+	blockedBy, err := h.Service.Message.IsBlocked(peer, user.Username)
+	if err != nil {
+		log.Println(err)
+		h.errorPage(w, messageErrorStatus(err), err.Error())
+		return
+	}
+
+	info := model.Info{
+		User:                user,
+		ProfileUser:         peer,
+		Messages:            messages,
+		Blocked:             blocked,
+		CanMessage:          !blocked && !blockedBy && h.Service.Role.CheckPermission(user, model.PermMessage) == nil,
+		UnreadMessages:      h.unreadMessages(user),
+		UnreadNotifications: h.unreadNotifications(user),
+	}
+	if err := h.tmpl.ExecuteTemplate(w, "conversation.html", info); err != nil {
+		log.Println(err)
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -2,9 +2,10 @@ package delivery
 
 import (
 	"context"
-	"errors"
 	"forum/internal/model"
+	"net"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -14,31 +15,89 @@ type ctxKey int8
 
 func (h *Handler) userIdentity(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var user model.User
-		var err error
-		c, err := r.Cookie("session_token")
-		if err != nil {
-			if errors.Is(err, http.ErrNoCookie) {
-				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxKeyUser, model.User{})))
-				return
+		token, bearer := sessionToken(r)
+		if token == "" {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxKeyUser, model.User{})))
+			return
+		}
+
+		// Personal access tokens do not expire and are not tied to a session.
+		if bearer && strings.HasPrefix(token, model.APITokenPrefix) {
+			user, err := h.Service.ParseAPIToken(token)
+			if err != nil {
+				user = model.User{}
 			}
-			h.errorPage(w, http.StatusBadRequest, err.Error())
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxKeyUser, user)))
 			return
 		}
 
-		user, err = h.Service.ParseToken(c.Value)
+		user, err := h.Service.ParseToken(token)
 		if err != nil {
 			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxKeyUser, model.User{})))
 			return
 		}
 		if user.ExpirationTime.Before(time.Now()) {
-			if err := h.Service.DeleteToken(c.Value); err != nil {
+			if err := h.Service.DeleteToken(token); err != nil {
 				h.errorPage(w, http.StatusInternalServerError, err.Error())
 				return
 			}
 			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxKeyUser, model.User{})))
 			return
 		}
+
+		session, err := h.Service.RefreshSession(user, token, r.UserAgent(), clientIP(r))
+		if err != nil {
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		user.ExpirationTime = session.ExpirationTime
+		if !bearer {
+			http.SetCookie(w, &http.Cookie{
+				Name:    "session_token",
+				Value:   session.Token,
+				Expires: session.ExpirationTime,
+				Path:    "/",
+			})
+		}
+
 		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxKeyUser, user)))
 	}
 }
+
+// sessionToken returns the session token sent with the request: a bearer token from the
+// Authorization header, as API clients send it, or else the session cookie. Bearer tokens only count
+// under apiPrefix, so personal access tokens, and the scopes limiting them, stay within the API.
+func sessionToken(r *http.Request) (token string, bearer bool) {
+	header := r.Header.Get("Authorization")
+	if strings.HasPrefix(header, "Bearer ") && (r.URL.Path == apiPrefix || strings.HasPrefix(r.URL.Path, apiPrefix+"/")) {
+		return strings.TrimSpace(strings.TrimPrefix(header, "Bearer ")), true
+	}
+	c, err := r.Cookie("session_token")
+	if err != nil {
+		return "", false
+	}
+	return c.Value, false
+}
+
+func (h *Handler) requirePermission(permission model.Permission, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value(ctxKeyUser).(model.User)
+		if err := h.Service.Role.CheckPermission(user, permission); err != nil {
+			if user == (model.User{}) {
+				h.errorPage(w, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+				return
+			}
+			h.errorPage(w, http.StatusForbidden, err.Error())
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,73 @@
+package delivery
+
+import (
+	"forum/internal/model"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSessionTokenBearerOnlyForAPI(t *testing.T) {
+	tests := []struct {
+		path   string
+		token  string
+		bearer bool
+	}{
+		{apiPrefix + "/me", "bearer", true},
+		{apiPrefix, "bearer", true},
+		{"/post/create", "cookie", false},
+		{"/chat/alem/ws", "cookie", false},
+		{apiPrefix + "x/me", "cookie", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			r.Header.Set("Authorization", "Bearer bearer")
+			r.AddCookie(&http.Cookie{Name: "session_token", Value: "cookie"})
+			if token, bearer := sessionToken(r); token != tt.token || bearer != tt.bearer {
+				t.Errorf("got %q, bearer %t; want %q, bearer %t", token, bearer, tt.token, tt.bearer)
+			}
+		})
+	}
+}
+
+func TestSessionRefreshedOnlyWhenDue(t *testing.T) {
+	server, db := newTestServer(t)
+	token := signUpVerified(t, server, db, "alice")
+
+	var stored int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM session WHERE token_hash = $1;`, model.HashToken(token)).Scan(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored != 1 {
+		t.Fatalf("%d sessions stored under the hash of the token, want 1", stored)
+	}
+
+	tests := []struct {
+		name      string
+		expiresIn time.Duration
+		refreshed bool
+	}{
+		{"just extended", 12*time.Hour - time.Minute, false},
+		{"due", time.Hour, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expiration := time.Now().Add(tt.expiresIn).Truncate(time.Second)
+			if _, err := db.Exec(`UPDATE session SET expiration_time = $1;`, expiration); err != nil {
+				t.Fatal(err)
+			}
+			if resp := apiCall(t, server, http.MethodGet, "/me", token, nil, nil); resp.StatusCode != http.StatusOK {
+				t.Fatalf("status %d", resp.StatusCode)
+			}
+			var after time.Time
+			if err := db.QueryRow(`SELECT expiration_time FROM session;`).Scan(&after); err != nil {
+				t.Fatal(err)
+			}
+			if refreshed := !after.Equal(expiration); refreshed != tt.refreshed {
+				t.Errorf("expiration went from %v to %v, want refreshed %t", expiration, after, tt.refreshed)
+			}
+		})
+	}
+}
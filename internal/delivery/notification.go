@@ -0,0 +1,121 @@
+package delivery
+
+import (
+	"errors"
+	"forum/internal/model"
+	"forum/internal/service"
+	"log"
+	"net/http"
+)
+
+// unreadNotifications counts the notifications waiting for user, for the badge in the header.
+func (h *Handler) unreadNotifications(user model.User) int {
+	count, err := h.Service.Notification.CountUnread(user)
+	if err != nil {
+		log.Println(err)
+		return 0
+	}
+	return count
+}
+
+func (h *Handler) notifications(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(model.User)
+	if user == (model.User{}) {
+		h.errorPage(w, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+		return
+	}
+	if r.Method != http.MethodGet {
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	notifications, err := h.Service.Notification.GetNotifications(user)
+	if err != nil {
+		log.Println(err)
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	preferences, err := h.Service.Notification.GetPreferences(user)
+	if err != nil {
+		log.Println(err)
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	frequency, err := h.Service.Digest.GetDigestFrequency(user)
+	if err != nil {
+		log.Println(err)
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	followed, err := h.Service.Digest.GetFollowedCategories(user)
+	if err != nil {
+		log.Println(err)
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	info := model.Info{
+		User:                user,
+		Notifications:       notifications,
+		NotificationPrefs:   preferences,
+		DigestFrequency:     frequency,
+		Categories:          followed,
+		UnreadMessages:      h.unreadMessages(user),
+		UnreadNotifications: h.unreadNotifications(user),
+	}
+	if err := h.tmpl.ExecuteTemplate(w, "notifications.html", info); err != nil {
+		log.Println(err)
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (h *Handler) readNotifications(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(model.User)
+	if user == (model.User{}) {
+		h.errorPage(w, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+		return
+	}
+	if r.Method != http.MethodPost {
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	if err := h.Service.Notification.MarkAllRead(user); err != nil {
+		log.Println(err)
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	http.Redirect(w, r, "/notifications", http.StatusSeeOther)
+}
+
+func (h *Handler) notificationPreferences(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(model.User)
+	if user == (model.User{}) {
+		h.errorPage(w, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+		return
+	}
+	if r.Method != http.MethodPost {
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		log.Println(err)
+		h.errorPage(w, http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
+		return
+	}
+
+	var enabled []model.NotificationKind
+	for _, kind := range r.PostForm["kind"] {
+		enabled = append(enabled, model.NotificationKind(kind))
+	}
+	if err := h.Service.Notification.UpdatePreferences(user, enabled); err != nil {
+		log.Println(err)
+		if errors.Is(err, service.ErrInvalidNotificationKind) {
+			h.errorPage(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	http.Redirect(w, r, "/notifications", http.StatusSeeOther)
+}
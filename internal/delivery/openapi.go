@@ -0,0 +1,242 @@
+package delivery
+
+import (
+	"encoding"
+	"log"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+var (
+	openAPIOnce     sync.Once
+	openAPIDocument map[string]interface{}
+)
+
+func (h *Handler) openAPI(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/api/openapi.json" {
+		h.apiError(w, errAPINotFound)
+		return
+	}
+	if r.Method != http.MethodGet {
+		log.Println("OpenAPI: Method not allowed")
+		w.Header().Set("Allow", http.MethodGet)
+		h.apiError(w, errAPIMethodNotAllowed)
+		return
+	}
+
+	openAPIOnce.Do(func() {
+		openAPIDocument = buildOpenAPI(apiRoutes)
+	})
+	writeJSON(w, http.StatusOK, openAPIDocument)
+}
+
+// buildOpenAPI describes routes as an OpenAPI 3 document. Body schemas are derived from the Go
+// types by reflection, following their json tags, so the document cannot drift from the handlers.
+func buildOpenAPI(routes []apiRoute) map[string]interface{} {
+	schemas := make(map[string]interface{})
+	paths := make(map[string]interface{})
+
+	errorResponse := map[string]interface{}{
+		"description": "Error",
+		"content":     jsonContent(openAPISchema(reflect.TypeOf(apiErrorResponse{}), schemas)),
+	}
+
+	for _, route := range routes {
+		path := apiPrefix + route.Pattern
+		item, ok := paths[path].(map[string]interface{})
+		if !ok {
+			item = make(map[string]interface{})
+			paths[path] = item
+		}
+
+		var parameters []interface{}
+		for _, segment := range strings.Split(route.Pattern, "/") {
+			if !strings.HasPrefix(segment, "{") {
+				continue
+			}
+			name := strings.Trim(segment, "{}")
+			schema := map[string]interface{}{"type": "string"}
+			if name == "id" {
+				schema = map[string]interface{}{"type": "integer"}
+			}
+			parameters = append(parameters, map[string]interface{}{"name": name, "in": "path", "required": true, "schema": schema})
+		}
+		for _, name := range route.Query {
+			parameters = append(parameters, map[string]interface{}{"name": name, "in": "query", "schema": map[string]interface{}{"type": "string"}})
+		}
+
+		success := map[string]interface{}{"description": http.StatusText(route.Status)}
+		if route.Response != nil {
+			success["content"] = jsonContent(openAPISchema(reflect.TypeOf(route.Response), schemas))
+		}
+
+		operation := map[string]interface{}{
+			"summary": route.Summary,
+			"responses": map[string]interface{}{
+				strconv.Itoa(route.Status): success,
+				"default":                  errorResponse,
+			},
+		}
+		if len(parameters) != 0 {
+			operation["parameters"] = parameters
+		}
+		if route.Request != nil {
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content":  jsonContent(openAPISchema(reflect.TypeOf(route.Request), schemas)),
+			}
+		}
+		if route.Auth || route.Permission != 0 {
+			operation["security"] = []interface{}{map[string]interface{}{"bearerAuth": []string{}}}
+		}
+		item[strings.ToLower(route.Method)] = operation
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "Forum API",
+			"version": "1.0.0",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]interface{}{"type": "http", "scheme": "bearer"},
+			},
+		},
+	}
+}
+
+func jsonContent(schema map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}}
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// openAPISchema returns the schema of t as encoding/json would write it. Named structs are added
+// to schemas once and referred to by name.
+func openAPISchema(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t.Implements(textMarshalerType):
+		return map[string]interface{}{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		schema := openAPISchema(t.Elem(), schemas)
+		if _, ok := schema["$ref"]; ok {
+			return map[string]interface{}{"allOf": []interface{}{schema}, "nullable": true}
+		}
+		schema["nullable"] = true
+		return schema
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": openAPISchema(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": openAPISchema(t.Elem(), schemas)}
+	case reflect.Struct:
+		name := openAPISchemaName(t)
+		ref := map[string]interface{}{"$ref": "#/components/schemas/" + name}
+		if _, ok := schemas[name]; ok {
+			return ref
+		}
+		// Claim the name before walking the fields so self-referencing types, such as comment
+		// replies, point back at it instead of recursing forever.
+		schemas[name] = nil
+
+		properties := make(map[string]interface{})
+		var required []string
+		addStructFields(t, properties, &required, schemas)
+		schema := map[string]interface{}{"type": "object", "properties": properties}
+		if len(required) != 0 {
+			schema["required"] = required
+		}
+		schemas[name] = schema
+		return ref
+	}
+	return map[string]interface{}{}
+}
+
+// addStructFields adds the json fields of t to properties. Fields of embedded structs are promoted
+// unless an outer field already took their name, as encoding/json does.
+func addStructFields(t reflect.Type, properties map[string]interface{}, required *[]string, schemas map[string]interface{}) {
+	var embedded []reflect.Type
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			embedded = append(embedded, field.Type)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = openAPISchema(field.Type, schemas)
+		if !strings.Contains(options, "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+
+	for _, inner := range embedded {
+		innerProperties := make(map[string]interface{})
+		var innerRequired []string
+		addStructFields(inner, innerProperties, &innerRequired, schemas)
+		for name, schema := range innerProperties {
+			if _, taken := properties[name]; !taken {
+				properties[name] = schema
+			}
+		}
+		for _, name := range innerRequired {
+			if !containsString(*required, name) {
+				*required = append(*required, name)
+			}
+		}
+	}
+}
+
+// openAPISchemaName names a schema after its Go type, without the api prefix of the API's own
+// request and response types.
+func openAPISchemaName(t reflect.Type) string {
+	name := strings.TrimPrefix(t.Name(), "api")
+	if name == "" {
+		return "Object"
+	}
+	runes := []rune(name)
+	runes[0] = unicode.ToUpper(runes[0])
+	return string(runes)
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+package delivery
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type openAPITestOperation struct {
+	Parameters []struct {
+		Name string `json:"name"`
+		In   string `json:"in"`
+	} `json:"parameters"`
+	RequestBody json.RawMessage            `json:"requestBody"`
+	Responses   map[string]json.RawMessage `json:"responses"`
+	Security    json.RawMessage            `json:"security"`
+}
+
+// TestOpenAPIMatchesRoutes checks the served document describes exactly the operations the API
+// dispatches, with their path parameters, bodies, statuses and sign-in requirement.
+func TestOpenAPIMatchesRoutes(t *testing.T) {
+	server, _ := newTestServer(t)
+	resp, err := server.Client().Get(server.URL + "/api/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+	var document struct {
+		Paths map[string]map[string]openAPITestOperation `json:"paths"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&document); err != nil {
+		t.Fatal(err)
+	}
+
+	documented := make(map[string]openAPITestOperation)
+	for path, item := range document.Paths {
+		for method, operation := range item {
+			documented[strings.ToUpper(method)+" "+path] = operation
+		}
+	}
+
+	routed := make(map[string]bool)
+	for _, route := range apiRoutes {
+		key := route.Method + " " + apiPrefix + route.Pattern
+		if routed[key] {
+			t.Errorf("%s is routed twice", key)
+		}
+		routed[key] = true
+
+		operation, ok := documented[key]
+		if !ok {
+			t.Errorf("%s is routed but not documented", key)
+			continue
+		}
+		if _, ok := operation.Responses[strconv.Itoa(route.Status)]; !ok {
+			t.Errorf("%s: status %d is not documented", key, route.Status)
+		}
+		if (route.Request != nil) != (operation.RequestBody != nil) {
+			t.Errorf("%s: request body documented %t, want %t", key, operation.RequestBody != nil, route.Request != nil)
+		}
+		if signIn := route.Auth || route.Permission != 0; signIn != (operation.Security != nil) {
+			t.Errorf("%s: security documented %t, want %t", key, operation.Security != nil, signIn)
+		}
+
+		var want, got []string
+		for _, segment := range strings.Split(route.Pattern, "/") {
+			if strings.HasPrefix(segment, "{") {
+				want = append(want, "path "+strings.Trim(segment, "{}"))
+			}
+		}
+		for _, name := range route.Query {
+			want = append(want, "query "+name)
+		}
+		for _, parameter := range operation.Parameters {
+			got = append(got, parameter.In+" "+parameter.Name)
+		}
+		sort.Strings(want)
+		sort.Strings(got)
+		if strings.Join(want, ", ") != strings.Join(got, ", ") {
+			t.Errorf("%s: parameters %v, want %v", key, got, want)
+		}
+	}
+
+	for key := range documented {
+		if !routed[key] {
+			t.Errorf("%s is documented but not routed", key)
+		}
+	}
+}
+
+// TestAPIRoutesReachable checks no route is shadowed by an earlier one matching the same requests.
+func TestAPIRoutesReachable(t *testing.T) {
+	for i, route := range apiRoutes {
+		path := route.Pattern
+		for _, segment := range strings.Split(route.Pattern, "/") {
+			if strings.HasPrefix(segment, "{") {
+				path = strings.Replace(path, segment, "1", 1)
+			}
+		}
+		for j, other := range apiRoutes[:i] {
+			if _, ok := matchAPIPattern(other.Pattern, path); ok && other.Method == route.Method {
+				t.Errorf("%s %s is shadowed by route %d, %s", route.Method, route.Pattern, j, other.Pattern)
+			}
+		}
+	}
+}
@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"forum/internal/model"
 	"forum/internal/service"
+	"io"
 	"log"
+	"mime/multipart"
 	"net/http"
 	"strconv"
 	"strings"
@@ -15,13 +17,17 @@ import (
 func (h *Handler) postPage(w http.ResponseWriter, r *http.Request) {
 	user := r.Context().Value(ctxKeyUser).(model.User)
 
-	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/post/"))
-	if err != nil {
+	postId, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/post/"), "/")
+	id, err := strconv.Atoi(postId)
+	if err != nil || action != "" && action != "events" {
 		log.Println("Post not found")
 		h.errorPage(w, http.StatusBadRequest, "post not found")
 		return
 	}
 
+	// Taken before reading the post, so the event stream of the page repeats rather than misses what
+	// happens meanwhile.
+	lastEventId := h.Service.Events.LastID()
 	post, err := h.Service.Post.GetPostByID(id)
 	if err != nil {
 		log.Println(err)
@@ -32,12 +38,20 @@ func (h *Handler) postPage(w http.ResponseWriter, r *http.Request) {
 		h.errorPage(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	if action == "events" {
+		h.postEvents(w, r, post.ID)
+		return
+	}
 
 	switch r.Method {
 	case http.MethodGet:
-		comments, err := h.Service.GetCommentariesByPostID(post.ID)
+		comments, page, err := h.Service.GetCommentariesByPostID(post.ID, r.URL.Query().Get("cursor"))
 		if err != nil {
 			log.Println(err)
+			if errors.Is(err, service.ErrInvalidQuery) {
+				h.errorPage(w, http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
+				return
+			}
 			h.errorPage(w, http.StatusInternalServerError, err.Error())
 			return
 		}
@@ -65,15 +79,31 @@ func (h *Handler) postPage(w http.ResponseWriter, r *http.Request) {
 			h.errorPage(w, http.StatusInternalServerError, err.Error())
 			return
 		}
+		revisions, err := h.Service.Post.GetPostRevisions(post)
+		if err != nil {
+			log.Println(err)
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+			return
+		}
 		info := model.Info{
-			Post:             post,
-			PostLikes:        postLikes,
-			PostDislikes:     postDisikes,
-			User:             user,
-			Commentaries:     comments,
-			CommentsLikes:    commentsLikes,
-			CommentsDislikes: commentsDislikes,
+			Post:                post,
+			PostLikes:           postLikes,
+			PostDislikes:        postDisikes,
+			User:                user,
+			Commentaries:        comments,
+			CommentsLikes:       commentsLikes,
+			CommentsDislikes:    commentsDislikes,
+			Revisions:           revisions,
+			CanEditPost:         h.Service.Role.CanModify(user, post.Author, model.PermCreatePost, model.PermEditAnyPost),
+			CanDeletePost:       h.Service.Role.CanModify(user, post.Author, model.PermCreatePost, model.PermDeleteAnyPost),
+			CanComment:          h.Service.Role.CheckPermission(user, model.PermComment) == nil,
+			CanEditAnyComment:   h.Service.Role.CheckPermission(user, model.PermEditAnyComment) == nil,
+			CanDeleteAnyComment: h.Service.Role.CheckPermission(user, model.PermDeleteAnyComment) == nil,
+			UnreadMessages:      h.unreadMessages(user),
+			UnreadNotifications: h.unreadNotifications(user),
+			LastEventID:         lastEventId,
 		}
+		info.PrevPage, info.NextPage = pageLinks(r, page)
 		if err := h.tmpl.ExecuteTemplate(w, "post.html", info); err != nil {
 			log.Printf("Post page: Executing %v", err)
 			h.errorPage(w, http.StatusInternalServerError, err.Error())
@@ -84,6 +114,12 @@ func (h *Handler) postPage(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		if err := h.Service.Role.CheckPermission(user, model.PermComment); err != nil {
+			log.Println(err)
+			h.errorPage(w, http.StatusForbidden, err.Error())
+			return
+		}
+
 		if err := r.ParseForm(); err != nil {
 			log.Printf("Post page: Parse Form: %v", err)
 			h.errorPage(w, http.StatusInternalServerError, err.Error())
@@ -103,10 +139,20 @@ func (h *Handler) postPage(w http.ResponseWriter, r *http.Request) {
 			Content: comment[0],
 		}
 
-		if err := h.Service.Commentary.CreateCommentary(newComment); err != nil {
+		if parent, ok := r.Form["parent"]; ok && parent[0] != "" {
+			newComment.ParentID, err = strconv.Atoi(parent[0])
+			if err != nil {
+				log.Printf("Post page: Parse Form: parent: %v", err)
+				h.errorPage(w, http.StatusBadRequest, service.ErrInvalidParent.Error())
+				return
+			}
+		}
+
+		if _, err := h.Service.Commentary.CreateCommentary(newComment); err != nil {
 			log.Println(err)
 			if errors.Is(err, service.ErrInvalidComment) ||
-				errors.Is(err, service.ErrCommentLen) || errors.Is(err, service.ErrInvalidCommentChar) {
+				errors.Is(err, service.ErrCommentLen) || errors.Is(err, service.ErrInvalidCommentChar) ||
+				errors.Is(err, service.ErrInvalidParent) {
 				h.errorPage(w, http.StatusBadRequest, err.Error())
 				return
 			}
@@ -123,11 +169,6 @@ func (h *Handler) postPage(w http.ResponseWriter, r *http.Request) {
 
 func (h *Handler) createPost(w http.ResponseWriter, r *http.Request) {
 	user := r.Context().Value(ctxKeyUser).(model.User)
-	if user == (model.User{}) {
-		h.errorPage(w, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
-		return
-	}
-
 	if r.URL.Path != "/post/create" {
 		h.errorPage(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
 		return
@@ -135,17 +176,28 @@ func (h *Handler) createPost(w http.ResponseWriter, r *http.Request) {
 
 	switch r.Method {
 	case http.MethodGet:
+		categories, err := h.Service.Category.GetCategories()
+		if err != nil {
+			log.Println(err)
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
 		info := model.Info{
-			User: user,
+			User:                user,
+			Categories:          categories,
+			UnreadMessages:      h.unreadMessages(user),
+			UnreadNotifications: h.unreadNotifications(user),
 		}
 
 		if err := h.tmpl.ExecuteTemplate(w, "create_post.html", info); err != nil {
 			h.errorPage(w, http.StatusInternalServerError, err.Error())
 		}
 	case http.MethodPost:
-		if err := r.ParseForm(); err != nil {
+		r.Body = http.MaxBytesReader(w, r.Body, h.Service.Image.UploadLimit())
+		if err := r.ParseMultipartForm(32 << 20); err != nil && !errors.Is(err, http.ErrNotMultipart) {
 			log.Println(err)
-			h.errorPage(w, http.StatusInternalServerError, err.Error())
+			h.errorPage(w, http.StatusBadRequest, err.Error())
 			return
 		}
 
@@ -173,12 +225,22 @@ func (h *Handler) createPost(w http.ResponseWriter, r *http.Request) {
 			Title:    title[0],
 			Content:  content[0],
 			Author:   user.Username,
-			Category: category,
+			Category: formCategories(category),
 		}
 
-		if err := h.Service.Post.CreatePost(post); err != nil {
+		images, closeImages, err := formImages(r)
+		if err != nil {
 			log.Println(err)
-			if errors.Is(err, service.ErrInvalidPostContent) || errors.Is(err, service.ErrInvalidPostTitle) || errors.Is(err, service.ErrPostContentLen) || errors.Is(err, service.ErrPostTitleLen) {
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		defer closeImages()
+
+		if _, err := h.Service.Post.CreatePost(post, images); err != nil {
+			log.Println(err)
+			if errors.Is(err, service.ErrInvalidPostContent) || errors.Is(err, service.ErrInvalidPostTitle) || errors.Is(err, service.ErrPostContentLen) || errors.Is(err, service.ErrPostTitleLen) ||
+				errors.Is(err, service.ErrInvalidCategory) || errors.Is(err, service.ErrInvalidImage) || errors.Is(err, service.ErrImageTooLarge) ||
+				errors.Is(err, service.ErrImageDimensions) || errors.Is(err, service.ErrTooManyImages) {
 				h.errorPage(w, http.StatusBadRequest, err.Error())
 				return
 			}
@@ -191,12 +253,37 @@ func (h *Handler) createPost(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// formImages opens the images attached to a post form, to be read once the post is created. File
+// inputs left empty are skipped. The returned function closes the files again.
+func formImages(r *http.Request) ([]io.Reader, func(), error) {
+	var files []multipart.File
+	closeFiles := func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}
+	if r.MultipartForm == nil {
+		return nil, closeFiles, nil
+	}
+
+	var images []io.Reader
+	for _, header := range r.MultipartForm.File["images"] {
+		if header.Size == 0 {
+			continue
+		}
+		file, err := header.Open()
+		if err != nil {
+			closeFiles()
+			return nil, nil, err
+		}
+		files = append(files, file)
+		images = append(images, file)
+	}
+	return images, closeFiles, nil
+}
+
 func (h *Handler) likePost(w http.ResponseWriter, r *http.Request) {
 	user := r.Context().Value(ctxKeyUser).(model.User)
-	if user == (model.User{}) {
-		h.errorPage(w, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
-		return
-	}
 
 	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/post/like/"))
 	if err != nil {
@@ -223,11 +310,6 @@ func (h *Handler) likePost(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) dislikePost(w http.ResponseWriter, r *http.Request) {
 	user := r.Context().Value(ctxKeyUser).(model.User)
 
-	if user == (model.User{}) {
-		h.errorPage(w, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
-		return
-	}
-
 	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/post/dislike/"))
 	if err != nil {
 		log.Println(err)
@@ -249,3 +331,151 @@ func (h *Handler) dislikePost(w http.ResponseWriter, r *http.Request) {
 
 	http.Redirect(w, r, fmt.Sprintf("/post/%d", id), http.StatusSeeOther)
 }
+
+func (h *Handler) editPost(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(model.User)
+	if user == (model.User{}) {
+		h.errorPage(w, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+		return
+	}
+
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/post/edit/"))
+	if err != nil {
+		log.Println(err)
+		h.errorPage(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	post, err := h.Service.Post.GetPostByID(id)
+	if err != nil {
+		log.Println(err)
+		if errors.Is(err, sql.ErrNoRows) {
+			h.errorPage(w, http.StatusNotFound, err.Error())
+			return
+		}
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if !h.Service.Role.CanModify(user, post.Author, model.PermCreatePost, model.PermEditAnyPost) {
+		h.errorPage(w, http.StatusForbidden, service.ErrPermissionDenied.Error())
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		categories, err := h.Service.Category.GetCategories()
+		if err != nil {
+			log.Println(err)
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		info := model.Info{
+			User:                user,
+			Post:                post,
+			Categories:          categories,
+			UnreadMessages:      h.unreadMessages(user),
+			UnreadNotifications: h.unreadNotifications(user),
+		}
+
+		if err := h.tmpl.ExecuteTemplate(w, "edit_post.html", info); err != nil {
+			log.Printf("Edit Post: Execute: %v", err)
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+		}
+	case http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			log.Println(err)
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		title, ok := r.Form["title"]
+		if !ok {
+			log.Println("title field not found")
+			h.errorPage(w, http.StatusBadRequest, "title field not found")
+			return
+		}
+
+		content, ok := r.Form["content"]
+		if !ok {
+			log.Println("content field not found")
+			h.errorPage(w, http.StatusBadRequest, "content field not found")
+			return
+		}
+
+		category, ok := r.Form["categories"]
+		if !ok {
+			log.Println("category field not found")
+			h.errorPage(w, http.StatusBadRequest, "category field not found")
+			return
+		}
+
+		post.Title = title[0]
+		post.Content = content[0]
+		post.Category = formCategories(category)
+
+		if err := h.Service.Post.UpdatePost(user, post); err != nil {
+			log.Println(err)
+			if errors.Is(err, service.ErrInvalidPostContent) || errors.Is(err, service.ErrInvalidPostTitle) || errors.Is(err, service.ErrPostContentLen) || errors.Is(err, service.ErrPostTitleLen) ||
+				errors.Is(err, service.ErrInvalidCategory) {
+				h.errorPage(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			if errors.Is(err, service.ErrPermissionDenied) {
+				h.errorPage(w, http.StatusForbidden, err.Error())
+				return
+			}
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		http.Redirect(w, r, fmt.Sprintf("/post/%d", post.ID), http.StatusSeeOther)
+	default:
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+	}
+}
+
+func (h *Handler) deletePost(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(model.User)
+	if user == (model.User{}) {
+		h.errorPage(w, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+		return
+	}
+
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/post/delete/"))
+	if err != nil {
+		log.Println(err)
+		h.errorPage(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		log.Println("Method not allowed delete post")
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	if err := h.Service.Post.DeletePost(user, id); err != nil {
+		log.Println(err)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			h.errorPage(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, service.ErrPermissionDenied):
+			h.errorPage(w, http.StatusForbidden, err.Error())
+		default:
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// formCategories turns the category slugs submitted with a post form into categories.
+func formCategories(slugs []string) []model.Category {
+	categories := make([]model.Category, len(slugs))
+	for i, slug := range slugs {
+		categories[i] = model.Category{Slug: slug}
+	}
+	return categories
+}
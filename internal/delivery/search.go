@@ -0,0 +1,44 @@
+package delivery
+
+import (
+	"errors"
+	"forum/internal/model"
+	"forum/internal/service"
+	"log"
+	"net/http"
+)
+
+func (h *Handler) search(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(model.User)
+	if r.URL.Path != "/search" {
+		h.errorPage(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		log.Println("Search: Method not allowed")
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	query := r.URL.Query().Get("q")
+	results, err := h.Service.Post.Search(query)
+	if err != nil && !errors.Is(err, service.ErrInvalidSearch) {
+		log.Printf("Search: %v", err)
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	info := model.Info{
+		User:                user,
+		Query:               query,
+		SearchResults:       results,
+		UnreadMessages:      h.unreadMessages(user),
+		UnreadNotifications: h.unreadNotifications(user),
+	}
+
+	if err := h.tmpl.ExecuteTemplate(w, "search.html", info); err != nil {
+		log.Printf("Search: Execute: %v", err)
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+	}
+}
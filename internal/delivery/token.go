@@ -0,0 +1,104 @@
+package delivery
+
+import (
+	"errors"
+	"forum/internal/model"
+	"forum/internal/service"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+func (h *Handler) createAPIToken(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(model.User)
+	if user == (model.User{}) {
+		h.errorPage(w, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		log.Println("Create API Token: Method not allowed")
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		log.Println(err)
+		h.errorPage(w, http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
+		return
+	}
+
+	var scopes model.Scope
+	for _, name := range r.PostForm["scope"] {
+		scope, ok := model.ParseScope(name)
+		if !ok {
+			h.errorPage(w, http.StatusBadRequest, service.ErrInvalidScope.Error())
+			return
+		}
+		scopes |= scope
+	}
+
+	token, err := h.Service.APIToken.CreateAPIToken(user, r.PostForm.Get("name"), scopes)
+	if err != nil {
+		log.Printf("Create API Token: %v", err)
+		switch {
+		case errors.Is(err, service.ErrPermissionDenied):
+			h.errorPage(w, http.StatusForbidden, err.Error())
+		case errors.Is(err, service.ErrInvalidTokenName), errors.Is(err, service.ErrInvalidScope):
+			h.errorPage(w, http.StatusBadRequest, err.Error())
+		default:
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	// The token is shown once, here, and never again.
+	w.Header().Set("Cache-Control", "no-store")
+	info := model.Info{
+		User:                user,
+		NewAPIToken:         token,
+		UnreadMessages:      h.unreadMessages(user),
+		UnreadNotifications: h.unreadNotifications(user),
+	}
+	if err := h.tmpl.ExecuteTemplate(w, "api_token.html", info); err != nil {
+		log.Println(err)
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (h *Handler) revokeAPIToken(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(model.User)
+	if user == (model.User{}) {
+		h.errorPage(w, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		log.Println("Revoke API Token: Method not allowed")
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/profile/tokens/revoke/"))
+	if err != nil {
+		log.Println(err)
+		h.errorPage(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	if err := h.Service.APIToken.RevokeAPIToken(user, id); err != nil {
+		log.Printf("Revoke API Token: %v", err)
+		switch {
+		case errors.Is(err, service.ErrTokenNotFound):
+			h.errorPage(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, service.ErrPermissionDenied):
+			h.errorPage(w, http.StatusForbidden, err.Error())
+		default:
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	http.Redirect(w, r, "/profile/"+user.Username+"?posts=created", http.StatusSeeOther)
+}
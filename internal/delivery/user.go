@@ -12,6 +12,10 @@ import (
 func (h *Handler) userProfile(w http.ResponseWriter, r *http.Request) {
 	user := r.Context().Value(ctxKeyUser).(model.User)
 	username := strings.TrimPrefix(r.URL.Path, "/profile/")
+	if name, format, ok := strings.Cut(username, "/"); ok && (format == "feed.atom" || format == "feed.rss") {
+		h.userFeed(w, r, name)
+		return
+	}
 	userPage, err := h.Service.User.GetUserByUsername(username)
 	if err != nil {
 		log.Println(err)
@@ -24,7 +28,7 @@ func (h *Handler) userProfile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	posts, err := h.Service.User.GetPostByUsername(userPage.Username, r.URL.Query())
+	posts, page, err := h.Service.User.GetPostByUsername(userPage.Username, r.URL.Query())
 	if err != nil {
 		log.Println(err)
 		if errors.Is(err, service.ErrInvalidQuery) {
@@ -35,11 +39,34 @@ func (h *Handler) userProfile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var sessions []model.Session
+	var tokens []model.APIToken
+	if user.Username == userPage.Username {
+		sessions, err = h.Service.Auth.GetSessions(user.ID)
+		if err != nil {
+			log.Println(err)
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		tokens, err = h.Service.APIToken.GetAPITokens(user.ID)
+		if err != nil {
+			log.Println(err)
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
 	info := model.Info{
-		User:        user,
-		ProfileUser: userPage,
-		Posts:       posts,
+		User:                user,
+		ProfileUser:         userPage,
+		Posts:               posts,
+		Sessions:            sessions,
+		APITokens:           tokens,
+		Scopes:              model.Scopes(),
+		UnreadMessages:      h.unreadMessages(user),
+		UnreadNotifications: h.unreadNotifications(user),
 	}
+	info.PrevPage, info.NextPage = pageLinks(r, page)
 
 	if err := h.tmpl.ExecuteTemplate(w, "profile.html", info); err != nil {
 		log.Println(err)
@@ -0,0 +1,166 @@
+// Package event passes events between parts of the forum running in the same process, such as a
+// new comment from the service layer to the pages watching its post.
+package event
+
+import (
+	"sync"
+	"time"
+)
+
+// Event is something that happened on a topic. IDs increase across all topics, so a subscriber can
+// tell which events it has missed since the last one it saw.
+type Event struct {
+	ID    uint64
+	Topic string
+	Type  string
+	Data  interface{}
+}
+
+// Subscription receives the events of one topic on C. C is closed when the subscriber falls so far
+// behind that its buffer fills up, and the subscriber is expected to subscribe again with the ID of
+// the last event it handled.
+type Subscription struct {
+	C     <-chan Event
+	c     chan Event
+	topic string
+}
+
+// Bus delivers events to the subscribers of their topic and keeps the latest events of each topic,
+// so a subscriber coming back after a short break can catch up. Publishing never waits for a
+// subscriber.
+type Bus struct {
+	mu          sync.Mutex
+	lastID      uint64
+	historySize int
+	historyAge  time.Duration
+	bufferSize  int
+	history     map[string][]Event
+	published   map[string]time.Time
+	subscribers map[string]map[*Subscription]struct{}
+	// lastSweep is when the history of topics nobody follows was last dropped, and evictedID the
+	// latest event dropped with it.
+	lastSweep time.Time
+	evictedID uint64
+}
+
+// NewBus returns a bus keeping historySize events per topic, with a buffer of bufferSize events for
+// each subscriber. The history of a topic goes once it has no subscribers and nothing was published
+// on it for historyAge.
+func NewBus(historySize int, historyAge time.Duration, bufferSize int) *Bus {
+	return &Bus{
+		historySize: historySize,
+		historyAge:  historyAge,
+		bufferSize:  bufferSize,
+		history:     make(map[string][]Event),
+		published:   make(map[string]time.Time),
+		subscribers: make(map[string]map[*Subscription]struct{}),
+		lastSweep:   time.Now(),
+	}
+}
+
+// Publish sends an event to everyone subscribed to topic. Subscribers with a full buffer are
+// dropped rather than waited for.
+func (b *Bus) Publish(topic, eventType string, data interface{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	event := Event{ID: b.lastID, Topic: topic, Type: eventType, Data: data}
+
+	history := append(b.history[topic], event)
+	if len(history) > b.historySize {
+		history = append(history[:0:0], history[len(history)-b.historySize:]...)
+	}
+	b.history[topic] = history
+	now := time.Now()
+	b.published[topic] = now
+	if now.Sub(b.lastSweep) >= b.historyAge {
+		b.sweep(now)
+	}
+
+	for sub := range b.subscribers[topic] {
+		select {
+		case sub.c <- event:
+		default:
+			b.remove(sub)
+		}
+	}
+}
+
+// Subscribe starts receiving the events of topic. With a lastID other than zero, it also returns the
+// kept events published after lastID; complete is false when some of them are no longer kept, so the
+// subscriber cannot fully catch up.
+func (b *Bus) Subscribe(topic string, lastID uint64) (sub *Subscription, missed []Event, complete bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := make(chan Event, b.bufferSize)
+	sub = &Subscription{C: c, c: c, topic: topic}
+	if b.subscribers[topic] == nil {
+		b.subscribers[topic] = make(map[*Subscription]struct{})
+	}
+	b.subscribers[topic][sub] = struct{}{}
+
+	switch {
+	case lastID == 0 || lastID == b.lastID:
+		return sub, nil, true
+	case lastID > b.lastID:
+		// The ID comes from before a restart, which lost all events.
+		return sub, nil, false
+	}
+	// Once the history of topics was dropped, events after lastID may have gone with it.
+	kept := lastID >= b.evictedID
+	history := b.history[topic]
+	for i, event := range history {
+		if event.ID > lastID {
+			// Events between lastID and the oldest one kept may have been dropped, unless nothing
+			// ever was.
+			complete = i > 0 || kept && len(history) < b.historySize || event.ID == lastID+1
+			return sub, append([]Event(nil), history[i:]...), complete
+		}
+	}
+	return sub, nil, kept
+}
+
+// LastID returns the ID of the latest event published on any topic. A page can subscribe with it
+// later to receive everything that happened since it was rendered.
+func (b *Bus) LastID() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.lastID
+}
+
+// Unsubscribe stops sub from receiving events. It is safe to call more than once.
+func (b *Bus) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.remove(sub)
+}
+
+// sweep drops the history of the topics without subscribers that nothing was published on for
+// historyAge, so topics nobody looks at any more do not pile up.
+func (b *Bus) sweep(now time.Time) {
+	b.lastSweep = now
+	for topic, published := range b.published {
+		if len(b.subscribers[topic]) > 0 || now.Sub(published) < b.historyAge {
+			continue
+		}
+		if history := b.history[topic]; history[len(history)-1].ID > b.evictedID {
+			b.evictedID = history[len(history)-1].ID
+		}
+		delete(b.history, topic)
+		delete(b.published, topic)
+	}
+}
+
+func (b *Bus) remove(sub *Subscription) {
+	subscribers := b.subscribers[sub.topic]
+	if _, ok := subscribers[sub]; !ok {
+		return
+	}
+	delete(subscribers, sub)
+	if len(subscribers) == 0 {
+		delete(b.subscribers, sub.topic)
+	}
+	close(sub.c)
+}
@@ -0,0 +1,40 @@
+package event
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBusDropsHistoryNobodyFollows(t *testing.T) {
+	const age = 20 * time.Millisecond
+	bus := NewBus(4, age, 4)
+	bus.Publish("quiet", "comment", nil)
+	bus.Publish("quiet", "comment", nil)
+	watched, _, _ := bus.Subscribe("watched", 0)
+	defer bus.Unsubscribe(watched)
+	bus.Publish("watched", "comment", nil)
+
+	time.Sleep(2 * age)
+	bus.Publish("busy", "comment", nil)
+
+	bus.mu.Lock()
+	topics := len(bus.history)
+	_, quietKept := bus.history["quiet"]
+	bus.mu.Unlock()
+	if topics != 2 || quietKept {
+		t.Errorf("kept the history of %d topics, quiet among them: %t; want watched and busy", topics, quietKept)
+	}
+
+	// Someone who saw the first event missed the second, which is gone.
+	sub, missed, complete := bus.Subscribe("quiet", 1)
+	bus.Unsubscribe(sub)
+	if len(missed) != 0 || complete {
+		t.Errorf("catching up on quiet: %d events, complete %t; want none, incomplete", len(missed), complete)
+	}
+	// The history of the watched topic is all there.
+	sub, missed, complete = bus.Subscribe("watched", 2)
+	bus.Unsubscribe(sub)
+	if len(missed) != 1 || !complete {
+		t.Errorf("catching up on watched: %d events, complete %t; want 1, complete", len(missed), complete)
+	}
+}
@@ -0,0 +1,35 @@
+package mail
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestLogLeavesOutBody(t *testing.T) {
+	var output bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&output)
+
+	sender, err := NewLog("Forum <forum@localhost>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := Message{
+		To:      "alice@example.com",
+		Subject: "Reset your password",
+		Text:    "http://localhost:9090/auth/reset?token=secret-text",
+		HTML:    `<a href="http://localhost:9090/auth/reset?token=secret-html">Reset</a>`,
+	}
+	if err := sender.Send(message); err != nil {
+		t.Fatal(err)
+	}
+	logged := output.String()
+	if !strings.Contains(logged, message.To) || !strings.Contains(logged, message.Subject) {
+		t.Errorf("log %q, want the recipient and subject", logged)
+	}
+	if strings.Contains(logged, "secret") {
+		t.Errorf("log %q holds the token", logged)
+	}
+}
@@ -0,0 +1,144 @@
+// Package mail sends email. Messages are built here, with a plain text and an HTML version, and
+// handed to a Sender: an SMTP server, or the log while developing.
+package mail
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"forum/internal/config"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+)
+
+var ErrInvalidHeader = errors.New("mail: invalid header")
+
+// Message is an email to one recipient. Headers holds extra headers such as List-Unsubscribe.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+	Headers map[string]string
+}
+
+type Sender interface {
+	Send(message Message) error
+}
+
+// PermanentError marks a failure that sending again will not fix, such as a recipient the server
+// does not know.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// New returns the sender chosen in the configuration: "log" to only log messages, which is the
+// default, or "smtp" to deliver them through an SMTP server.
+func New(cfg *config.Config) (Sender, error) {
+	var sender Sender
+	var err error
+	switch cfg.Mail.Sender {
+	case "", "log":
+		sender, err = NewLog(cfg.Mail.From)
+	case "smtp":
+		sender, err = NewSMTP(cfg.Mail.Host, cfg.Mail.Port, cfg.Mail.Username, cfg.Mail.Password, cfg.Mail.From)
+	default:
+		err = fmt.Errorf("mail: unknown sender %q", cfg.Mail.Sender)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return sender, nil
+}
+
+// build writes message as a MIME email from from, with a text and an HTML alternative.
+func build(from *mail.Address, message Message, now time.Time) ([]byte, error) {
+	to, err := mail.ParseAddress(message.To)
+	if err != nil {
+		return nil, fmt.Errorf("mail: recipient: %w", err)
+	}
+
+	headers := map[string]string{
+		"From":         from.String(),
+		"To":           to.String(),
+		"Subject":      mime.QEncoding.Encode("utf-8", message.Subject),
+		"Date":         now.Format(time.RFC1123Z),
+		"Message-ID":   messageID(from),
+		"MIME-Version": "1.0",
+	}
+	for name, value := range message.Headers {
+		headers[textproto.CanonicalMIMEHeaderKey(name)] = value
+	}
+	names := make([]string, 0, len(headers))
+	for name, value := range headers {
+		if strings.ContainsAny(name, "\r\n: ") || strings.ContainsAny(value, "\r\n") {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidHeader, name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", message.Text},
+		{"text/html; charset=utf-8", message.HTML},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQuotedPrintable(w, part.content); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+
+	var email bytes.Buffer
+	for _, name := range names {
+		fmt.Fprintf(&email, "%s: %s\r\n", name, headers[name])
+	}
+	fmt.Fprintf(&email, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", parts.Boundary())
+	email.Write(body.Bytes())
+	return email.Bytes(), nil
+}
+
+func writeQuotedPrintable(w io.Writer, content string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := io.WriteString(qp, content); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+func messageID(from *mail.Address) string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	domain := "localhost"
+	if at := strings.LastIndex(from.Address, "@"); at >= 0 {
+		domain = from.Address[at+1:]
+	}
+	return "<" + hex.EncodeToString(id) + "@" + domain + ">"
+}
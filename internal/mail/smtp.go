@@ -0,0 +1,102 @@
+package mail
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"time"
+)
+
+// smtpTimeout bounds a whole exchange with the SMTP server.
+const smtpTimeout = 30 * time.Second
+
+// SMTP delivers messages through an SMTP server, upgrading the connection with STARTTLS whenever the
+// server offers it. Credentials are only sent over TLS, or to a server on localhost.
+type SMTP struct {
+	addr     string
+	host     string
+	username string
+	password string
+	from     *mail.Address
+}
+
+func NewSMTP(host string, port int, username, password, from string) (*SMTP, error) {
+	if host == "" || port <= 0 {
+		return nil, errors.New("mail: smtp: host and port are required")
+	}
+	address, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("mail: smtp: from: %w", err)
+	}
+	return &SMTP{
+		addr:     net.JoinHostPort(host, strconv.Itoa(port)),
+		host:     host,
+		username: username,
+		password: password,
+		from:     address,
+	}, nil
+}
+
+func (s *SMTP) Send(message Message) error {
+	email, err := build(s.from, message, time.Now())
+	if err != nil {
+		return &PermanentError{Err: err}
+	}
+	to, _ := mail.ParseAddress(message.To)
+
+	conn, err := net.DialTimeout("tcp", s.addr, smtpTimeout)
+	if err != nil {
+		return fmt.Errorf("mail: smtp: %w", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(smtpTimeout))
+
+	client, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		return fmt.Errorf("mail: smtp: %w", err)
+	}
+	defer client.Close()
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: s.host}); err != nil {
+			return fmt.Errorf("mail: smtp: starttls: %w", err)
+		}
+	}
+	if s.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.username, s.password, s.host)); err != nil {
+			return smtpError("auth", err)
+		}
+	}
+
+	if err := client.Mail(s.from.Address); err != nil {
+		return smtpError("mail from", err)
+	}
+	if err := client.Rcpt(to.Address); err != nil {
+		return smtpError("rcpt to", err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return smtpError("data", err)
+	}
+	if _, err := w.Write(email); err != nil {
+		return smtpError("data", err)
+	}
+	if err := w.Close(); err != nil {
+		return smtpError("data", err)
+	}
+	return client.Quit()
+}
+
+// smtpError wraps an error of an SMTP command, marking replies in the 5xx range as permanent.
+func smtpError(command string, err error) error {
+	err = fmt.Errorf("mail: smtp: %s: %w", command, err)
+	var reply *textproto.Error
+	if errors.As(err, &reply) && reply.Code >= 500 {
+		return &PermanentError{Err: err}
+	}
+	return err
+}
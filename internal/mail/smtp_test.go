@@ -0,0 +1,205 @@
+package mail
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeSMTP is an SMTP server that accepts every message, unless replies sets another answer for a
+// command, and records what it was sent.
+type fakeSMTP struct {
+	listener net.Listener
+	replies  map[string]string
+
+	mu       sync.Mutex
+	commands []string
+	data     string
+}
+
+func newFakeSMTP(t *testing.T, replies map[string]string) *fakeSMTP {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &fakeSMTP{listener: listener, replies: replies}
+	t.Cleanup(func() { listener.Close() })
+	go server.serve()
+	return server
+}
+
+func (f *fakeSMTP) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		f.handle(conn)
+	}
+}
+
+func (f *fakeSMTP) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) {
+		conn.Write([]byte(line + "\r\n"))
+	}
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		command, _, _ := strings.Cut(line, " ")
+		command = strings.ToUpper(command)
+		f.mu.Lock()
+		f.commands = append(f.commands, line)
+		f.mu.Unlock()
+
+		if answer, ok := f.replies[command]; ok {
+			reply(answer)
+			continue
+		}
+		switch command {
+		case "EHLO":
+			reply("250 localhost")
+		case "DATA":
+			reply("354 end with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(line, "."))
+			}
+			f.mu.Lock()
+			f.data = data.String()
+			f.mu.Unlock()
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func (f *fakeSMTP) sender(t *testing.T) *SMTP {
+	t.Helper()
+	host, port, _ := net.SplitHostPort(f.listener.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+	sender, err := NewSMTP(host, portNumber, "", "", "Forum <forum@example.com>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sender
+}
+
+func (f *fakeSMTP) recorded() ([]string, string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.commands, f.data
+}
+
+func testMessage() Message {
+	return Message{
+		To:      "Bob <bob@example.com>",
+		Subject: "New replies",
+		Text:    "Hello Bob",
+		HTML:    "<p>Hello Bob</p>",
+		Headers: map[string]string{"List-Unsubscribe": "<https://forum.example.com/mail/unsubscribe?token=abc>"},
+	}
+}
+
+func TestSMTPSend(t *testing.T) {
+	server := newFakeSMTP(t, nil)
+	if err := server.sender(t).Send(testMessage()); err != nil {
+		t.Fatal(err)
+	}
+
+	commands, data := server.recorded()
+	want := []string{"EHLO", "MAIL FROM:<forum@example.com>", "RCPT TO:<bob@example.com>", "DATA", "QUIT"}
+	if len(commands) != len(want) {
+		t.Fatalf("commands %q, want %q", commands, want)
+	}
+	for i, command := range commands {
+		if !strings.HasPrefix(command, want[i]) {
+			t.Errorf("command %d is %q, want %q", i, command, want[i])
+		}
+	}
+	if commands[1] != want[1] || commands[2] != want[2] {
+		t.Errorf("envelope %q, %q, want %q, %q", commands[1], commands[2], want[1], want[2])
+	}
+
+	for _, part := range []string{
+		"From: \"Forum\" <forum@example.com>\r\n",
+		"To: \"Bob\" <bob@example.com>\r\n",
+		"Subject: New replies\r\n",
+		"List-Unsubscribe: <https://forum.example.com/mail/unsubscribe?token=abc>\r\n",
+		"Content-Type: text/plain",
+		"Hello Bob",
+		"Content-Type: text/html",
+		"<p>Hello Bob</p>",
+	} {
+		if !strings.Contains(data, part) {
+			t.Errorf("message lacks %q:\n%s", part, data)
+		}
+	}
+}
+
+func TestSMTPSendRefused(t *testing.T) {
+	tests := []struct {
+		name      string
+		replies   map[string]string
+		permanent bool
+	}{
+		{"unknown recipient", map[string]string{"RCPT": "550 5.1.1 no such user"}, true},
+		{"sender refused", map[string]string{"MAIL": "553 5.7.1 sender not allowed"}, true},
+		{"message rejected", map[string]string{"DATA": "554 5.6.0 message refused"}, true},
+		{"mailbox busy", map[string]string{"RCPT": "450 4.2.1 try again later"}, false},
+		{"server busy", map[string]string{"MAIL": "421 4.3.2 closing"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeSMTP(t, tt.replies)
+			err := server.sender(t).Send(testMessage())
+			if err == nil {
+				t.Fatal("sent despite the refusal")
+			}
+			var permanent *PermanentError
+			if errors.As(err, &permanent) != tt.permanent {
+				t.Errorf("%v: permanent %t, want %t", err, !tt.permanent, tt.permanent)
+			}
+		})
+	}
+}
+
+func TestSMTPSendUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().(*net.TCPAddr)
+	listener.Close()
+
+	sender, err := NewSMTP("127.0.0.1", addr.Port, "", "", "forum@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sender.Send(testMessage())
+	var permanent *PermanentError
+	if err == nil || errors.As(err, &permanent) {
+		t.Errorf("%v, want an error worth retrying", err)
+	}
+}
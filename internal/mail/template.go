@@ -0,0 +1,40 @@
+package mail
+
+import (
+	"bytes"
+	htmltemplate "html/template"
+	"path/filepath"
+	texttemplate "text/template"
+)
+
+// Templates renders the bodies of messages from a pair of templates of the same name, such as
+// digest.txt for the text and digest.html for the HTML version.
+type Templates struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+// ParseTemplates reads the *.txt and *.html templates of dir.
+func ParseTemplates(dir string) (*Templates, error) {
+	text, err := texttemplate.ParseGlob(filepath.Join(dir, "*.txt"))
+	if err != nil {
+		return nil, err
+	}
+	html, err := htmltemplate.ParseGlob(filepath.Join(dir, "*.html"))
+	if err != nil {
+		return nil, err
+	}
+	return &Templates{text: text, html: html}, nil
+}
+
+// Render returns the text and HTML bodies of the message named name for data.
+func (t *Templates) Render(name string, data interface{}) (text, html string, err error) {
+	var textBody, htmlBody bytes.Buffer
+	if err := t.text.ExecuteTemplate(&textBody, name+".txt", data); err != nil {
+		return "", "", err
+	}
+	if err := t.html.ExecuteTemplate(&htmlBody, name+".html", data); err != nil {
+		return "", "", err
+	}
+	return textBody.String(), htmlBody.String(), nil
+}
@@ -0,0 +1,58 @@
+package markdown
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"html/template"
+	"sync"
+)
+
+// Cache keeps the HTML of recently rendered sources. Entries are keyed by a hash of the source, so
+// each revision of a post or comment gets its own entry and an edit can never serve stale HTML.
+type Cache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[[sha256.Size]byte]*list.Element
+	order   *list.List
+}
+
+type cacheEntry struct {
+	key  [sha256.Size]byte
+	html template.HTML
+}
+
+// NewCache returns a cache holding at most size rendered sources, dropping the least recently used.
+func NewCache(size int) *Cache {
+	return &Cache{
+		size:    size,
+		entries: make(map[[sha256.Size]byte]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// Render returns the HTML for source, rendering it only if it is not cached yet.
+func (c *Cache) Render(source string) template.HTML {
+	key := sha256.Sum256([]byte(source))
+
+	c.mu.Lock()
+	if element, ok := c.entries[key]; ok {
+		c.order.MoveToFront(element)
+		c.mu.Unlock()
+		return element.Value.(*cacheEntry).html
+	}
+	c.mu.Unlock()
+
+	rendered := Render(source)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; !ok {
+		c.entries[key] = c.order.PushFront(&cacheEntry{key: key, html: rendered})
+		for c.order.Len() > c.size {
+			oldest := c.order.Back()
+			c.order.Remove(oldest)
+			delete(c.entries, oldest.Value.(*cacheEntry).key)
+		}
+	}
+	return rendered
+}
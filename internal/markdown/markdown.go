@@ -0,0 +1,485 @@
+// Package markdown renders the Markdown subset the forum supports: emphasis, links, inline code,
+// fenced code blocks with a language hint, lists and block quotes. The source is parsed into a tree
+// of allowlisted elements and only that tree is written out, so no markup in the source ever
+// reaches the page as HTML.
+package markdown
+
+import (
+	"html"
+	"html/template"
+	"strconv"
+	"strings"
+)
+
+// node is an element of the rendered tree, or a text node when tag is empty.
+type node struct {
+	tag      string
+	attrs    [][2]string
+	text     string
+	children []*node
+}
+
+// allowedTags lists every element that may be written, along with the attributes it may carry.
+var allowedTags = map[string][]string{
+	"p":          nil,
+	"br":         nil,
+	"em":         nil,
+	"strong":     nil,
+	"code":       {"class"},
+	"pre":        nil,
+	"blockquote": nil,
+	"ul":         nil,
+	"ol":         {"start"},
+	"li":         nil,
+	"a":          {"href", "rel"},
+}
+
+// Render turns Markdown source into HTML.
+func Render(source string) template.HTML {
+	source = strings.ReplaceAll(source, "\r\n", "\n")
+	source = strings.ReplaceAll(source, "\t", "    ")
+
+	var b strings.Builder
+	for _, block := range parseBlocks(strings.Split(source, "\n")) {
+		block.render(&b)
+	}
+	return template.HTML(b.String())
+}
+
+func (n *node) render(b *strings.Builder) {
+	if n.tag == "" {
+		b.WriteString(html.EscapeString(n.text))
+		return
+	}
+	allowed, ok := allowedTags[n.tag]
+	if !ok {
+		for _, child := range n.children {
+			child.render(b)
+		}
+		return
+	}
+
+	b.WriteString("<" + n.tag)
+	for _, attr := range n.attrs {
+		for _, name := range allowed {
+			if attr[0] == name {
+				b.WriteString(" " + name + `="` + html.EscapeString(attr[1]) + `"`)
+				break
+			}
+		}
+	}
+	b.WriteString(">")
+	if n.tag == "br" {
+		return
+	}
+	for _, child := range n.children {
+		child.render(b)
+	}
+	b.WriteString("</" + n.tag + ">")
+}
+
+func textNode(text string) *node {
+	return &node{text: text}
+}
+
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+func isBlank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+func isFence(line string) bool {
+	return indentOf(line) < 4 && strings.HasPrefix(strings.TrimLeft(line, " "), "```")
+}
+
+func isQuote(line string) bool {
+	return indentOf(line) < 4 && strings.HasPrefix(strings.TrimLeft(line, " "), ">")
+}
+
+// listMarker reports whether line starts a list item. width is how far the item's content is
+// indented, which continuation lines must match to stay in the item.
+func listMarker(line string) (ordered bool, start, width int, ok bool) {
+	indent := indentOf(line)
+	if indent >= 4 {
+		return false, 0, 0, false
+	}
+	rest := line[indent:]
+	if len(rest) >= 2 && strings.ContainsRune("-*+", rune(rest[0])) && rest[1] == ' ' {
+		return false, 0, indent + 2, true
+	}
+
+	digits := 0
+	for digits < len(rest) && digits < 9 && rest[digits] >= '0' && rest[digits] <= '9' {
+		digits++
+	}
+	if digits == 0 || digits+1 >= len(rest) || (rest[digits] != '.' && rest[digits] != ')') || rest[digits+1] != ' ' {
+		return false, 0, 0, false
+	}
+	start, _ = strconv.Atoi(rest[:digits])
+	return true, start, indent + digits + 2, true
+}
+
+func parseBlocks(lines []string) []*node {
+	var blocks []*node
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		switch {
+		case isBlank(line):
+			i++
+		case isFence(line):
+			var block *node
+			block, i = parseCodeBlock(lines, i)
+			blocks = append(blocks, block)
+		case isQuote(line):
+			var quoted []string
+			for ; i < len(lines) && isQuote(lines[i]); i++ {
+				text := strings.TrimPrefix(strings.TrimLeft(lines[i], " "), ">")
+				quoted = append(quoted, strings.TrimPrefix(text, " "))
+			}
+			blocks = append(blocks, &node{tag: "blockquote", children: parseBlocks(quoted)})
+		default:
+			if _, _, _, ok := listMarker(line); ok {
+				var block *node
+				block, i = parseList(lines, i)
+				blocks = append(blocks, block)
+				continue
+			}
+			var block *node
+			block, i = parseParagraph(lines, i)
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
+
+// parseCodeBlock reads a fenced code block starting at lines[i]. A block left open runs to the end
+// of the text.
+func parseCodeBlock(lines []string, i int) (*node, int) {
+	code := &node{tag: "code"}
+	if language := codeLanguage(strings.TrimPrefix(strings.TrimLeft(lines[i], " "), "```")); language != "" {
+		code.attrs = [][2]string{{"class", "language-" + language}}
+	}
+
+	var body []string
+	for i++; i < len(lines) && !isFence(lines[i]); i++ {
+		body = append(body, lines[i])
+	}
+	if i < len(lines) {
+		i++
+	}
+	if len(body) != 0 {
+		code.children = []*node{textNode(strings.Join(body, "\n") + "\n")}
+	}
+	return &node{tag: "pre", children: []*node{code}}, i
+}
+
+// codeLanguage keeps the language hint of a code fence only if it looks like a language name.
+func codeLanguage(info string) string {
+	fields := strings.Fields(info)
+	if len(fields) == 0 || len(fields[0]) > 20 {
+		return ""
+	}
+	for _, char := range fields[0] {
+		if !(char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z' || char >= '0' && char <= '9' || strings.ContainsRune("+#-_.", char)) {
+			return ""
+		}
+	}
+	return strings.ToLower(fields[0])
+}
+
+func parseList(lines []string, i int) (*node, int) {
+	ordered, start, _, _ := listMarker(lines[i])
+	list := &node{tag: "ul"}
+	if ordered {
+		list.tag = "ol"
+		if start != 1 {
+			list.attrs = [][2]string{{"start", strconv.Itoa(start)}}
+		}
+	}
+
+	loose := false
+	for i < len(lines) {
+		itemOrdered, _, width, ok := listMarker(lines[i])
+		if !ok || itemOrdered != ordered {
+			break
+		}
+
+		item := []string{lines[i][width:]}
+		for i++; i < len(lines); i++ {
+			line := lines[i]
+			if isBlank(line) {
+				next := i
+				for next < len(lines) && isBlank(lines[next]) {
+					next++
+				}
+				if next == len(lines) || indentOf(lines[next]) < width {
+					break
+				}
+				loose = true
+				item = append(item, "")
+				continue
+			}
+			if indentOf(line) >= width {
+				item = append(item, line[width:])
+				continue
+			}
+			if _, _, _, ok := listMarker(line); ok || isFence(line) || isQuote(line) {
+				break
+			}
+			// A line that is not indented enough still continues the item's last paragraph.
+			item = append(item, strings.TrimLeft(line, " "))
+		}
+		list.children = append(list.children, &node{tag: "li", children: parseBlocks(item)})
+
+		// Blank lines between items keep the list going if another item follows.
+		next := i
+		for next < len(lines) && isBlank(lines[next]) {
+			next++
+		}
+		if next != i {
+			if next == len(lines) {
+				break
+			}
+			if nextOrdered, _, _, ok := listMarker(lines[next]); !ok || nextOrdered != ordered {
+				break
+			}
+			loose = true
+			i = next
+		}
+	}
+
+	// Items of a tight list hold their text directly rather than in paragraphs.
+	if !loose {
+		for _, item := range list.children {
+			var children []*node
+			for _, child := range item.children {
+				if child.tag == "p" {
+					children = append(children, child.children...)
+					continue
+				}
+				children = append(children, child)
+			}
+			item.children = children
+		}
+	}
+	return list, i
+}
+
+// parseParagraph reads lines up to a blank line or the start of another block. Line breaks within
+// the paragraph are kept.
+func parseParagraph(lines []string, i int) (*node, int) {
+	paragraph := &node{tag: "p"}
+	for first := true; i < len(lines); i++ {
+		line := lines[i]
+		if isBlank(line) || isFence(line) || isQuote(line) {
+			break
+		}
+		if _, _, _, ok := listMarker(line); ok && !first {
+			break
+		}
+		if !first {
+			paragraph.children = append(paragraph.children, &node{tag: "br"})
+		}
+		paragraph.children = append(paragraph.children, parseInline(strings.TrimSpace(line), false)...)
+		first = false
+	}
+	return paragraph, i
+}
+
+// parseInline parses emphasis, code spans and links within a line. Links cannot nest, so inside
+// link text brackets are plain text.
+func parseInline(s string, inLink bool) []*node {
+	var nodes []*node
+	var text strings.Builder
+	flush := func() {
+		if text.Len() != 0 {
+			nodes = append(nodes, textNode(text.String()))
+			text.Reset()
+		}
+	}
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && isPunct(s[i+1]):
+			text.WriteByte(s[i+1])
+			i += 2
+			continue
+		case c == '`':
+			n := runLength(s, i, '`')
+			if end := findCodeEnd(s, i+n, n); end >= 0 {
+				flush()
+				code := s[i+n : end]
+				if len(code) > 2 && code[0] == ' ' && code[len(code)-1] == ' ' {
+					code = code[1 : len(code)-1]
+				}
+				nodes = append(nodes, &node{tag: "code", children: []*node{textNode(code)}})
+				i = end + n
+				continue
+			}
+			text.WriteString(s[i : i+n])
+			i += n
+			continue
+		case c == '*' || c == '_':
+			n := runLength(s, i, c)
+			if n > 2 {
+				n = 2
+			}
+			if end := findEmphasisEnd(s, i, c, n); end >= 0 {
+				flush()
+				tag := "em"
+				if n == 2 {
+					tag = "strong"
+				}
+				nodes = append(nodes, &node{tag: tag, children: parseInline(s[i+n:end], inLink)})
+				i = end + n
+				continue
+			}
+		case c == '[' && !inLink:
+			if label, target, end, ok := parseLink(s, i); ok {
+				if href, ok := safeURL(target); ok {
+					flush()
+					nodes = append(nodes, &node{
+						tag:      "a",
+						attrs:    [][2]string{{"href", href}, {"rel", "nofollow noopener ugc"}},
+						children: parseInline(label, true),
+					})
+					i = end
+					continue
+				}
+			}
+		}
+		text.WriteByte(c)
+		i++
+	}
+	flush()
+	return nodes
+}
+
+func isPunct(c byte) bool {
+	return strings.IndexByte("\\`*_{}[]()#+-.!>|~\"'<&", c) >= 0
+}
+
+// isAlnum reports whether c belongs to a word. Bytes of multibyte characters count as letters, so
+// underscores inside words in any script are left alone.
+func isAlnum(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
+
+func runLength(s string, i int, c byte) int {
+	n := 0
+	for i+n < len(s) && s[i+n] == c {
+		n++
+	}
+	return n
+}
+
+// findCodeEnd finds the run of exactly n backticks closing a code span.
+func findCodeEnd(s string, from, n int) int {
+	for j := from; j < len(s); {
+		if s[j] != '`' {
+			j++
+			continue
+		}
+		run := runLength(s, j, '`')
+		if run == n {
+			return j
+		}
+		j += run
+	}
+	return -1
+}
+
+// findEmphasisEnd finds where emphasis opened by n delimiters c at i closes. The text in between
+// must not start or end with a space, and underscores only count at word edges so snake_case names
+// are left alone.
+func findEmphasisEnd(s string, i int, c byte, n int) int {
+	from := i + n
+	if from >= len(s) || s[from] == ' ' || s[from] == c {
+		return -1
+	}
+	if c == '_' && i > 0 && isAlnum(s[i-1]) {
+		return -1
+	}
+
+	for j := from + 1; j < len(s); {
+		switch s[j] {
+		case '\\':
+			j += 2
+			continue
+		case '`':
+			run := runLength(s, j, '`')
+			if end := findCodeEnd(s, j+run, run); end >= 0 {
+				j = end + run
+				continue
+			}
+			j += run
+			continue
+		case c:
+			run := runLength(s, j, c)
+			closes := run >= n && (n == 2 || run != 2) && s[j-1] != ' '
+			if closes && c == '_' && j+run < len(s) && isAlnum(s[j+run]) {
+				closes = false
+			}
+			if closes {
+				return j + run - n
+			}
+			j += run
+			continue
+		}
+		j++
+	}
+	return -1
+}
+
+// parseLink reads [label](target) starting at i and returns where it ends.
+func parseLink(s string, i int) (label, target string, end int, ok bool) {
+	depth := 0
+	for j := i; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth != 0 {
+				continue
+			}
+			if j+1 >= len(s) || s[j+1] != '(' {
+				return "", "", 0, false
+			}
+			close := strings.IndexByte(s[j+2:], ')')
+			if close < 0 {
+				return "", "", 0, false
+			}
+			return s[i+1 : j], strings.TrimSpace(s[j+2 : j+2+close]), j + 2 + close + 1, true
+		}
+	}
+	return "", "", 0, false
+}
+
+// safeURL accepts web and mail links and links within the site. Anything else, javascript: URLs
+// included, is refused and the link is left as text.
+func safeURL(target string) (string, bool) {
+	if target == "" || strings.ContainsAny(target, " \n\"<>") {
+		return "", false
+	}
+	for _, char := range target {
+		if char < 32 || char == 127 {
+			return "", false
+		}
+	}
+
+	colon := strings.IndexByte(target, ':')
+	if colon < 0 || strings.ContainsAny(target[:colon], "/?#") {
+		return target, true
+	}
+	switch strings.ToLower(target[:colon]) {
+	case "http", "https", "mailto":
+		return target, true
+	}
+	return "", false
+}
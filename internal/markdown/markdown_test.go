@@ -0,0 +1,148 @@
+package markdown
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSafeURL(t *testing.T) {
+	tests := []struct {
+		target string
+		ok     bool
+	}{
+		{"https://example.com/a?b=c#d", true},
+		{"http://example.com", true},
+		{"HTTPS://example.com", true},
+		{"mailto:someone@example.com", true},
+		{"/post/1", true},
+		{"post/1?sort=new", true},
+		{"#comments", true},
+		{"/search?q=a:b", true},
+		{"javascript:alert(1)", false},
+		{"JaVaScRiPt:alert(1)", false},
+		{"data:text/html;base64,PHNjcmlwdD4=", false},
+		{"vbscript:msgbox(1)", false},
+		{"java\tscript:alert(1)", false},
+		{"java\x00script:alert(1)", false},
+		{"https://example.com/\x7f", false},
+		{"\x01javascript:alert(1)", false},
+		{"https://example.com/\"onmouseover=\"x", false},
+		{"https://example.com/<script>", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%q", tt.target), func(t *testing.T) {
+			href, ok := safeURL(tt.target)
+			if ok != tt.ok {
+				t.Fatalf("got %t, want %t", ok, tt.ok)
+			}
+			if ok && href != tt.target {
+				t.Errorf("got %q, want the target unchanged", href)
+			}
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"script in text", "<script>alert(1)</script>",
+			"<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>"},
+		{"quotes in text", `a "quoted" & 'single' <b>`,
+			"<p>a &#34;quoted&#34; &amp; &#39;single&#39; &lt;b&gt;</p>"},
+		{"script in link label", "[<script>x</script>](https://example.com)",
+			`<p><a href="https://example.com" rel="nofollow noopener ugc">&lt;script&gt;x&lt;/script&gt;</a></p>`},
+		{"quotes in link label", `[a" onclick="x](https://example.com)`,
+			`<p><a href="https://example.com" rel="nofollow noopener ugc">a&#34; onclick=&#34;x</a></p>`},
+		{"quotes in link target", `[link](https://example.com/"onmouseover="x)`,
+			"<p>[link](https://example.com/&#34;onmouseover=&#34;x)</p>"},
+		{"javascript link", "[x](javascript:alert(1))",
+			"<p>[x](javascript:alert(1))</p>"},
+		{"javascript link in capitals", "[x](JaVaScRiPt:alert(1))",
+			"<p>[x](JaVaScRiPt:alert(1))</p>"},
+		{"data link", "[x](data:text/html,hi)",
+			"<p>[x](data:text/html,hi)</p>"},
+		{"quotes in fence info", "```js\" onload=\"x\ncode <b>\n```",
+			"<pre><code>code &lt;b&gt;\n</code></pre>"},
+		{"script in fence info", "```<script>\nx\n```",
+			"<pre><code>x\n</code></pre>"},
+		{"fence language", "```Go\nfmt.Println(\"<\")\n```",
+			`<pre><code class="language-go">fmt.Println(&#34;&lt;&#34;)` + "\n</code></pre>"},
+		{"unclosed fence", "```\nunclosed\nfence",
+			"<pre><code>unclosed\nfence\n</code></pre>"},
+		{"strong in em", "*a **b** c*",
+			"<p><em>a <strong>b</strong> c</em></p>"},
+		{"em in strong", "**a *b* c**",
+			"<p><strong>a <em>b</em> c</strong></p>"},
+		{"unclosed em", "*unclosed",
+			"<p>*unclosed</p>"},
+		{"unclosed strong", "**unclosed",
+			"<p>**unclosed</p>"},
+		{"em not crossing lines", "*a\nb*",
+			"<p>*a<br>b*</p>"},
+		{"underscores in words", "_snake_case_ name",
+			"<p><em>snake_case</em> name</p>"},
+		{"no em in code", "`code *not em*`",
+			"<p><code>code *not em*</code></p>"},
+		{"backtick in code", "``a ` b``",
+			"<p><code>a ` b</code></p>"},
+		{"unclosed code", "`unclosed code",
+			"<p>`unclosed code</p>"},
+		{"script in code", "`<script>`",
+			"<p><code>&lt;script&gt;</code></p>"},
+		{"link in link", "[*em* `code` [inner](https://a)](https://b)",
+			`<p><a href="https://b" rel="nofollow noopener ugc"><em>em</em> <code>code</code> [inner](https://a)</a></p>`},
+		{"unclosed link", "[x](https://example.com",
+			"<p>[x](https://example.com</p>"},
+		{"nested list", "- a\n- b\n  - c\n  - d\n- e",
+			"<ul><li>a</li><li>b<ul><li>c</li><li>d</li></ul></li><li>e</li></ul>"},
+		{"ordered list start", "3. a\n4. b",
+			`<ol start="3"><li>a</li><li>b</li></ol>`},
+		{"loose list", "- a\n\n- b",
+			"<ul><li><p>a</p></li><li><p>b</p></li></ul>"},
+		{"list kind change", "- a\n1. b",
+			"<ul><li>a</li></ul><ol><li>b</li></ol>"},
+		{"list left open", "- a\n  - b\n\n",
+			"<ul><li>a<ul><li>b</li></ul></li></ul>"},
+		{"list in quote", "> quote <i>\n> - item",
+			"<blockquote><p>quote &lt;i&gt;</p><ul><li>item</li></ul></blockquote>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(Render(tt.source)); got != tt.want {
+				t.Errorf("Render(%q)\n got %q\nwant %q", tt.source, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	cache := NewCache(2)
+	cache.Render("a")
+	cache.Render("b")
+	// Using a again leaves b as the least recently used, which c pushes out.
+	cache.Render("a")
+	if got := cache.Render("c"); got != Render("c") {
+		t.Errorf("got %q, want %q", got, Render("c"))
+	}
+
+	cached := func(source string) bool {
+		for element := cache.order.Front(); element != nil; element = element.Next() {
+			if element.Value.(*cacheEntry).html == Render(source) {
+				return true
+			}
+		}
+		return false
+	}
+	if cache.order.Len() != 2 || len(cache.entries) != 2 {
+		t.Fatalf("%d entries in order and %d by key, want 2", cache.order.Len(), len(cache.entries))
+	}
+	for source, want := range map[string]bool{"a": true, "b": false, "c": true} {
+		if got := cached(source); got != want {
+			t.Errorf("%s cached: %t, want %t", source, got, want)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+type Category struct {
+	ID          int    `json:"id"`
+	Slug        string `json:"slug"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Position    int    `json:"position"`
+	Archived    bool   `json:"archived"`
+	// Posts and LastActivity are only filled in for the category index.
+	Posts        int       `json:"-"`
+	LastActivity time.Time `json:"-"`
+}
+
+// CategorySlugs lists the slugs of the categories, the form they are submitted and filtered by.
+func CategorySlugs(categories []Category) []string {
+	slugs := make([]string, len(categories))
+	for i, category := range categories {
+		slugs[i] = category.Slug
+	}
+	return slugs
+}
@@ -0,0 +1,12 @@
+package model
+
+import "time"
+
+// ChatMessage is a message in the chat room of a category.
+type ChatMessage struct {
+	ID           int       `json:"id"`
+	CategoryID   int       `json:"-"`
+	Author       string    `json:"author"`
+	Content      string    `json:"content"`
+	CreationTime time.Time `json:"creationTime"`
+}
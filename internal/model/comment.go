@@ -1,10 +1,19 @@
 package model
 
+import "time"
+
 type Commentary struct {
-	ID       int
-	PostID   int
-	Content  string
-	Author   string
-	Likes    int
-	Dislikes int
+	ID           int       `json:"id"`
+	PostID       int       `json:"postId"`
+	ParentID     int       `json:"parentId,omitempty"`
+	Content      string    `json:"content"`
+	Author       string    `json:"author"`
+	Likes        int       `json:"likes"`
+	Dislikes     int       `json:"dislikes"`
+	CreationTime time.Time `json:"creationTime"`
+	UpdateTime   time.Time `json:"updateTime"`
+	Deleted      bool      `json:"deleted"`
+
+	Depth   int          `json:"depth"`
+	Replies []Commentary `json:"replies,omitempty"`
 }
@@ -0,0 +1,16 @@
+package model
+
+// Image is a picture attached to a post. Key and ThumbKey name the stored files, which are served
+// under /images/ through the signed, expiring links in URL and ThumbURL.
+type Image struct {
+	ID          int    `json:"id"`
+	PostID      int    `json:"-"`
+	Key         string `json:"key"`
+	ThumbKey    string `json:"thumbKey"`
+	ContentType string `json:"contentType"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	Size        int    `json:"size"`
+	URL         string `json:"url,omitempty"`
+	ThumbURL    string `json:"thumbUrl,omitempty"`
+}
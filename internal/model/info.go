@@ -1,13 +1,52 @@
 package model
 
 type Info struct {
-	User             User
-	ProfileUser      User
-	Post             Post
-	Posts            []Post
-	PostLikes        []string
-	PostDislikes     []string
-	Commentaries     []Commentary
-	CommentsLikes    map[int][]string
-	CommentsDislikes map[int][]string
+	User                User
+	ProfileUser         User
+	Post                Post
+	Posts               []Post
+	Filter              PostFilter
+	PostLikes           []string
+	PostDislikes        []string
+	Commentaries        []Commentary
+	CommentsLikes       map[int][]string
+	CommentsDislikes    map[int][]string
+	Sessions            []Session
+	APITokens           []APIToken
+	NewAPIToken         string
+	Scopes              []Scope
+	Users               []User
+	Roles               []Role
+	Categories          []Category
+	Revisions           []PostRevision
+	CanEditPost         bool
+	CanDeletePost       bool
+	CanComment          bool
+	CanEditAnyComment   bool
+	CanDeleteAnyComment bool
+	Query               string
+	SearchResults       []SearchResult
+	PrevPage            string
+	NextPage            string
+	Conversations       []Conversation
+	Messages            []Message
+	BlockedUsers        []string
+	UnreadMessages      int
+	CanMessage          bool
+	Blocked             bool
+	Notifications       []Notification
+	NotificationPrefs   []NotificationPreference
+	UnreadNotifications int
+	LastEventID         uint64
+	Category            Category
+	ChatMessages        []ChatMessage
+	CanChat             bool
+	FollowedCategories  []string
+	DigestFrequency     DigestFrequency
+	Verified            bool
+	ResetSent           bool
+	ResetToken          string
+	ResetDone           bool
+	UnsubscribeToken    string
+	Unsubscribed        bool
 }
@@ -0,0 +1,59 @@
+package model
+
+import "time"
+
+// OutgoingMail is an email waiting in the outbox. Sending is retried until it succeeds or
+// MaxAttempts is reached; NextAttempt is zero once no more attempts are due.
+type OutgoingMail struct {
+	ID           int
+	To           string
+	Subject      string
+	Text         string
+	HTML         string
+	Headers      map[string]string
+	Attempts     int
+	NextAttempt  time.Time
+	LastError    string
+	CreationTime time.Time
+	SentTime     time.Time
+}
+
+// DigestFrequency is how often a user gets an email of the new posts in the categories they follow.
+type DigestFrequency string
+
+const (
+	DigestOff    DigestFrequency = "off"
+	DigestDaily  DigestFrequency = "daily"
+	DigestWeekly DigestFrequency = "weekly"
+)
+
+var digestPeriods = map[DigestFrequency]time.Duration{
+	DigestDaily:  24 * time.Hour,
+	DigestWeekly: 7 * 24 * time.Hour,
+}
+
+func DigestFrequencies() []DigestFrequency {
+	return []DigestFrequency{DigestOff, DigestDaily, DigestWeekly}
+}
+
+func (f DigestFrequency) Valid() bool {
+	_, ok := digestPeriods[f]
+	return ok || f == DigestOff
+}
+
+// Period is the time between two digests, zero when they are off.
+func (f DigestFrequency) Period() time.Duration {
+	return digestPeriods[f]
+}
+
+// DigestSubscription is the digest setting of a user. Token identifies the subscription in
+// unsubscribe links, and LastPostID is the newest post the previous digest covered.
+type DigestSubscription struct {
+	UserID     int
+	Email      string
+	Username   string
+	Frequency  DigestFrequency
+	Token      string
+	LastPostID int
+	LastSent   time.Time
+}
@@ -0,0 +1,21 @@
+package model
+
+import "time"
+
+// Conversation is the private exchange between two users, as seen by one of them: Peer is the other
+// user, and Unread counts the messages from them not read yet.
+type Conversation struct {
+	ID          int
+	Peer        string
+	LastMessage Message
+	Unread      int
+}
+
+type Message struct {
+	ID             int
+	ConversationID int
+	Sender         string
+	Content        string
+	CreationTime   time.Time
+	ReadTime       time.Time
+}
@@ -0,0 +1,54 @@
+package model
+
+import "time"
+
+// NotificationKind is the kind of event a notification tells about. Users choose which kinds they
+// want to be notified of.
+type NotificationKind string
+
+const (
+	NotifyComment  NotificationKind = "comment"
+	NotifyReply    NotificationKind = "reply"
+	NotifyPostLike NotificationKind = "like"
+	NotifyMention  NotificationKind = "mention"
+)
+
+var notificationDescriptions = map[NotificationKind]string{
+	NotifyComment:  "Comments on my posts",
+	NotifyReply:    "Replies to my comments",
+	NotifyPostLike: "Likes on my posts",
+	NotifyMention:  "Mentions of @me",
+}
+
+func NotificationKinds() []NotificationKind {
+	return []NotificationKind{NotifyComment, NotifyReply, NotifyPostLike, NotifyMention}
+}
+
+func (k NotificationKind) Valid() bool {
+	_, ok := notificationDescriptions[k]
+	return ok
+}
+
+// Description names the kind on the preferences form.
+func (k NotificationKind) Description() string {
+	return notificationDescriptions[k]
+}
+
+// Notification tells UserID that Actor did something to one of their posts or comments, or
+// mentioned them. CommentID is set when the event happened in a comment.
+type Notification struct {
+	ID           int
+	UserID       int
+	Actor        string
+	Kind         NotificationKind
+	PostID       int
+	PostTitle    string
+	CommentID    int
+	CreationTime time.Time
+	ReadTime     time.Time
+}
+
+type NotificationPreference struct {
+	Kind    NotificationKind
+	Enabled bool
+}
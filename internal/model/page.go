@@ -0,0 +1,17 @@
+package model
+
+// Cursor points at the last row of the page already shown: the next page starts right after it,
+// or, when Backward is set, the previous page ends right before it. Key is the value of the sort
+// column for that row, so rows sharing it are told apart by ID.
+type Cursor struct {
+	Key      string
+	ID       int
+	Backward bool
+}
+
+// Page holds the opaque cursors leading to the neighbouring pages; an empty one means there is no
+// page in that direction.
+type Page struct {
+	Next string `json:"next,omitempty"`
+	Prev string `json:"prev,omitempty"`
+}
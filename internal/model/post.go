@@ -3,12 +3,43 @@ package model
 import "time"
 
 type Post struct {
-	ID           int
-	Author       string
-	Title        string
-	Content      string
-	CreationTime time.Time
-	Category     []string
-	Likes        int
-	Dislikes     int
+	ID           int       `json:"id"`
+	Author       string    `json:"author"`
+	Title        string    `json:"title"`
+	Content      string    `json:"content"`
+	CreationTime time.Time `json:"creationTime"`
+	// UpdateTime is when the post was last edited, and zero if it never was.
+	UpdateTime time.Time  `json:"updateTime"`
+	Category   []Category `json:"categories"`
+	Likes      int        `json:"likes"`
+	Dislikes   int        `json:"dislikes"`
+	Comments   int        `json:"comments"`
+	Images     []Image    `json:"images,omitempty"`
+}
+
+type PostSort string
+
+const (
+	SortNew       PostSort = "new"
+	SortOld       PostSort = "old"
+	SortLiked     PostSort = "liked"
+	SortDisliked  PostSort = "disliked"
+	SortCommented PostSort = "commented"
+)
+
+type PostFilter struct {
+	Categories  []string
+	Author      string
+	LikedBy     string
+	DislikedBy  string
+	CommentedBy string
+	// From and To bound the creation date; both days are included.
+	From        time.Time
+	To          time.Time
+	MinScore    int
+	HasMinScore bool
+	Sort        PostSort
+	// Cursor and Limit select one page of the result; a zero Limit returns every post.
+	Cursor Cursor
+	Limit  int
 }
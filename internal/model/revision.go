@@ -0,0 +1,30 @@
+package model
+
+import "time"
+
+type PostRevision struct {
+	ID           int
+	PostID       int
+	Title        string
+	Content      string
+	Category     []string
+	Editor       string
+	RevisionTime time.Time
+
+	TitleDiff    []DiffLine
+	ContentDiff  []DiffLine
+	CategoryDiff []DiffLine
+}
+
+type DiffOp string
+
+const (
+	DiffEqual  DiffOp = "equal"
+	DiffInsert DiffOp = "insert"
+	DiffDelete DiffOp = "delete"
+)
+
+type DiffLine struct {
+	Op   DiffOp
+	Text string
+}
@@ -0,0 +1,58 @@
+package model
+
+type Role int
+
+const (
+	RoleGuest Role = iota
+	RoleUser
+	RoleModerator
+	RoleAdmin
+)
+
+var roleNames = map[Role]string{
+	RoleGuest:     "guest",
+	RoleUser:      "user",
+	RoleModerator: "moderator",
+	RoleAdmin:     "admin",
+}
+
+func (r Role) String() string {
+	if name, ok := roleNames[r]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// MarshalText makes roles appear by name in JSON.
+func (r Role) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+func ParseRole(name string) (Role, bool) {
+	for role, roleName := range roleNames {
+		if roleName == name {
+			return role, true
+		}
+	}
+	return RoleGuest, false
+}
+
+func Roles() []Role {
+	return []Role{RoleGuest, RoleUser, RoleModerator, RoleAdmin}
+}
+
+type Permission int
+
+const (
+	PermCreatePost Permission = iota + 1
+	PermComment
+	PermVote
+	PermEditAnyPost
+	PermDeleteAnyPost
+	PermEditAnyComment
+	PermDeleteAnyComment
+	PermManageRoles
+	PermManageCategories
+	PermMessage
+	PermChat
+)
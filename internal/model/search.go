@@ -0,0 +1,23 @@
+package model
+
+type SearchQuery struct {
+	// Terms are matched against titles and contents; a term containing spaces is a phrase.
+	Terms    []string
+	Author   string
+	Category string
+	Limit    int
+}
+
+type SearchResult struct {
+	Kind         string        `json:"kind"`
+	PostID       int           `json:"postId"`
+	CommentaryID int           `json:"commentaryId,omitempty"`
+	Author       string        `json:"author"`
+	Title        string        `json:"title"`
+	Snippet      []SnippetPart `json:"snippet"`
+}
+
+type SnippetPart struct {
+	Text  string `json:"text"`
+	Match bool   `json:"match"`
+}
@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// Session is a sign-in of a user on one device. Only a hash of its token is stored, so Token is set
+// when the session is created or refreshed, and empty when it is read back.
+type Session struct {
+	ID             int
+	UserID         int
+	Token          string
+	UserAgent      string
+	IP             string
+	CreationTime   time.Time
+	LastSeen       time.Time
+	ExpirationTime time.Time
+}
@@ -0,0 +1,81 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// APITokenPrefix starts every personal access token, which tells them apart from session tokens.
+const APITokenPrefix = "fpat_"
+
+// HashToken is how session tokens, personal access tokens and the tokens of links sent by email are
+// stored, so a copy of the database can neither sign anyone in nor follow the links.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Scope is a set of things a personal access token may do on behalf of its owner.
+type Scope int
+
+const (
+	ScopeRead Scope = 1 << iota
+	ScopePost
+	ScopeVote
+	ScopeModerate
+)
+
+var scopeNames = []struct {
+	scope Scope
+	name  string
+}{
+	{ScopeRead, "read"},
+	{ScopePost, "post"},
+	{ScopeVote, "vote"},
+	{ScopeModerate, "moderate"},
+}
+
+// Scopes lists every scope a token can be given.
+func Scopes() []Scope {
+	scopes := make([]Scope, len(scopeNames))
+	for i, s := range scopeNames {
+		scopes[i] = s.scope
+	}
+	return scopes
+}
+
+// Names returns the names of the scopes in s.
+func (s Scope) Names() []string {
+	var names []string
+	for _, scope := range scopeNames {
+		if s&scope.scope != 0 {
+			names = append(names, scope.name)
+		}
+	}
+	return names
+}
+
+func (s Scope) String() string {
+	return strings.Join(s.Names(), ",")
+}
+
+func ParseScope(name string) (Scope, bool) {
+	for _, scope := range scopeNames {
+		if scope.name == name {
+			return scope.scope, true
+		}
+	}
+	return 0, false
+}
+
+type APIToken struct {
+	ID           int
+	UserID       int
+	Name         string
+	Hint         string
+	Scopes       Scope
+	CreationTime time.Time
+	LastUsed     time.Time
+}
@@ -3,13 +3,37 @@ package model
 import "time"
 
 type User struct {
-	ID              int
-	Email           string
-	Username        string
-	Password        string
-	ConfirmPassword string
-	Posts           int
-
-	Token          string
+	ID              int    `json:"id"`
+	Email           string `json:"email,omitempty"`
+	Username        string `json:"username"`
+	Password        string `json:"-"`
+	ConfirmPassword string `json:"-"`
+	Posts           int    `json:"posts"`
+	Role            Role   `json:"role"`
+	// Verified tells whether the user confirmed their email address. Until then they can only browse.
+	Verified bool `json:"-"`
+
+	// SessionID is the session the user is signed in with, and ExpirationTime when it ends.
+	SessionID      int       `json:"-"`
+	ExpirationTime time.Time `json:"-"`
+	// Scopes limits what the user may do when signed in with a personal access token. It is zero for
+	// session sign-ins, which are not limited.
+	Scopes Scope `json:"-"`
+}
+
+// EmailVerification is the pending confirmation of the email address of a new account.
+type EmailVerification struct {
+	UserID         int
+	TokenHash      string
+	ExpirationTime time.Time
+	LastSent       time.Time
+	CreationTime   time.Time
+}
+
+// PasswordReset is a link sent to a user who forgot their password.
+type PasswordReset struct {
+	UserID         int
+	TokenHash      string
 	ExpirationTime time.Time
+	CreationTime   time.Time
 }
@@ -0,0 +1,56 @@
+package model
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// confusables maps characters to the Latin letter they are easily mistaken for. It covers the
+// Cyrillic and Greek look-alikes, along with digits and symbols that pass for letters.
+var confusables = map[rune]rune{
+	'а': 'a', 'в': 'b', 'е': 'e', 'з': '3', 'к': 'k', 'м': 'm', 'н': 'h', 'о': 'o', 'р': 'p',
+	'с': 'c', 'т': 't', 'у': 'y', 'х': 'x', 'ѕ': 's', 'і': 'i', 'ї': 'i', 'ј': 'j', 'һ': 'h', 'ԁ': 'd',
+	'ԛ': 'q', 'ԝ': 'w', 'ӏ': 'l', 'ү': 'y', 'ь': 'b', 'п': 'n', 'г': 'r',
+	'α': 'a', 'β': 'b', 'ε': 'e', 'η': 'n', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o', 'ρ': 'p', 'τ': 't',
+	'υ': 'u', 'χ': 'x', 'ω': 'w', 'ζ': 'z',
+	'0': 'o', '1': 'l', '|': 'l', '5': 's', '$': 's', '@': 'a',
+}
+
+// capitalLookalikes are capitals read as a lower case l. Case folding would turn them into an i,
+// so they are also compared with that replacement made first.
+var capitalLookalikes = map[rune]bool{'I': true, 'І': true, 'Ι': true, 'Ӏ': true}
+
+// UsernameSkeletons reduces a username to the forms it is recognised by at a glance: compatibility
+// characters folded, separators dropped, case ignored and look-alike characters replaced. Capitals
+// looking like an l are folded to lower case in the first form, and taken for an l in the second.
+// Two usernames can pass for each other when either form is the same for both.
+func UsernameSkeletons(username string) (skeleton, capitals string) {
+	return usernameSkeleton(username, false), usernameSkeleton(username, true)
+}
+
+// usernameSkeleton reduces a username to the form it is recognised by at a glance. With capitals
+// set, capitals that look like an l are taken for one instead of being folded to lower case.
+func usernameSkeleton(username string, capitals bool) string {
+	var b strings.Builder
+	for _, char := range norm.NFKD.String(username) {
+		if unicode.IsSpace(char) || char == '_' || char == '-' || char == '.' {
+			continue
+		}
+		if capitals && capitalLookalikes[char] {
+			b.WriteRune('l')
+			continue
+		}
+		char = unicode.ToLower(char)
+		if replacement, ok := confusables[char]; ok {
+			char = replacement
+		}
+		b.WriteRune(char)
+	}
+
+	skeleton := norm.NFC.String(b.String())
+	skeleton = strings.ReplaceAll(skeleton, "rn", "m")
+	skeleton = strings.ReplaceAll(skeleton, "vv", "w")
+	return skeleton
+}
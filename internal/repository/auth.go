@@ -3,18 +3,36 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"forum/internal/config"
 	"forum/internal/model"
+	"strings"
 	"time"
+
+	"github.com/mattn/go-sqlite3"
 )
 
 type Auth interface {
 	CreateUser(user model.User) error
 	GetUser(username string) (model.User, error)
-	SaveToken(username, token string, expirationTime time.Time) error
-	GetUserByToken(token string) (model.User, error)
-	DeleteToken(token string) error
+	CreateSession(session model.Session, tokenHash string) error
+	GetUserByTokenHash(hash string) (model.User, error)
+	GetSessionsByUserID(userId int) ([]model.Session, error)
+	UpdateSession(session model.Session) error
+	DeleteTokenByHash(hash string) error
+	DeleteSession(userId, sessionId int) error
+	DeleteExpiredSessions(userId int, now time.Time) error
+	SetEmailVerification(verification model.EmailVerification) error
+	GetEmailVerification(userId int) (model.EmailVerification, error)
+	GetEmailVerificationByHash(hash string) (model.EmailVerification, error)
+	DeleteEmailVerification(userId int) error
+	DeleteUnverifiedUsers(createdBefore time.Time) (int, error)
+	GetUserByEmail(email string) (model.User, error)
+	SetPasswordReset(reset model.PasswordReset) error
+	GetPasswordReset(userId int) (model.PasswordReset, error)
+	GetPasswordResetByHash(hash string) (model.PasswordReset, error)
+	ResetPassword(reset model.PasswordReset, password string) error
 }
 type AuthRepository struct {
 	db  *sql.DB
@@ -28,12 +46,24 @@ func newAuthRepository(db *sql.DB, cfg *config.Config) *AuthRepository {
 	}
 }
 
+// ErrSkeletonTaken is returned by CreateUser when the username reads the same as one already taken.
+var ErrSkeletonTaken = errors.New("username skeleton taken")
+
+// CreateUser stores a new account along with the skeletons of its username, which no other account
+// may share.
 func (r *AuthRepository) CreateUser(user model.User) error {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
 	defer cancel()
-	query := `INSERT INTO user (email, username, password) VALUES ($1, $2, $3);`
-	_, err := r.db.ExecContext(ctx, query, user.Email, user.Username, user.Password)
+	skeleton, capitals := model.UsernameSkeletons(user.Username)
+	// The very first account becomes the administrator, so a fresh forum always has someone able to assign roles.
+	query := `INSERT INTO user (email, username, password, role, skeleton, capitals_skeleton)
+		VALUES ($1, $2, $3, CASE WHEN (SELECT COUNT(*) FROM user) = 0 THEN $4 ELSE $5 END, $6, $7);`
+	_, err := r.db.ExecContext(ctx, query, user.Email, user.Username, user.Password, model.RoleAdmin, model.RoleUser, skeleton, capitals)
 	if err != nil {
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique && strings.Contains(sqliteErr.Error(), "skeleton") {
+			return fmt.Errorf("repository: create user: %w", ErrSkeletonTaken)
+		}
 		return fmt.Errorf("repository: create user: %w	", err)
 	}
 	return nil
@@ -42,43 +72,295 @@ func (r *AuthRepository) CreateUser(user model.User) error {
 func (r *AuthRepository) GetUser(username string) (model.User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
 	defer cancel()
-	query := `SELECT id, email, username, password FROM user WHERE username = $1;`
+	query := `SELECT id, email, username, password, role, NOT EXISTS (SELECT 1 FROM email_verification WHERE email_verification.userID = user.id)
+		FROM user WHERE username = $1;`
 	var user model.User
-	if err := r.db.QueryRowContext(ctx, query, username).Scan(&user.ID, &user.Email, &user.Username, &user.Password); err != nil {
+	if err := r.db.QueryRowContext(ctx, query, username).Scan(&user.ID, &user.Email, &user.Username, &user.Password, &user.Role, &user.Verified); err != nil {
 		return model.User{}, fmt.Errorf("repository: get user: %w", err)
 	}
 	return user, nil
 }
 
-func (r *AuthRepository) SaveToken(username, token string, expirationTime time.Time) error {
+// CreateSession stores a new session, keeping only the hash of its token.
+func (r *AuthRepository) CreateSession(session model.Session, tokenHash string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
 	defer cancel()
-	query := `UPDATE user SET token = $1, expiration_time = $2 WHERE username = $3;`
-	_, err := r.db.ExecContext(ctx, query, token, expirationTime, username)
+	query := `INSERT INTO session (userID, token_hash, user_agent, ip, creation_time, last_seen, expiration_time) VALUES ($1, $2, $3, $4, $5, $6, $7);`
+	_, err := r.db.ExecContext(ctx, query, session.UserID, tokenHash, session.UserAgent, session.IP, session.CreationTime, session.LastSeen, session.ExpirationTime)
 	if err != nil {
-		return fmt.Errorf("repository: save token: %w", err)
+		return fmt.Errorf("repository: create session: %w", err)
 	}
 	return nil
 }
 
-func (r *AuthRepository) GetUserByToken(token string) (model.User, error) {
+func (r *AuthRepository) GetUserByTokenHash(hash string) (model.User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
 	defer cancel()
-	query := `SELECT id, email, username, password, expiration_time FROM user WHERE token = $1;`
+	query := `SELECT user.id, user.email, user.username, user.password, user.posts, user.role, session.id, session.expiration_time,
+			NOT EXISTS (SELECT 1 FROM email_verification WHERE email_verification.userID = user.id)
+		FROM session INNER JOIN user ON user.id = session.userID WHERE session.token_hash = $1;`
 	var user model.User
-	if err := r.db.QueryRowContext(ctx, query, token).Scan(&user.ID, &user.Email, &user.Username, &user.Password, &user.ExpirationTime); err != nil {
+	if err := r.db.QueryRowContext(ctx, query, hash).Scan(&user.ID, &user.Email, &user.Username, &user.Password, &user.Posts, &user.Role, &user.SessionID, &user.ExpirationTime,
+		&user.Verified); err != nil {
 		return model.User{}, fmt.Errorf("repository: get user by token: %w", err)
 	}
 	return user, nil
 }
 
-func (r *AuthRepository) DeleteToken(token string) error {
+func (r *AuthRepository) GetSessionsByUserID(userId int) ([]model.Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	query := `SELECT id, userID, user_agent, ip, creation_time, last_seen, expiration_time FROM session WHERE userID = $1 ORDER BY last_seen DESC;`
+	rows, err := r.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, fmt.Errorf("repository: get sessions by user id: query - %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []model.Session
+	for rows.Next() {
+		var session model.Session
+		if err := rows.Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IP, &session.CreationTime, &session.LastSeen, &session.ExpirationTime); err != nil {
+			return nil, fmt.Errorf("repository: get sessions by user id: scan - %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (r *AuthRepository) UpdateSession(session model.Session) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	query := `UPDATE session SET user_agent = $1, ip = $2, last_seen = $3, expiration_time = $4 WHERE id = $5;`
+	_, err := r.db.ExecContext(ctx, query, session.UserAgent, session.IP, session.LastSeen, session.ExpirationTime, session.ID)
+	if err != nil {
+		return fmt.Errorf("repository: update session: %w", err)
+	}
+	return nil
+}
+
+func (r *AuthRepository) DeleteTokenByHash(hash string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
 	defer cancel()
-	query := `UPDATE user SET token = NULL, expiration_time = NULL WHERE token = $1;`
-	_, err := r.db.ExecContext(ctx, query, token)
+	query := `DELETE FROM session WHERE token_hash = $1;`
+	_, err := r.db.ExecContext(ctx, query, hash)
 	if err != nil {
 		return fmt.Errorf("repository: delete token: %w", err)
 	}
 	return nil
 }
+
+func (r *AuthRepository) DeleteSession(userId, sessionId int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	query := `DELETE FROM session WHERE id = $1 AND userID = $2;`
+	res, err := r.db.ExecContext(ctx, query, sessionId, userId)
+	if err != nil {
+		return fmt.Errorf("repository: delete session: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("repository: delete session: rows affected - %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("repository: delete session: %w", sql.ErrNoRows)
+	}
+	return nil
+}
+
+func (r *AuthRepository) DeleteExpiredSessions(userId int, now time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	query := `DELETE FROM session WHERE userID = $1 AND expiration_time < $2;`
+	_, err := r.db.ExecContext(ctx, query, userId, now)
+	if err != nil {
+		return fmt.Errorf("repository: delete expired sessions: %w", err)
+	}
+	return nil
+}
+
+func (r *AuthRepository) GetUserByEmail(email string) (model.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	// Addresses are compared without regard to case, preferring an exact match.
+	query := `SELECT id, email, username, role FROM user WHERE email = $1 COLLATE NOCASE ORDER BY email = $1 DESC LIMIT 1;`
+	var user model.User
+	if err := r.db.QueryRowContext(ctx, query, email).Scan(&user.ID, &user.Email, &user.Username, &user.Role); err != nil {
+		return model.User{}, fmt.Errorf("repository: get user by email: %w", err)
+	}
+	return user, nil
+}
+
+// SetEmailVerification stores a new token for the verification of a user, replacing any earlier one.
+func (r *AuthRepository) SetEmailVerification(verification model.EmailVerification) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	query := `INSERT INTO email_verification (userID, token_hash, expiration_time, last_sent, creation_time) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (userID) DO UPDATE SET token_hash = excluded.token_hash, expiration_time = excluded.expiration_time, last_sent = excluded.last_sent;`
+	if _, err := r.db.ExecContext(ctx, query, verification.UserID, verification.TokenHash, verification.ExpirationTime, verification.LastSent,
+		verification.CreationTime); err != nil {
+		return fmt.Errorf("repository: set email verification: %w", err)
+	}
+	return nil
+}
+
+func (r *AuthRepository) GetEmailVerification(userId int) (model.EmailVerification, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	query := `SELECT userID, token_hash, expiration_time, last_sent, creation_time FROM email_verification WHERE userID = $1;`
+	var verification model.EmailVerification
+	if err := r.db.QueryRowContext(ctx, query, userId).Scan(&verification.UserID, &verification.TokenHash, &verification.ExpirationTime,
+		&verification.LastSent, &verification.CreationTime); err != nil {
+		return model.EmailVerification{}, fmt.Errorf("repository: get email verification: %w", err)
+	}
+	return verification, nil
+}
+
+func (r *AuthRepository) GetEmailVerificationByHash(hash string) (model.EmailVerification, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	query := `SELECT userID, token_hash, expiration_time, last_sent, creation_time FROM email_verification WHERE token_hash = $1;`
+	var verification model.EmailVerification
+	if err := r.db.QueryRowContext(ctx, query, hash).Scan(&verification.UserID, &verification.TokenHash, &verification.ExpirationTime,
+		&verification.LastSent, &verification.CreationTime); err != nil {
+		return model.EmailVerification{}, fmt.Errorf("repository: get email verification by hash: %w", err)
+	}
+	return verification, nil
+}
+
+// DeleteEmailVerification marks the email address of a user as confirmed.
+func (r *AuthRepository) DeleteEmailVerification(userId int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	query := `DELETE FROM email_verification WHERE userID = $1;`
+	if _, err := r.db.ExecContext(ctx, query, userId); err != nil {
+		return fmt.Errorf("repository: delete email verification: %w", err)
+	}
+	return nil
+}
+
+// DeleteUnverifiedUsers removes the accounts created before createdBefore that never confirmed their
+// email address, along with what they left behind, and returns how many went. Unverified accounts
+// cannot post, comment or vote, so there is no content of theirs to keep.
+func (r *AuthRepository) DeleteUnverifiedUsers(createdBefore time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("repository: delete unverified users: begin - %w", err)
+	}
+	defer tx.Rollback()
+
+	stale := `SELECT userID FROM email_verification WHERE creation_time < $1`
+	queries := []string{
+		`DELETE FROM session WHERE userID IN (` + stale + `);`,
+		`DELETE FROM api_token WHERE userID IN (` + stale + `);`,
+		`DELETE FROM notification WHERE userID IN (` + stale + `);`,
+		`DELETE FROM notification_preference WHERE userID IN (` + stale + `);`,
+		`DELETE FROM category_follow WHERE userID IN (` + stale + `);`,
+		`DELETE FROM digest_subscription WHERE userID IN (` + stale + `);`,
+		`DELETE FROM user_block WHERE blockerID IN (` + stale + `) OR blockedID IN (` + stale + `);`,
+		`DELETE FROM message WHERE conversationID IN (SELECT id FROM conversation WHERE userA IN (` + stale + `) OR userB IN (` + stale + `));`,
+		`DELETE FROM conversation WHERE userA IN (` + stale + `) OR userB IN (` + stale + `);`,
+	}
+	for _, query := range queries {
+		if _, err := tx.ExecContext(ctx, query, createdBefore); err != nil {
+			return 0, fmt.Errorf("repository: delete unverified users: %w", err)
+		}
+	}
+	res, err := tx.ExecContext(ctx, `DELETE FROM user WHERE id IN (`+stale+`);`, createdBefore)
+	if err != nil {
+		return 0, fmt.Errorf("repository: delete unverified users: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("repository: delete unverified users: rows affected - %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM email_verification WHERE creation_time < $1;`, createdBefore); err != nil {
+		return 0, fmt.Errorf("repository: delete unverified users: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("repository: delete unverified users: commit - %w", err)
+	}
+	return int(n), nil
+}
+
+// SetPasswordReset stores a new reset link for a user, replacing any earlier one.
+func (r *AuthRepository) SetPasswordReset(reset model.PasswordReset) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	query := `INSERT INTO password_reset (userID, token_hash, expiration_time, creation_time) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (userID) DO UPDATE SET token_hash = excluded.token_hash, expiration_time = excluded.expiration_time, creation_time = excluded.creation_time;`
+	if _, err := r.db.ExecContext(ctx, query, reset.UserID, reset.TokenHash, reset.ExpirationTime, reset.CreationTime); err != nil {
+		return fmt.Errorf("repository: set password reset: %w", err)
+	}
+	return nil
+}
+
+func (r *AuthRepository) GetPasswordReset(userId int) (model.PasswordReset, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	query := `SELECT userID, token_hash, expiration_time, creation_time FROM password_reset WHERE userID = $1;`
+	var reset model.PasswordReset
+	if err := r.db.QueryRowContext(ctx, query, userId).Scan(&reset.UserID, &reset.TokenHash, &reset.ExpirationTime, &reset.CreationTime); err != nil {
+		return model.PasswordReset{}, fmt.Errorf("repository: get password reset: %w", err)
+	}
+	return reset, nil
+}
+
+func (r *AuthRepository) GetPasswordResetByHash(hash string) (model.PasswordReset, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	query := `SELECT userID, token_hash, expiration_time, creation_time FROM password_reset WHERE token_hash = $1;`
+	var reset model.PasswordReset
+	if err := r.db.QueryRowContext(ctx, query, hash).Scan(&reset.UserID, &reset.TokenHash, &reset.ExpirationTime, &reset.CreationTime); err != nil {
+		return model.PasswordReset{}, fmt.Errorf("repository: get password reset by hash: %w", err)
+	}
+	return reset, nil
+}
+
+// ResetPassword uses up a reset link to set the hashed password of its user. It fails with
+// sql.ErrNoRows when the link was used already. Every session and API token of the user ends, so
+// whoever knew the old password is cut off. Having received the link also proves the email address
+// is theirs, so it counts as verified.
+func (r *AuthRepository) ResetPassword(reset model.PasswordReset, password string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("repository: reset password: begin - %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM password_reset WHERE userID = $1 AND token_hash = $2;`, reset.UserID, reset.TokenHash)
+	if err != nil {
+		return fmt.Errorf("repository: reset password: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("repository: reset password: rows affected - %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("repository: reset password: %w", sql.ErrNoRows)
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE user SET password = $1 WHERE id = $2;`, password, reset.UserID); err != nil {
+		return fmt.Errorf("repository: reset password: %w", err)
+	}
+	for _, query := range []string{
+		`DELETE FROM session WHERE userID = $1;`,
+		`DELETE FROM api_token WHERE userID = $1;`,
+		`DELETE FROM email_verification WHERE userID = $1;`,
+	} {
+		if _, err := tx.ExecContext(ctx, query, reset.UserID); err != nil {
+			return fmt.Errorf("repository: reset password: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("repository: reset password: commit - %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"forum/internal/model"
+	"testing"
+	"time"
+)
+
+func TestGetUserByEmailIgnoresCase(t *testing.T) {
+	repo := newTestRepository(t)
+	username := createTestUsers(t, repo, 1)[0]
+
+	user, err := repo.GetUserByEmail("User0@Example.COM")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Username != username {
+		t.Errorf("got %s, want %s", user.Username, username)
+	}
+	if _, err := repo.GetUserByEmail("user1@example.com"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("unknown address: %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestResetPasswordRevokesAPITokens(t *testing.T) {
+	repo := newTestRepository(t)
+	user, err := repo.GetUser(createTestUsers(t, repo, 1)[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.CreateAPIToken(model.APIToken{UserID: user.ID, Name: "script", Scopes: model.ScopeRead}, "token hash"); err != nil {
+		t.Fatal(err)
+	}
+	reset := model.PasswordReset{UserID: user.ID, TokenHash: "reset hash", ExpirationTime: time.Now().Add(time.Hour), CreationTime: time.Now()}
+	if err := repo.SetPasswordReset(reset); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repo.ResetPassword(reset, "new password"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := repo.GetUserByAPITokenHash("token hash"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("token after reset: %v, want sql.ErrNoRows", err)
+	}
+	if err := repo.ResetPassword(reset, "newer password"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("second use of the link: %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestCreateUserRefusesConfusableUsername(t *testing.T) {
+	repo := newTestRepository(t)
+	createTestUsers(t, repo, 1)
+
+	for _, username := range []string{"User_0", "usеr0", "user0 ", "useR0"} {
+		user := model.User{Email: username + "@example.org", Username: username, Password: "password"}
+		if err := repo.CreateUser(user); !errors.Is(err, ErrSkeletonTaken) {
+			t.Errorf("create %q: %v, want ErrSkeletonTaken", username, err)
+		}
+	}
+	if err := repo.CreateUser(model.User{Email: "user1@example.com", Username: "user1", Password: "password"}); err != nil {
+		t.Errorf("create user1: %v", err)
+	}
+}
+
+func TestUsernameSkeletonBackfill(t *testing.T) {
+	db := newTestDB(t)
+	// The user table as it was before skeletons, holding two usernames that read the same.
+	for _, query := range []string{
+		`DROP TABLE user;`,
+		`CREATE TABLE user (id INTEGER PRIMARY KEY AUTOINCREMENT, email TEXT UNIQUE, username TEXT UNIQUE, password TEXT, posts INT DEFAULT 0, role INT DEFAULT 1);`,
+		`INSERT INTO user (email, username) VALUES ('a@example.com', 'admin'), ('b@example.com', 'аdmin'), ('c@example.com', 'carol');`,
+	} {
+		if _, err := db.Exec(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := CreateTables(db); err != nil {
+		t.Fatal(err)
+	}
+
+	var withSkeleton int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM user WHERE skeleton IS NOT NULL;`).Scan(&withSkeleton); err != nil {
+		t.Fatal(err)
+	}
+	if withSkeleton != 2 {
+		t.Errorf("%d usernames have a skeleton, want 2", withSkeleton)
+	}
+	repo := NewRepository(db, testConfig())
+	for _, username := range []string{"Admin", "Carol"} {
+		user := model.User{Email: username + "@example.org", Username: username, Password: "password"}
+		if err := repo.CreateUser(user); !errors.Is(err, ErrSkeletonTaken) {
+			t.Errorf("create %q: %v, want ErrSkeletonTaken", username, err)
+		}
+	}
+}
+
+func TestSessionTokenBackfill(t *testing.T) {
+	db := newTestDB(t)
+	// The session table as it was before tokens were hashed.
+	for _, query := range []string{
+		`DROP TABLE session;`,
+		`CREATE TABLE session (id INTEGER PRIMARY KEY AUTOINCREMENT, userID INTEGER, token TEXT UNIQUE, user_agent TEXT, ip TEXT,
+			creation_time DATETIME, last_seen DATETIME, expiration_time DATETIME);`,
+		`INSERT INTO user (email, username, password) VALUES ('a@example.com', 'alice', 'hash');`,
+		`INSERT INTO session (userID, token, expiration_time) VALUES (1, 'plain token', '2100-01-01 00:00:00');`,
+	} {
+		if _, err := db.Exec(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := CreateTables(db); err != nil {
+		t.Fatal(err)
+	}
+
+	var plain int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM session WHERE token IS NOT NULL;`).Scan(&plain); err != nil {
+		t.Fatal(err)
+	}
+	if plain != 0 {
+		t.Errorf("%d tokens left in plain text", plain)
+	}
+	user, err := NewRepository(db, testConfig()).GetUserByTokenHash(model.HashToken("plain token"))
+	if err != nil || user.Username != "alice" {
+		t.Errorf("signed in as %q, %v; want alice", user.Username, err)
+	}
+}
+
+func TestRoleColumnMakesNobodyAdmin(t *testing.T) {
+	db := newTestDB(t)
+	// The user table as it was before roles.
+	for _, query := range []string{
+		`DROP TABLE user;`,
+		`CREATE TABLE user (id INTEGER PRIMARY KEY AUTOINCREMENT, email TEXT UNIQUE, username TEXT UNIQUE, password TEXT, posts INT DEFAULT 0);`,
+		`INSERT INTO user (email, username, password) VALUES ('a@example.com', 'alice', 'hash'), ('b@example.com', 'bob', 'hash');`,
+	} {
+		if _, err := db.Exec(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := CreateTables(db); err != nil {
+		t.Fatal(err)
+	}
+
+	var admins int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM user WHERE role != $1;`, model.RoleUser).Scan(&admins); err != nil {
+		t.Fatal(err)
+	}
+	if admins != 0 {
+		t.Errorf("%d existing accounts given another role than user", admins)
+	}
+}
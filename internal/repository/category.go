@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"forum/internal/config"
+	"forum/internal/model"
+	"time"
+)
+
+type Category interface {
+	CreateCategory(category model.Category) error
+	GetCategories(includeArchived bool) ([]model.Category, error)
+	GetCategoryBySlug(slug string) (model.Category, error)
+	UpdateCategory(category model.Category) error
+	GetCategoryStats() ([]model.Category, error)
+}
+
+type CategoryRepository struct {
+	db  *sql.DB
+	cfg *config.Config
+}
+
+func newCategoryRepository(db *sql.DB, cfg *config.Config) *CategoryRepository {
+	return &CategoryRepository{
+		db:  db,
+		cfg: cfg,
+	}
+}
+
+func (r *CategoryRepository) CreateCategory(category model.Category) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	query := `INSERT INTO category (slug, name, description, position) VALUES ($1, $2, $3, $4);`
+	if _, err := r.db.ExecContext(ctx, query, category.Slug, category.Name, category.Description, category.Position); err != nil {
+		return fmt.Errorf("repository: create category: Insert query - %w", err)
+	}
+	return nil
+}
+
+// GetCategories returns the categories in display order, leaving out archived ones unless asked.
+func (r *CategoryRepository) GetCategories(includeArchived bool) ([]model.Category, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	query := `SELECT id, slug, name, description, position, archived FROM category WHERE archived = 0 OR $1 ORDER BY position, name;`
+	rows, err := r.db.QueryContext(ctx, query, includeArchived)
+	if err != nil {
+		return nil, fmt.Errorf("repository: get categories: query - %w", err)
+	}
+	defer rows.Close()
+
+	var categories []model.Category
+	for rows.Next() {
+		var category model.Category
+		if err := rows.Scan(&category.ID, &category.Slug, &category.Name, &category.Description, &category.Position, &category.Archived); err != nil {
+			return nil, fmt.Errorf("repository: get categories: scan - %w", err)
+		}
+		categories = append(categories, category)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return categories, nil
+}
+
+func (r *CategoryRepository) GetCategoryBySlug(slug string) (model.Category, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	query := `SELECT id, slug, name, description, position, archived FROM category WHERE slug = $1;`
+	var category model.Category
+	if err := r.db.QueryRowContext(ctx, query, slug).Scan(&category.ID, &category.Slug, &category.Name, &category.Description, &category.Position, &category.Archived); err != nil {
+		return model.Category{}, fmt.Errorf("repository: get category by slug: %w", err)
+	}
+	return category, nil
+}
+
+// UpdateCategory saves the name, description, position and archived flag of the category with the
+// given slug. The slug itself never changes, since posts refer to it.
+func (r *CategoryRepository) UpdateCategory(category model.Category) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	query := `UPDATE category SET name = $1, description = $2, position = $3, archived = $4 WHERE slug = $5;`
+	res, err := r.db.ExecContext(ctx, query, category.Name, category.Description, category.Position, category.Archived, category.Slug)
+	if err != nil {
+		return fmt.Errorf("repository: update category: Update query - %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("repository: update category: rows affected - %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("repository: update category: %w", sql.ErrNoRows)
+	}
+	return nil
+}
+
+// GetCategoryStats returns the active categories with their post count and the time of the latest
+// post or comment made in them.
+func (r *CategoryRepository) GetCategoryStats() ([]model.Category, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	query := `SELECT id, slug, name, description, position, archived,
+		(SELECT COUNT(*) FROM post_category WHERE post_category.category = category.slug),
+		MAX(
+			COALESCE((SELECT MAX(post.creation_time) FROM post JOIN post_category ON post_category.postID = post.id
+				WHERE post_category.category = category.slug), ''),
+			COALESCE((SELECT MAX(commentary.creation_time) FROM commentary JOIN post_category ON post_category.postID = commentary.postID
+				WHERE post_category.category = category.slug AND commentary.deleted = 0), '')
+		)
+		FROM category WHERE archived = 0 ORDER BY position, name;`
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("repository: get category stats: query - %w", err)
+	}
+	defer rows.Close()
+
+	var categories []model.Category
+	for rows.Next() {
+		var category model.Category
+		var lastActivity string
+		if err := rows.Scan(&category.ID, &category.Slug, &category.Name, &category.Description, &category.Position, &category.Archived,
+			&category.Posts, &lastActivity); err != nil {
+			return nil, fmt.Errorf("repository: get category stats: scan - %w", err)
+		}
+		if lastActivity != "" {
+			if category.LastActivity, err = time.Parse(SQLiteTimeFormat, lastActivity); err != nil {
+				return nil, fmt.Errorf("repository: get category stats: last activity - %w", err)
+			}
+		}
+		categories = append(categories, category)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return categories, nil
+}
@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"forum/internal/config"
+	"forum/internal/model"
+	"time"
+)
+
+type Chat interface {
+	CreateChatMessage(message model.ChatMessage, userId, keep int) (int, error)
+	GetChatMessages(categoryId, limit int) ([]model.ChatMessage, error)
+}
+
+type ChatRepository struct {
+	db  *sql.DB
+	cfg *config.Config
+}
+
+func newChatRepository(db *sql.DB, cfg *config.Config) *ChatRepository {
+	return &ChatRepository{
+		db:  db,
+		cfg: cfg,
+	}
+}
+
+// CreateChatMessage stores a message sent by a user to the chat room of a category, and forgets all
+// but the keep latest messages of that room.
+func (r *ChatRepository) CreateChatMessage(message model.ChatMessage, userId, keep int) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("repository: create chat message: begin tx - %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO chat_message (categoryID, userID, content, creation_time) VALUES ($1, $2, $3, $4) RETURNING id;`
+	var id int
+	if err := tx.QueryRowContext(ctx, query, message.CategoryID, userId, message.Content, message.CreationTime).Scan(&id); err != nil {
+		return 0, fmt.Errorf("repository: create chat message: insert query - %w", err)
+	}
+	query = `DELETE FROM chat_message WHERE categoryID = $1 AND id <= (
+			SELECT id FROM chat_message WHERE categoryID = $1 ORDER BY id DESC LIMIT 1 OFFSET $2
+		);`
+	if _, err := tx.ExecContext(ctx, query, message.CategoryID, keep); err != nil {
+		return 0, fmt.Errorf("repository: create chat message: prune query - %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("repository: create chat message: commit - %w", err)
+	}
+	return id, nil
+}
+
+// GetChatMessages returns the latest messages of the chat room of a category, oldest first.
+func (r *ChatRepository) GetChatMessages(categoryId, limit int) ([]model.ChatMessage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	query := `SELECT * FROM (
+			SELECT chat_message.id, chat_message.categoryID, user.username, chat_message.content, chat_message.creation_time
+			FROM chat_message INNER JOIN user ON user.id = chat_message.userID
+			WHERE chat_message.categoryID = $1 ORDER BY chat_message.id DESC LIMIT $2
+		) ORDER BY id ASC;`
+	rows, err := r.db.QueryContext(ctx, query, categoryId, limit)
+	if err != nil {
+		return nil, fmt.Errorf("repository: get chat messages: query - %w", err)
+	}
+	defer rows.Close()
+
+	var messages []model.ChatMessage
+	for rows.Next() {
+		var message model.ChatMessage
+		if err := rows.Scan(&message.ID, &message.CategoryID, &message.Author, &message.Content, &message.CreationTime); err != nil {
+			return nil, fmt.Errorf("repository: get chat messages: scan - %w", err)
+		}
+		messages = append(messages, message)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
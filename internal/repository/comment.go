@@ -10,9 +10,11 @@ import (
 )
 
 type Commentary interface {
-	CreateCommentary(comment model.Commentary) error
+	CreateCommentary(comment model.Commentary) (int, error)
 	GetCommentaryByID(id int) (model.Commentary, error)
-	GetCommentariesByPostID(postId int) ([]model.Commentary, error)
+	GetCommentariesByPostID(postId int, cursor model.Cursor, limit int) ([]model.Commentary, error)
+	UpdateCommentary(comment model.Commentary) error
+	DeleteCommentary(id int) error
 }
 
 type CommentaryRepository struct {
@@ -27,43 +29,127 @@ func newCommentaryRepository(db *sql.DB, cfg *config.Config) *CommentaryReposito
 	}
 }
 
-func (r *CommentaryRepository) CreateCommentary(comment model.Commentary) error {
+func (r *CommentaryRepository) CreateCommentary(comment model.Commentary) (int, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
 	defer cancel()
-	query := `INSERT INTO commentary(postID, author, content) VALUES ($1, $2, $3);`
-	_, err := r.db.ExecContext(ctx, query, comment.PostID, comment.Author, comment.Content)
-	if err != nil {
-		return fmt.Errorf("repository: create commentary: Insert query - %w", err)
+	var parentId sql.NullInt64
+	if comment.ParentID != 0 {
+		parentId = sql.NullInt64{Int64: int64(comment.ParentID), Valid: true}
 	}
-	return nil
+	query := `INSERT INTO commentary(postID, parentID, author, content, creation_time) VALUES ($1, $2, $3, $4, datetime('now','localtime')) RETURNING id;`
+	var id int
+	if err := r.db.QueryRowContext(ctx, query, comment.PostID, parentId, comment.Author, comment.Content).Scan(&id); err != nil {
+		return 0, fmt.Errorf("repository: create commentary: Insert query - %w", err)
+	}
+	return id, nil
 }
 
 func (r *CommentaryRepository) GetCommentaryByID(id int) (model.Commentary, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
 	defer cancel()
-	query := `SELECT id, postID, author FROM commentary WHERE id = $1;`
+	query := `SELECT id, postID, parentID, author, content, likes, dislikes, creation_time, update_time, deleted FROM commentary WHERE id = $1;`
 	var commentary model.Commentary
-	if err := r.db.QueryRowContext(ctx, query, id).Scan(&commentary.ID, &commentary.PostID, &commentary.Author); err != nil {
+	var parentId sql.NullInt64
+	var updateTime sql.NullTime
+	if err := r.db.QueryRowContext(ctx, query, id).Scan(&commentary.ID, &commentary.PostID, &parentId, &commentary.Author, &commentary.Content,
+		&commentary.Likes, &commentary.Dislikes, &commentary.CreationTime, &updateTime, &commentary.Deleted); err != nil {
 		return model.Commentary{}, fmt.Errorf("repository: get commentary: %w", err)
 	}
+	commentary.ParentID = int(parentId.Int64)
+	commentary.UpdateTime = updateTime.Time
 	return commentary, nil
 }
 
-func (r *CommentaryRepository) GetCommentariesByPostID(postId int) ([]model.Commentary, error) {
+// GetCommentariesByPostID returns up to limit top-level commentaries of the post following the cursor
+// (preceding it when going backward), together with all of their replies, ordered by id. A limit
+// below one returns every thread.
+func (r *CommentaryRepository) GetCommentariesByPostID(postId int, cursor model.Cursor, limit int) ([]model.Commentary, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
 	defer cancel()
-	query := `SELECT id, postID, author, content, likes, dislikes FROM commentary WHERE postID = $1;`
-	rows, err := r.db.QueryContext(ctx, query, postId)
+
+	roots := `SELECT id FROM commentary WHERE postID = $1 AND parentID IS NULL`
+	args := []interface{}{postId}
+	order := `ASC`
+	if cursor.ID != 0 {
+		args = append(args, cursor.ID)
+		if cursor.Backward {
+			roots += ` AND id < $2`
+			order = `DESC`
+		} else {
+			roots += ` AND id > $2`
+		}
+	}
+	if limit < 1 {
+		limit = -1
+	}
+	args = append(args, limit)
+	roots += fmt.Sprintf(` ORDER BY id %s LIMIT $%d`, order, len(args))
+
+	query := `WITH RECURSIVE thread(id) AS (
+		SELECT id FROM (` + roots + `)
+		UNION ALL
+		SELECT commentary.id FROM commentary JOIN thread ON commentary.parentID = thread.id
+	)
+	SELECT id, postID, parentID, author, content, likes, dislikes, creation_time, update_time, deleted FROM commentary
+	WHERE id IN (SELECT id FROM thread) ORDER BY id;`
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("repository: get commentaries of the post: query - %w", err)
 	}
+	defer rows.Close()
+
 	var commentaries []model.Commentary
 	for rows.Next() {
 		var commentary model.Commentary
-		if err := rows.Scan(&commentary.ID, &commentary.PostID, &commentary.Author, &commentary.Content, &commentary.Likes, &commentary.Dislikes); err != nil {
+		var parentId sql.NullInt64
+		var updateTime sql.NullTime
+		if err := rows.Scan(&commentary.ID, &commentary.PostID, &parentId, &commentary.Author, &commentary.Content,
+			&commentary.Likes, &commentary.Dislikes, &commentary.CreationTime, &updateTime, &commentary.Deleted); err != nil {
 			return nil, fmt.Errorf("repository: get commentaries of the post: scan - %w", err)
 		}
+		commentary.ParentID = int(parentId.Int64)
+		commentary.UpdateTime = updateTime.Time
 		commentaries = append(commentaries, commentary)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 	return commentaries, nil
 }
+
+func (r *CommentaryRepository) UpdateCommentary(comment model.Commentary) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	query := `UPDATE commentary SET content = $1, update_time = datetime('now','localtime') WHERE id = $2 AND deleted = 0;`
+	res, err := r.db.ExecContext(ctx, query, comment.Content, comment.ID)
+	if err != nil {
+		return fmt.Errorf("repository: update commentary: Update query - %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("repository: update commentary: rows affected - %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("repository: update commentary: %w", sql.ErrNoRows)
+	}
+	return nil
+}
+
+// DeleteCommentary only marks the commentary as deleted and wipes its text, so replies and votes keep pointing at it.
+func (r *CommentaryRepository) DeleteCommentary(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	query := `UPDATE commentary SET content = '', deleted = 1, update_time = datetime('now','localtime') WHERE id = $1;`
+	res, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("repository: delete commentary: Update query - %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("repository: delete commentary: rows affected - %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("repository: delete commentary: %w", sql.ErrNoRows)
+	}
+	return nil
+}
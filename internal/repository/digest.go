@@ -0,0 +1,225 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"forum/internal/config"
+	"forum/internal/model"
+	"time"
+)
+
+type Digest interface {
+	FollowCategory(userId, categoryId int) error
+	UnfollowCategory(userId, categoryId int) error
+	GetFollowedCategories(userId int) ([]model.Category, error)
+	GetDigestSubscription(userId int) (model.DigestSubscription, error)
+	GetDigestSubscriptionByToken(token string) (model.DigestSubscription, error)
+	SetDigestSubscription(subscription model.DigestSubscription) error
+	GetActiveDigests() ([]model.DigestSubscription, error)
+	GetLatestPostID() (int, error)
+	GetDigestPosts(userId, afterPostId, limit int) ([]model.Post, error)
+	MarkDigestSent(userId, lastPostId int, sentTime time.Time) error
+	UnsubscribeDigest(token string) error
+}
+
+type DigestRepository struct {
+	db  *sql.DB
+	cfg *config.Config
+}
+
+func newDigestRepository(db *sql.DB, cfg *config.Config) *DigestRepository {
+	return &DigestRepository{
+		db:  db,
+		cfg: cfg,
+	}
+}
+
+func (r *DigestRepository) FollowCategory(userId, categoryId int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	query := `INSERT INTO category_follow (userID, categoryID) VALUES ($1, $2) ON CONFLICT (userID, categoryID) DO NOTHING;`
+	if _, err := r.db.ExecContext(ctx, query, userId, categoryId); err != nil {
+		return fmt.Errorf("repository: follow category: %w", err)
+	}
+	return nil
+}
+
+func (r *DigestRepository) UnfollowCategory(userId, categoryId int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	query := `DELETE FROM category_follow WHERE userID = $1 AND categoryID = $2;`
+	if _, err := r.db.ExecContext(ctx, query, userId, categoryId); err != nil {
+		return fmt.Errorf("repository: unfollow category: %w", err)
+	}
+	return nil
+}
+
+func (r *DigestRepository) GetFollowedCategories(userId int) ([]model.Category, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	query := `SELECT category.id, category.slug, category.name, category.description, category.position, category.archived
+		FROM category INNER JOIN category_follow ON category_follow.categoryID = category.id
+		WHERE category_follow.userID = $1 ORDER BY category.position, category.name;`
+	rows, err := r.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, fmt.Errorf("repository: get followed categories: query - %w", err)
+	}
+	defer rows.Close()
+
+	var categories []model.Category
+	for rows.Next() {
+		var category model.Category
+		if err := rows.Scan(&category.ID, &category.Slug, &category.Name, &category.Description, &category.Position, &category.Archived); err != nil {
+			return nil, fmt.Errorf("repository: get followed categories: scan - %w", err)
+		}
+		categories = append(categories, category)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return categories, nil
+}
+
+func (r *DigestRepository) GetDigestSubscription(userId int) (model.DigestSubscription, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	query := `SELECT userID, frequency, token, last_post_id, last_sent FROM digest_subscription WHERE userID = $1;`
+	var subscription model.DigestSubscription
+	if err := r.db.QueryRowContext(ctx, query, userId).Scan(&subscription.UserID, &subscription.Frequency, &subscription.Token,
+		&subscription.LastPostID, &subscription.LastSent); err != nil {
+		return model.DigestSubscription{}, fmt.Errorf("repository: get digest subscription: %w", err)
+	}
+	return subscription, nil
+}
+
+func (r *DigestRepository) GetDigestSubscriptionByToken(token string) (model.DigestSubscription, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	query := `SELECT userID, frequency, token, last_post_id, last_sent FROM digest_subscription WHERE token = $1;`
+	var subscription model.DigestSubscription
+	if err := r.db.QueryRowContext(ctx, query, token).Scan(&subscription.UserID, &subscription.Frequency, &subscription.Token,
+		&subscription.LastPostID, &subscription.LastSent); err != nil {
+		return model.DigestSubscription{}, fmt.Errorf("repository: get digest subscription by token: %w", err)
+	}
+	return subscription, nil
+}
+
+// SetDigestSubscription stores the digest setting of a user. The token of an existing subscription
+// is kept, so links in digests already sent go on working.
+func (r *DigestRepository) SetDigestSubscription(subscription model.DigestSubscription) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	query := `INSERT INTO digest_subscription (userID, frequency, token, last_post_id, last_sent) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (userID) DO UPDATE SET frequency = excluded.frequency, last_post_id = excluded.last_post_id, last_sent = excluded.last_sent;`
+	if _, err := r.db.ExecContext(ctx, query, subscription.UserID, subscription.Frequency, subscription.Token, subscription.LastPostID,
+		subscription.LastSent); err != nil {
+		return fmt.Errorf("repository: set digest subscription: %w", err)
+	}
+	return nil
+}
+
+// GetActiveDigests returns every subscription that is not turned off, with the address and name of
+// its user. Users who have not confirmed their address yet get no digests.
+func (r *DigestRepository) GetActiveDigests() ([]model.DigestSubscription, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	query := `SELECT digest_subscription.userID, user.email, user.username, digest_subscription.frequency, digest_subscription.token,
+			digest_subscription.last_post_id, digest_subscription.last_sent
+		FROM digest_subscription INNER JOIN user ON user.id = digest_subscription.userID
+		WHERE digest_subscription.frequency != $1
+			AND NOT EXISTS (SELECT 1 FROM email_verification WHERE email_verification.userID = user.id);`
+	rows, err := r.db.QueryContext(ctx, query, model.DigestOff)
+	if err != nil {
+		return nil, fmt.Errorf("repository: get active digests: query - %w", err)
+	}
+	defer rows.Close()
+
+	var subscriptions []model.DigestSubscription
+	for rows.Next() {
+		var subscription model.DigestSubscription
+		if err := rows.Scan(&subscription.UserID, &subscription.Email, &subscription.Username, &subscription.Frequency, &subscription.Token,
+			&subscription.LastPostID, &subscription.LastSent); err != nil {
+			return nil, fmt.Errorf("repository: get active digests: scan - %w", err)
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return subscriptions, nil
+}
+
+func (r *DigestRepository) GetLatestPostID() (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	query := `SELECT IFNULL(MAX(id), 0) FROM post;`
+	var id int
+	if err := r.db.QueryRowContext(ctx, query).Scan(&id); err != nil {
+		return 0, fmt.Errorf("repository: get latest post id: %w", err)
+	}
+	return id, nil
+}
+
+// GetDigestPosts returns up to limit posts newer than afterPostId in the categories a user follows,
+// oldest first.
+func (r *DigestRepository) GetDigestPosts(userId, afterPostId, limit int) ([]model.Post, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	query := `SELECT post.id, post.author, post.title, post.creation_time FROM post
+		WHERE post.id > $1 AND EXISTS (
+			SELECT 1 FROM post_category
+			INNER JOIN category ON category.slug = post_category.category
+			INNER JOIN category_follow ON category_follow.categoryID = category.id
+			WHERE post_category.postID = post.id AND category_follow.userID = $2
+		)
+		ORDER BY post.id LIMIT $3;`
+	rows, err := r.db.QueryContext(ctx, query, afterPostId, userId, limit)
+	if err != nil {
+		return nil, fmt.Errorf("repository: get digest posts: query - %w", err)
+	}
+	defer rows.Close()
+
+	var posts []model.Post
+	for rows.Next() {
+		var post model.Post
+		if err := rows.Scan(&post.ID, &post.Author, &post.Title, &post.CreationTime); err != nil {
+			return nil, fmt.Errorf("repository: get digest posts: scan - %w", err)
+		}
+		posts = append(posts, post)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+func (r *DigestRepository) MarkDigestSent(userId, lastPostId int, sentTime time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	query := `UPDATE digest_subscription SET last_post_id = $1, last_sent = $2 WHERE userID = $3;`
+	if _, err := r.db.ExecContext(ctx, query, lastPostId, sentTime, userId); err != nil {
+		return fmt.Errorf("repository: mark digest sent: %w", err)
+	}
+	return nil
+}
+
+// UnsubscribeDigest turns off the subscription with the given token. It fails with sql.ErrNoRows
+// when no subscription has it.
+func (r *DigestRepository) UnsubscribeDigest(token string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	query := `UPDATE digest_subscription SET frequency = $1 WHERE token = $2;`
+	res, err := r.db.ExecContext(ctx, query, model.DigestOff, token)
+	if err != nil {
+		return fmt.Errorf("repository: unsubscribe digest: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("repository: unsubscribe digest: rows affected - %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("repository: unsubscribe digest: %w", sql.ErrNoRows)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"forum/internal/model"
+	"testing"
+	"time"
+)
+
+func TestGetActiveDigestsSkipsUnverifiedUsers(t *testing.T) {
+	repo := newTestRepository(t)
+	usernames := createTestUsers(t, repo, 3)
+	frequencies := []model.DigestFrequency{model.DigestDaily, model.DigestDaily, model.DigestOff}
+	for i, username := range usernames {
+		user, err := repo.GetUser(username)
+		if err != nil {
+			t.Fatal(err)
+		}
+		subscription := model.DigestSubscription{UserID: user.ID, Frequency: frequencies[i], Token: username, LastSent: time.Now()}
+		if err := repo.SetDigestSubscription(subscription); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The second user has yet to confirm their address.
+	unverified, err := repo.GetUser(usernames[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	verification := model.EmailVerification{UserID: unverified.ID, TokenHash: "hash", ExpirationTime: time.Now().Add(time.Hour)}
+	if err := repo.SetEmailVerification(verification); err != nil {
+		t.Fatal(err)
+	}
+
+	digests, err := repo.GetActiveDigests()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(digests) != 1 || digests[0].Username != usernames[0] {
+		t.Errorf("got digests %+v, want only %s's", digests, usernames[0])
+	}
+}
@@ -0,0 +1,232 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"forum/internal/config"
+	"forum/internal/model"
+	"time"
+)
+
+type Message interface {
+	CreateMessage(senderId, recipientId int, content string, creationTime time.Time) (int, error)
+	GetConversations(userId int) ([]model.Conversation, error)
+	GetMessages(userId, peerId, limit int) ([]model.Message, error)
+	MarkMessagesRead(userId, peerId int, readTime time.Time) error
+	CountUnreadMessages(userId int) (int, error)
+	BlockUser(blockerId, blockedId int, creationTime time.Time) error
+	UnblockUser(blockerId, blockedId int) error
+	IsBlocked(blockerId, blockedId int) (bool, error)
+	GetBlockedUsers(blockerId int) ([]string, error)
+}
+
+type MessageRepository struct {
+	db  *sql.DB
+	cfg *config.Config
+}
+
+func newMessageRepository(db *sql.DB, cfg *config.Config) *MessageRepository {
+	return &MessageRepository{
+		db:  db,
+		cfg: cfg,
+	}
+}
+
+// conversationUsers orders the ids of two users the way the conversation table stores them.
+func conversationUsers(a, b int) (int, int) {
+	if a > b {
+		return b, a
+	}
+	return a, b
+}
+
+// CreateMessage stores a message, starting the conversation between the two users if it is the
+// first one.
+func (r *MessageRepository) CreateMessage(senderId, recipientId int, content string, creationTime time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("repository: create message: begin tx - %w", err)
+	}
+	defer tx.Rollback()
+
+	userA, userB := conversationUsers(senderId, recipientId)
+	query := `INSERT INTO conversation (userA, userB) VALUES ($1, $2) ON CONFLICT (userA, userB) DO NOTHING;`
+	if _, err := tx.ExecContext(ctx, query, userA, userB); err != nil {
+		return 0, fmt.Errorf("repository: create message: insert conversation query - %w", err)
+	}
+	var conversationId int
+	query = `SELECT id FROM conversation WHERE userA = $1 AND userB = $2;`
+	if err := tx.QueryRowContext(ctx, query, userA, userB).Scan(&conversationId); err != nil {
+		return 0, fmt.Errorf("repository: create message: select conversation query - %w", err)
+	}
+
+	query = `INSERT INTO message (conversationID, senderID, content, creation_time) VALUES ($1, $2, $3, $4) RETURNING id;`
+	var id int
+	if err := tx.QueryRowContext(ctx, query, conversationId, senderId, content, creationTime).Scan(&id); err != nil {
+		return 0, fmt.Errorf("repository: create message: insert message query - %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("repository: create message: commit - %w", err)
+	}
+	return id, nil
+}
+
+// GetConversations lists the conversations of a user with their latest message, most recent first.
+func (r *MessageRepository) GetConversations(userId int) ([]model.Conversation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	query := `SELECT conversation.id, peer.username, message.id, sender.username, message.content, message.creation_time, message.read_time,
+			(SELECT COUNT(*) FROM message AS unread WHERE unread.conversationID = conversation.id AND unread.senderID != $1 AND unread.read_time IS NULL)
+		FROM conversation
+		INNER JOIN user AS peer ON peer.id = CASE WHEN conversation.userA = $1 THEN conversation.userB ELSE conversation.userA END
+		INNER JOIN message ON message.id = (SELECT MAX(id) FROM message WHERE conversationID = conversation.id)
+		INNER JOIN user AS sender ON sender.id = message.senderID
+		WHERE conversation.userA = $1 OR conversation.userB = $1
+		ORDER BY message.id DESC;`
+	rows, err := r.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, fmt.Errorf("repository: get conversations: query - %w", err)
+	}
+	defer rows.Close()
+
+	var conversations []model.Conversation
+	for rows.Next() {
+		var conversation model.Conversation
+		var readTime sql.NullTime
+		message := &conversation.LastMessage
+		if err := rows.Scan(&conversation.ID, &conversation.Peer, &message.ID, &message.Sender, &message.Content, &message.CreationTime, &readTime, &conversation.Unread); err != nil {
+			return nil, fmt.Errorf("repository: get conversations: scan - %w", err)
+		}
+		message.ConversationID = conversation.ID
+		message.ReadTime = readTime.Time
+		conversations = append(conversations, conversation)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return conversations, nil
+}
+
+// GetMessages returns the latest messages between two users, oldest first.
+func (r *MessageRepository) GetMessages(userId, peerId, limit int) ([]model.Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	userA, userB := conversationUsers(userId, peerId)
+	query := `SELECT * FROM (
+			SELECT message.id, message.conversationID, user.username, message.content, message.creation_time, message.read_time
+			FROM message
+			INNER JOIN conversation ON conversation.id = message.conversationID
+			INNER JOIN user ON user.id = message.senderID
+			WHERE conversation.userA = $1 AND conversation.userB = $2
+			ORDER BY message.id DESC LIMIT $3
+		) ORDER BY id;`
+	rows, err := r.db.QueryContext(ctx, query, userA, userB, limit)
+	if err != nil {
+		return nil, fmt.Errorf("repository: get messages: query - %w", err)
+	}
+	defer rows.Close()
+
+	var messages []model.Message
+	for rows.Next() {
+		var message model.Message
+		var readTime sql.NullTime
+		if err := rows.Scan(&message.ID, &message.ConversationID, &message.Sender, &message.Content, &message.CreationTime, &readTime); err != nil {
+			return nil, fmt.Errorf("repository: get messages: scan - %w", err)
+		}
+		message.ReadTime = readTime.Time
+		messages = append(messages, message)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// MarkMessagesRead marks everything peer sent to user as read.
+func (r *MessageRepository) MarkMessagesRead(userId, peerId int, readTime time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	userA, userB := conversationUsers(userId, peerId)
+	query := `UPDATE message SET read_time = $1
+		WHERE conversationID = (SELECT id FROM conversation WHERE userA = $2 AND userB = $3) AND senderID = $4 AND read_time IS NULL;`
+	if _, err := r.db.ExecContext(ctx, query, readTime, userA, userB, peerId); err != nil {
+		return fmt.Errorf("repository: mark messages read: %w", err)
+	}
+	return nil
+}
+
+func (r *MessageRepository) CountUnreadMessages(userId int) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	query := `SELECT COUNT(*) FROM message
+		INNER JOIN conversation ON conversation.id = message.conversationID
+		WHERE (conversation.userA = $1 OR conversation.userB = $1) AND message.senderID != $1 AND message.read_time IS NULL;`
+	var count int
+	if err := r.db.QueryRowContext(ctx, query, userId).Scan(&count); err != nil {
+		return 0, fmt.Errorf("repository: count unread messages: %w", err)
+	}
+	return count, nil
+}
+
+func (r *MessageRepository) BlockUser(blockerId, blockedId int, creationTime time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	query := `INSERT INTO user_block (blockerID, blockedID, creation_time) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING;`
+	if _, err := r.db.ExecContext(ctx, query, blockerId, blockedId, creationTime); err != nil {
+		return fmt.Errorf("repository: block user: %w", err)
+	}
+	return nil
+}
+
+func (r *MessageRepository) UnblockUser(blockerId, blockedId int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	query := `DELETE FROM user_block WHERE blockerID = $1 AND blockedID = $2;`
+	if _, err := r.db.ExecContext(ctx, query, blockerId, blockedId); err != nil {
+		return fmt.Errorf("repository: unblock user: %w", err)
+	}
+	return nil
+}
+
+func (r *MessageRepository) IsBlocked(blockerId, blockedId int) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	query := `SELECT 1 FROM user_block WHERE blockerID = $1 AND blockedID = $2;`
+	var found int
+	if err := r.db.QueryRowContext(ctx, query, blockerId, blockedId).Scan(&found); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, fmt.Errorf("repository: is blocked: %w", err)
+	}
+	return true, nil
+}
+
+func (r *MessageRepository) GetBlockedUsers(blockerId int) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	query := `SELECT user.username FROM user_block INNER JOIN user ON user.id = user_block.blockedID
+		WHERE user_block.blockerID = $1 ORDER BY user.username;`
+	rows, err := r.db.QueryContext(ctx, query, blockerId)
+	if err != nil {
+		return nil, fmt.Errorf("repository: get blocked users: query - %w", err)
+	}
+	defer rows.Close()
+
+	var usernames []string
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			return nil, fmt.Errorf("repository: get blocked users: scan - %w", err)
+		}
+		usernames = append(usernames, username)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return usernames, nil
+}
@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"forum/internal/config"
+	"forum/internal/model"
+	"time"
+)
+
+type Notification interface {
+	CreateNotification(notification model.Notification) error
+	GetNotifications(userId, limit int) ([]model.Notification, error)
+	CountUnreadNotifications(userId int) (int, error)
+	MarkNotificationsRead(userId int, readTime time.Time) error
+	GetNotificationPreferences(userId int) (map[model.NotificationKind]bool, error)
+	SetNotificationPreference(userId int, kind model.NotificationKind, enabled bool) error
+}
+
+type NotificationRepository struct {
+	db  *sql.DB
+	cfg *config.Config
+}
+
+func newNotificationRepository(db *sql.DB, cfg *config.Config) *NotificationRepository {
+	return &NotificationRepository{
+		db:  db,
+		cfg: cfg,
+	}
+}
+
+// CreateNotification stores a notification unless the same one was stored before, read or not, so
+// liking a post, taking the like back and liking it again only notifies once.
+func (r *NotificationRepository) CreateNotification(notification model.Notification) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	query := `INSERT INTO notification (userID, actor, kind, postID, commentaryID, creation_time)
+		SELECT $1, $2, $3, $4, $5, $6
+		WHERE NOT EXISTS (SELECT 1 FROM notification WHERE userID = $1 AND actor = $2 AND kind = $3 AND postID = $4 AND commentaryID = $5);`
+	_, err := r.db.ExecContext(ctx, query, notification.UserID, notification.Actor, notification.Kind, notification.PostID, notification.CommentID, notification.CreationTime)
+	if err != nil {
+		return fmt.Errorf("repository: create notification: %w", err)
+	}
+	return nil
+}
+
+// GetNotifications returns the latest notifications of a user, newest first.
+func (r *NotificationRepository) GetNotifications(userId, limit int) ([]model.Notification, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	query := `SELECT notification.id, notification.userID, notification.actor, notification.kind, notification.postID, IFNULL(post.title, ''),
+			notification.commentaryID, notification.creation_time, notification.read_time
+		FROM notification LEFT JOIN post ON post.id = notification.postID
+		WHERE notification.userID = $1 ORDER BY notification.id DESC LIMIT $2;`
+	rows, err := r.db.QueryContext(ctx, query, userId, limit)
+	if err != nil {
+		return nil, fmt.Errorf("repository: get notifications: query - %w", err)
+	}
+	defer rows.Close()
+
+	var notifications []model.Notification
+	for rows.Next() {
+		var notification model.Notification
+		var readTime sql.NullTime
+		if err := rows.Scan(&notification.ID, &notification.UserID, &notification.Actor, &notification.Kind, &notification.PostID, &notification.PostTitle,
+			&notification.CommentID, &notification.CreationTime, &readTime); err != nil {
+			return nil, fmt.Errorf("repository: get notifications: scan - %w", err)
+		}
+		notification.ReadTime = readTime.Time
+		notifications = append(notifications, notification)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return notifications, nil
+}
+
+func (r *NotificationRepository) CountUnreadNotifications(userId int) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	query := `SELECT COUNT(*) FROM notification WHERE userID = $1 AND read_time IS NULL;`
+	var count int
+	if err := r.db.QueryRowContext(ctx, query, userId).Scan(&count); err != nil {
+		return 0, fmt.Errorf("repository: count unread notifications: %w", err)
+	}
+	return count, nil
+}
+
+func (r *NotificationRepository) MarkNotificationsRead(userId int, readTime time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	query := `UPDATE notification SET read_time = $1 WHERE userID = $2 AND read_time IS NULL;`
+	if _, err := r.db.ExecContext(ctx, query, readTime, userId); err != nil {
+		return fmt.Errorf("repository: mark notifications read: %w", err)
+	}
+	return nil
+}
+
+// GetNotificationPreferences returns the kinds a user turned on or off. Kinds never changed are
+// missing from the map.
+func (r *NotificationRepository) GetNotificationPreferences(userId int) (map[model.NotificationKind]bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	query := `SELECT kind, enabled FROM notification_preference WHERE userID = $1;`
+	rows, err := r.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, fmt.Errorf("repository: get notification preferences: query - %w", err)
+	}
+	defer rows.Close()
+
+	preferences := make(map[model.NotificationKind]bool)
+	for rows.Next() {
+		var kind model.NotificationKind
+		var enabled bool
+		if err := rows.Scan(&kind, &enabled); err != nil {
+			return nil, fmt.Errorf("repository: get notification preferences: scan - %w", err)
+		}
+		preferences[kind] = enabled
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return preferences, nil
+}
+
+func (r *NotificationRepository) SetNotificationPreference(userId int, kind model.NotificationKind, enabled bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	query := `INSERT INTO notification_preference (userID, kind, enabled) VALUES ($1, $2, $3)
+		ON CONFLICT (userID, kind) DO UPDATE SET enabled = excluded.enabled;`
+	if _, err := r.db.ExecContext(ctx, query, userId, kind, enabled); err != nil {
+		return fmt.Errorf("repository: set notification preference: %w", err)
+	}
+	return nil
+}
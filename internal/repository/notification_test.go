@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"forum/internal/model"
+	"testing"
+	"time"
+)
+
+func TestCreateNotificationOnlyOnce(t *testing.T) {
+	repo := newTestRepository(t)
+	usernames := createTestUsers(t, repo, 2)
+	author, err := repo.GetUser(usernames[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	postId, err := repo.CreatePost(model.Post{Author: author.Username, Title: "post", Content: "content"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	like := model.Notification{UserID: author.ID, Actor: usernames[1], Kind: model.NotifyPostLike, PostID: postId, CreationTime: time.Now()}
+
+	if err := repo.CreateNotification(like); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.MarkNotificationsRead(author.ID, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	// The like is taken back and given again after the author saw it.
+	if err := repo.CreateNotification(like); err != nil {
+		t.Fatal(err)
+	}
+
+	notifications, err := repo.GetNotifications(author.ID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notifications) != 1 {
+		t.Errorf("got %d notifications, want 1", len(notifications))
+	}
+}
@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"forum/internal/config"
+	"forum/internal/model"
+	"time"
+)
+
+type Outbox interface {
+	EnqueueMail(mail model.OutgoingMail) error
+	GetDueMail(now time.Time, limit int) ([]model.OutgoingMail, error)
+	MarkMailSent(id int, sentTime time.Time) error
+	MarkMailFailed(id, attempts int, nextAttempt time.Time, lastError string) error
+	DeleteFinishedMail(finishedBefore time.Time) (int, error)
+}
+
+type OutboxRepository struct {
+	db  *sql.DB
+	cfg *config.Config
+}
+
+func newOutboxRepository(db *sql.DB, cfg *config.Config) *OutboxRepository {
+	return &OutboxRepository{
+		db:  db,
+		cfg: cfg,
+	}
+}
+
+// EnqueueMail queues mail to be sent from its NextAttempt on.
+func (r *OutboxRepository) EnqueueMail(mail model.OutgoingMail) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	headers, err := json.Marshal(mail.Headers)
+	if err != nil {
+		return fmt.Errorf("repository: enqueue mail: headers - %w", err)
+	}
+	query := `INSERT INTO mail_outbox (recipient, subject, text_body, html_body, headers, next_attempt, creation_time) VALUES ($1, $2, $3, $4, $5, $6, $7);`
+	if _, err := r.db.ExecContext(ctx, query, mail.To, mail.Subject, mail.Text, mail.HTML, string(headers), mail.NextAttempt, mail.CreationTime); err != nil {
+		return fmt.Errorf("repository: enqueue mail: %w", err)
+	}
+	return nil
+}
+
+// GetDueMail returns up to limit messages whose next attempt is due at now, the longest waiting first.
+func (r *OutboxRepository) GetDueMail(now time.Time, limit int) ([]model.OutgoingMail, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	query := `SELECT id, recipient, subject, text_body, html_body, headers, attempts, next_attempt, last_error, creation_time FROM mail_outbox
+		WHERE next_attempt IS NOT NULL AND next_attempt <= $1 ORDER BY next_attempt LIMIT $2;`
+	rows, err := r.db.QueryContext(ctx, query, now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("repository: get due mail: query - %w", err)
+	}
+	defer rows.Close()
+
+	var mails []model.OutgoingMail
+	for rows.Next() {
+		var mail model.OutgoingMail
+		var headers string
+		if err := rows.Scan(&mail.ID, &mail.To, &mail.Subject, &mail.Text, &mail.HTML, &headers, &mail.Attempts, &mail.NextAttempt, &mail.LastError,
+			&mail.CreationTime); err != nil {
+			return nil, fmt.Errorf("repository: get due mail: scan - %w", err)
+		}
+		if err := json.Unmarshal([]byte(headers), &mail.Headers); err != nil {
+			return nil, fmt.Errorf("repository: get due mail: headers - %w", err)
+		}
+		mails = append(mails, mail)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return mails, nil
+}
+
+// MarkMailSent records a message as sent. Its bodies and headers are dropped, as they hold links
+// with tokens in them that are of no more use to anyone.
+func (r *OutboxRepository) MarkMailSent(id int, sentTime time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	query := `UPDATE mail_outbox SET attempts = attempts + 1, next_attempt = NULL, last_error = '', sent_time = $1,
+		text_body = '', html_body = '', headers = '{}' WHERE id = $2;`
+	if _, err := r.db.ExecContext(ctx, query, sentTime, id); err != nil {
+		return fmt.Errorf("repository: mark mail sent: %w", err)
+	}
+	return nil
+}
+
+// MarkMailFailed records a failed attempt. A zero nextAttempt gives up on the message, dropping its
+// bodies and headers as MarkMailSent does.
+func (r *OutboxRepository) MarkMailFailed(id, attempts int, nextAttempt time.Time, lastError string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	var next sql.NullTime
+	if !nextAttempt.IsZero() {
+		next = sql.NullTime{Time: nextAttempt, Valid: true}
+	}
+	query := `UPDATE mail_outbox SET attempts = $1, next_attempt = $2, last_error = $3,
+		text_body = CASE WHEN $2 IS NULL THEN '' ELSE text_body END,
+		html_body = CASE WHEN $2 IS NULL THEN '' ELSE html_body END,
+		headers = CASE WHEN $2 IS NULL THEN '{}' ELSE headers END
+		WHERE id = $4;`
+	if _, err := r.db.ExecContext(ctx, query, attempts, next, lastError, id); err != nil {
+		return fmt.Errorf("repository: mark mail failed: %w", err)
+	}
+	return nil
+}
+
+// DeleteFinishedMail deletes the messages sent or given up on before finishedBefore, and tells how
+// many there were. Messages given up on count as finished when they were queued.
+func (r *OutboxRepository) DeleteFinishedMail(finishedBefore time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	query := `DELETE FROM mail_outbox WHERE next_attempt IS NULL AND COALESCE(sent_time, creation_time) < $1;`
+	res, err := r.db.ExecContext(ctx, query, finishedBefore)
+	if err != nil {
+		return 0, fmt.Errorf("repository: delete finished mail: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("repository: delete finished mail: rows affected - %w", err)
+	}
+	return int(n), nil
+}
@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"forum/internal/model"
+	"testing"
+	"time"
+)
+
+func TestOutboxDropsFinishedMail(t *testing.T) {
+	db := newTestDB(t)
+	repo := newOutboxRepository(db, testConfig())
+	now := time.Now()
+	for _, to := range []string{"sent@example.com", "failed@example.com", "pending@example.com"} {
+		mail := model.OutgoingMail{To: to, Subject: "subject", Text: "text", HTML: "html", Headers: map[string]string{"X": "y"},
+			NextAttempt: now, CreationTime: now.Add(-48 * time.Hour)}
+		if err := repo.EnqueueMail(mail); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.MarkMailSent(1, now.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.MarkMailFailed(2, 8, time.Time{}, "550 no such user"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.MarkMailFailed(3, 1, now.Add(time.Hour), "451 try again"); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := db.Query(`SELECT recipient, text_body, html_body, headers FROM mail_outbox ORDER BY id;`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var to, text, html, headers string
+		if err := rows.Scan(&to, &text, &html, &headers); err != nil {
+			t.Fatal(err)
+		}
+		kept := to == "pending@example.com"
+		if (text != "") != kept || (html != "") != kept || (headers != "{}") != kept {
+			t.Errorf("%s: bodies %q, %q and headers %q; kept %t", to, text, html, headers, kept)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The failed message counts as finished when it was queued, two days ago; the sent one an hour ago.
+	if n, err := repo.DeleteFinishedMail(now.Add(-24 * time.Hour)); err != nil || n != 1 {
+		t.Errorf("deleted %d, %v, want the failed mail", n, err)
+	}
+	if n, err := repo.DeleteFinishedMail(now.Add(-time.Minute)); err != nil || n != 1 {
+		t.Errorf("deleted %d, %v, want the sent mail", n, err)
+	}
+	due, err := repo.GetDueMail(now.Add(2*time.Hour), 10)
+	if err != nil || len(due) != 1 || due[0].Text != "text" || due[0].Headers["X"] != "y" {
+		t.Errorf("due %+v, %v, want the pending mail whole", due, err)
+	}
+}
@@ -3,216 +3,635 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"forum/internal/config"
 	"forum/internal/model"
+	"log"
+	"strconv"
+	"strings"
 	"time"
 )
 
 type Post interface {
-	CreatePost(post model.Post) error
-	GetAllPosts() ([]model.Post, error)
+	CreatePost(post model.Post) (int, error)
+	GetPosts(filter model.PostFilter) ([]model.Post, error)
 	GetPostByID(postId int) (model.Post, error)
-	GetPostsByCategory(category string) ([]model.Post, error)
-	GetNewestPosts() ([]model.Post, error)
-	GetOldestPosts() ([]model.Post, error)
-	GetMostLikedPosts() ([]model.Post, error)
-	GetMostDislikedPosts() ([]model.Post, error)
-	GetCategoriesByPostID(postId int) ([]string, error)
+	GetCategoriesByPostID(postId int) ([]model.Category, error)
+	GetCategoriesByPostIDs(postIds []int) (map[int][]model.Category, error)
+	GetImagesByPostID(postId int) ([]model.Image, error)
+	ImageKeysInUse(keys []string) (map[string]bool, error)
+	UpdatePost(post model.Post, revision model.PostRevision) error
+	DeletePost(postId int, author string) error
+	GetRevisionsByPostID(postId int) ([]model.PostRevision, error)
+	SetRevisionDiff(revision model.PostRevision) error
+	Search(query model.SearchQuery) ([]model.SearchResult, error)
 }
 type PostRepository struct {
 	db  *sql.DB
 	cfg *config.Config
+	// fts tells whether the search index is an FTS5 table, or the plain table searched with LIKE.
+	fts bool
 }
 
 func newPostRepository(db *sql.DB, cfg *config.Config) *PostRepository {
+	fts, err := fts5Available(db)
+	if err != nil {
+		log.Printf("repository: search falls back to LIKE: %v", err)
+	}
 	return &PostRepository{
 		db:  db,
 		cfg: cfg,
+		fts: fts,
 	}
 }
 
-func (r *PostRepository) CreatePost(post model.Post) error {
+// CreatePost stores a post with its categories and images in one transaction, so a failure leaves
+// none of it behind.
+func (r *PostRepository) CreatePost(post model.Post) (int, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
 	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("repository: create post: begin tx - %w", err)
+	}
+	defer tx.Rollback()
+
 	query := `INSERT INTO post (author, title, content) VALUES ($1, $2, $3) RETURNING id;`
 	var id int
-	if err := r.db.QueryRowContext(ctx, query, post.Author, post.Title, post.Content).Scan(&id); err != nil {
-		return fmt.Errorf("repository: create post: Insert post query %w", err)
+	if err := tx.QueryRowContext(ctx, query, post.Author, post.Title, post.Content).Scan(&id); err != nil {
+		return 0, fmt.Errorf("repository: create post: Insert post query %w", err)
 	}
 	query = `UPDATE user SET posts = posts + 1 WHERE username = $1;`
-	_, err := r.db.ExecContext(ctx, query, post.Author)
-	if err != nil {
-		return fmt.Errorf("repository: create post: Update post query - %w", err)
+	if _, err := tx.ExecContext(ctx, query, post.Author); err != nil {
+		return 0, fmt.Errorf("repository: create post: Update post query - %w", err)
 	}
 
 	query = `INSERT INTO post_category (postId, category) VALUES ($1, $2);`
 	for _, category := range post.Category {
-		_, err := r.db.ExecContext(ctx, query, id, category)
+		_, err := tx.ExecContext(ctx, query, id, category.Slug)
 		if err != nil {
-			return fmt.Errorf("repository: create post: Insert category query - %w", err)
+			return 0, fmt.Errorf("repository: create post: Insert category query - %w", err)
 		}
 	}
-	return nil
+
+	query = `INSERT INTO post_image (postID, image_key, thumb_key, content_type, width, height, size) VALUES ($1, $2, $3, $4, $5, $6, $7);`
+	for _, image := range post.Images {
+		_, err := tx.ExecContext(ctx, query, id, image.Key, image.ThumbKey, image.ContentType, image.Width, image.Height, image.Size)
+		if err != nil {
+			return 0, fmt.Errorf("repository: create post: Insert image query - %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("repository: create post: commit - %w", err)
+	}
+	return id, nil
+}
+
+// SQLiteTimeFormat matches the text datetime('now','localtime') stores, so it compares correctly against it.
+const SQLiteTimeFormat = "2006-01-02 15:04:05"
+
+const commentCountColumn = `(SELECT COUNT(*) FROM commentary WHERE commentary.postID = post.id AND commentary.deleted = 0)`
+
+// updateTimeColumn is when a post was last edited, which is when its latest revision was saved, or
+// an empty string for a post never edited.
+const updateTimeColumn = `COALESCE((SELECT MAX(revision_time) FROM post_revision WHERE post_revision.postID = post.id), '')`
+
+func parseUpdateTime(post *model.Post, updateTime string) error {
+	if updateTime == "" {
+		return nil
+	}
+	var err error
+	post.UpdateTime, err = time.Parse(SQLiteTimeFormat, updateTime)
+	return err
+}
+
+type postSortColumn struct {
+	column  string
+	desc    bool
+	numeric bool
+}
+
+// postSortColumns lists what each sort orders by; post.id always follows as the tie-breaker.
+var postSortColumns = map[model.PostSort]postSortColumn{
+	model.SortNew:       {column: `post.creation_time`, desc: true},
+	model.SortOld:       {column: `post.creation_time`},
+	model.SortLiked:     {column: `post.likes`, desc: true, numeric: true},
+	model.SortDisliked:  {column: `post.dislikes`, desc: true, numeric: true},
+	model.SortCommented: {column: commentCountColumn, desc: true, numeric: true},
 }
 
-func (r *PostRepository) GetAllPosts() ([]model.Post, error) {
+// GetPosts returns the posts matching every condition set in filter, in a single query.
+func (r *PostRepository) GetPosts(filter model.PostFilter) ([]model.Post, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
 	defer cancel()
-	query := `SELECT id, author, title, content, creation_time, likes, dislikes FROM post;`
-	rows, err := r.db.QueryContext(ctx, query)
+
+	var conditions []string
+	var args []interface{}
+	addCondition := func(condition string, values ...interface{}) {
+		placeholders := make([]interface{}, len(values))
+		for i, value := range values {
+			args = append(args, value)
+			placeholders[i] = fmt.Sprintf("$%d", len(args))
+		}
+		conditions = append(conditions, fmt.Sprintf(condition, placeholders...))
+	}
+
+	if len(filter.Categories) != 0 {
+		values := make([]interface{}, len(filter.Categories))
+		for i, category := range filter.Categories {
+			values[i] = category
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("%s, ", len(values)), ", ")
+		addCondition(`post.id IN (SELECT postID FROM post_category WHERE category IN (`+placeholders+`))`, values...)
+	}
+	if filter.Author != "" {
+		addCondition(`post.author = %s`, filter.Author)
+	}
+	if filter.LikedBy != "" {
+		addCondition(`post.id IN (SELECT postID FROM likes WHERE username = %s)`, filter.LikedBy)
+	}
+	if filter.DislikedBy != "" {
+		addCondition(`post.id IN (SELECT postID FROM dislikes WHERE username = %s)`, filter.DislikedBy)
+	}
+	if filter.CommentedBy != "" {
+		addCondition(`post.id IN (SELECT postID FROM commentary WHERE author = %s AND deleted = 0)`, filter.CommentedBy)
+	}
+	if !filter.From.IsZero() {
+		addCondition(`post.creation_time >= %s`, filter.From.Format(SQLiteTimeFormat))
+	}
+	if !filter.To.IsZero() {
+		addCondition(`post.creation_time < %s`, filter.To.AddDate(0, 0, 1).Format(SQLiteTimeFormat))
+	}
+	if filter.HasMinScore {
+		addCondition(`post.likes - post.dislikes >= %s`, filter.MinScore)
+	}
+
+	sort, ok := postSortColumns[filter.Sort]
+	if !ok {
+		sort = postSortColumns[model.SortNew]
+	}
+
+	// Going backward walks the order in reverse from the cursor; the rows are flipped back below.
+	desc := sort.desc != filter.Cursor.Backward
+	if filter.Cursor.ID != 0 {
+		var key interface{} = filter.Cursor.Key
+		if sort.numeric {
+			n, err := strconv.Atoi(filter.Cursor.Key)
+			if err != nil {
+				return nil, fmt.Errorf("repository: get posts: cursor key - %w", err)
+			}
+			key = n
+		}
+		op := ">"
+		if desc {
+			op = "<"
+		}
+		addCondition(`(`+sort.column+` `+op+` %s OR (`+sort.column+` = %s AND post.id `+op+` %s))`, key, key, filter.Cursor.ID)
+	}
+
+	direction := ` ASC`
+	if desc {
+		direction = ` DESC`
+	}
+
+	query := `SELECT post.id, post.author, post.title, post.content, post.creation_time, post.likes, post.dislikes, ` + commentCountColumn + `, ` +
+		updateTimeColumn + ` FROM post`
+	if len(conditions) != 0 {
+		query += ` WHERE ` + strings.Join(conditions, ` AND `)
+	}
+	query += ` ORDER BY ` + sort.column + direction + `, post.id` + direction
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(` LIMIT $%d`, len(args))
+	}
+	query += `;`
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("repository: get all posts: query - %w", err)
+		return nil, fmt.Errorf("repository: get posts: query - %w", err)
 	}
 	defer rows.Close()
 
 	var allPosts []model.Post
 	for rows.Next() {
 		var post model.Post
-		if err := rows.Scan(&post.ID, &post.Author, &post.Title, &post.Content, &post.CreationTime, &post.Likes, &post.Dislikes); err != nil {
-			return nil, fmt.Errorf("repository: get all posts: scan - %w", err)
+		var updateTime string
+		if err := rows.Scan(&post.ID, &post.Author, &post.Title, &post.Content, &post.CreationTime, &post.Likes, &post.Dislikes, &post.Comments, &updateTime); err != nil {
+			return nil, fmt.Errorf("repository: get posts: scan - %w", err)
+		}
+		if err := parseUpdateTime(&post, updateTime); err != nil {
+			return nil, fmt.Errorf("repository: get posts: update time - %w", err)
 		}
 		allPosts = append(allPosts, post)
 	}
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
+	if filter.Cursor.Backward {
+		for i, j := 0, len(allPosts)-1; i < j; i, j = i+1, j-1 {
+			allPosts[i], allPosts[j] = allPosts[j], allPosts[i]
+		}
+	}
 	return allPosts, nil
 }
 
 func (r *PostRepository) GetPostByID(postId int) (model.Post, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
 	defer cancel()
-	query := `SELECT id, author, title, content, creation_time, likes, dislikes FROM post WHERE id = $1;`
+	query := `SELECT id, author, title, content, creation_time, likes, dislikes, ` + commentCountColumn + `, ` + updateTimeColumn + ` FROM post WHERE id = $1;`
 	var post model.Post
-	if err := r.db.QueryRowContext(ctx, query, postId).Scan(&post.ID, &post.Author, &post.Title, &post.Content, &post.CreationTime, &post.Likes, &post.Dislikes); err != nil {
+	var updateTime string
+	if err := r.db.QueryRowContext(ctx, query, postId).Scan(&post.ID, &post.Author, &post.Title, &post.Content, &post.CreationTime, &post.Likes, &post.Dislikes, &post.Comments, &updateTime); err != nil {
 		return model.Post{}, fmt.Errorf("repository: get post by id: %w", err)
 	}
+	if err := parseUpdateTime(&post, updateTime); err != nil {
+		return model.Post{}, fmt.Errorf("repository: get post by id: update time - %w", err)
+	}
 	return post, nil
 }
 
-func (r *PostRepository) GetPostsByCategory(category string) ([]model.Post, error) {
+// postCategoryColumns reads a category of a post. Categories missing from the category table are
+// shown by their stored value.
+const postCategoryColumns = `post_category.postID, COALESCE(category.id, 0), post_category.category, COALESCE(category.name, post_category.category),
+	COALESCE(category.description, ''), COALESCE(category.position, 0), COALESCE(category.archived, 0)`
+
+const postCategoryJoin = `post_category LEFT JOIN category ON category.slug = post_category.category`
+
+func (r *PostRepository) GetCategoriesByPostID(postId int) ([]model.Category, error) {
+	categories, err := r.GetCategoriesByPostIDs([]int{postId})
+	if err != nil {
+		return nil, err
+	}
+	return categories[postId], nil
+}
+
+// GetCategoriesByPostIDs loads the categories of many posts in one query, keyed by post id.
+func (r *PostRepository) GetCategoriesByPostIDs(postIds []int) (map[int][]model.Category, error) {
+	categories := make(map[int][]model.Category, len(postIds))
+	if len(postIds) == 0 {
+		return categories, nil
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
 	defer cancel()
-	query := `SELECT id, author, title, content, creation_time, likes, dislikes FROM post WHERE id IN (SELECT postId FROM post_category WHERE category = $1);`
-	rows, err := r.db.QueryContext(ctx, query, category)
+	placeholders := make([]string, len(postIds))
+	args := make([]interface{}, len(postIds))
+	for i, id := range postIds {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = id
+	}
+	query := `SELECT ` + postCategoryColumns + ` FROM ` + postCategoryJoin + `
+		WHERE post_category.postID IN (` + strings.Join(placeholders, ", ") + `) ORDER BY post_category.rowid;`
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("repository: get post by category: query - %w", err)
+		return nil, fmt.Errorf("repository: get categories of the posts: query - %w", err)
 	}
 	defer rows.Close()
 
-	var allPosts []model.Post
 	for rows.Next() {
-		var post model.Post
-		if err := rows.Scan(&post.ID, &post.Author, &post.Title, &post.Content, &post.CreationTime, &post.Likes, &post.Dislikes); err != nil {
-			return nil, fmt.Errorf("repository: get post by category: scan - %w", err)
+		var postId int
+		var category model.Category
+		if err := rows.Scan(&postId, &category.ID, &category.Slug, &category.Name, &category.Description, &category.Position, &category.Archived); err != nil {
+			return nil, fmt.Errorf("repository: get categories of the posts: scan - %w", err)
 		}
-		allPosts = append(allPosts, post)
+		categories[postId] = append(categories[postId], category)
 	}
-	return allPosts, nil
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return categories, nil
 }
 
-func (r *PostRepository) GetNewestPosts() ([]model.Post, error) {
+func (r *PostRepository) GetImagesByPostID(postId int) ([]model.Image, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
 	defer cancel()
-	query := `SELECT id, author, title, content, creation_time, likes, dislikes FROM post ORDER BY creation_time DESC;`
-	rows, err := r.db.QueryContext(ctx, query)
+	query := `SELECT id, postID, image_key, thumb_key, content_type, width, height, size FROM post_image WHERE postID = $1 ORDER BY id;`
+	rows, err := r.db.QueryContext(ctx, query, postId)
 	if err != nil {
-		return nil, fmt.Errorf("repository: get newest post: query - %w", err)
+		return nil, fmt.Errorf("repository: get images of the post: query - %w", err)
 	}
 	defer rows.Close()
 
-	var allPosts []model.Post
+	var images []model.Image
 	for rows.Next() {
-		var post model.Post
-		if err := rows.Scan(&post.ID, &post.Author, &post.Title, &post.Content, &post.CreationTime, &post.Likes, &post.Dislikes); err != nil {
-			return nil, fmt.Errorf("repository: get newest post: scan - %w", err)
+		var image model.Image
+		if err := rows.Scan(&image.ID, &image.PostID, &image.Key, &image.ThumbKey, &image.ContentType, &image.Width, &image.Height, &image.Size); err != nil {
+			return nil, fmt.Errorf("repository: get images of the post: scan - %w", err)
 		}
-		allPosts = append(allPosts, post)
+		images = append(images, image)
 	}
-	return allPosts, nil
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return images, nil
 }
 
-func (r *PostRepository) GetOldestPosts() ([]model.Post, error) {
+// ImageKeysInUse tells which of the storage keys an image or thumbnail of some post still uses.
+// Posts attaching the same file share its key.
+func (r *PostRepository) ImageKeysInUse(keys []string) (map[string]bool, error) {
+	used := make(map[string]bool)
+	if len(keys) == 0 {
+		return used, nil
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
 	defer cancel()
-	query := `SELECT id, author, title, content, creation_time, likes, dislikes FROM post ORDER BY creation_time;`
-	rows, err := r.db.QueryContext(ctx, query)
+	placeholders := make([]string, len(keys))
+	args := make([]interface{}, len(keys))
+	for i, key := range keys {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = key
+	}
+	list := strings.Join(placeholders, ", ")
+	query := `SELECT image_key FROM post_image WHERE image_key IN (` + list + `)
+		UNION SELECT thumb_key FROM post_image WHERE thumb_key IN (` + list + `);`
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("repository: get oldest post: query - %w", err)
+		return nil, fmt.Errorf("repository: image keys in use: query - %w", err)
 	}
 	defer rows.Close()
 
-	var allPosts []model.Post
 	for rows.Next() {
-		var post model.Post
-		if err := rows.Scan(&post.ID, &post.Author, &post.Title, &post.Content, &post.CreationTime, &post.Likes, &post.Dislikes); err != nil {
-			return nil, fmt.Errorf("repository: get oldest post: scan - %w", err)
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, fmt.Errorf("repository: image keys in use: scan - %w", err)
 		}
-		allPosts = append(allPosts, post)
+		used[key] = true
 	}
-	return allPosts, nil
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return used, nil
 }
 
-func (r *PostRepository) GetMostLikedPosts() ([]model.Post, error) {
+func (r *PostRepository) UpdatePost(post model.Post, revision model.PostRevision) error {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
 	defer cancel()
-	query := `SELECT id, author, title, content, creation_time, likes, dislikes FROM post ORDER BY likes DESC;`
-	rows, err := r.db.QueryContext(ctx, query)
+	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
-		return nil, fmt.Errorf("repository: get liked post: query - %w", err)
+		return fmt.Errorf("repository: update post: begin tx - %w", err)
 	}
-	defer rows.Close()
+	defer tx.Rollback()
 
-	var allPosts []model.Post
-	for rows.Next() {
-		var post model.Post
-		if err := rows.Scan(&post.ID, &post.Author, &post.Title, &post.Content, &post.CreationTime, &post.Likes, &post.Dislikes); err != nil {
-			return nil, fmt.Errorf("repository: get liked post: scan - %w", err)
+	diff, err := json.Marshal(revisionDiffOf(revision))
+	if err != nil {
+		return fmt.Errorf("repository: update post: diff - %w", err)
+	}
+	query := `INSERT INTO post_revision (postID, title, content, categories, editor, diff) VALUES ($1, $2, $3, $4, $5, $6);`
+	if _, err := tx.ExecContext(ctx, query, revision.PostID, revision.Title, revision.Content, strings.Join(revision.Category, ","), revision.Editor, diff); err != nil {
+		return fmt.Errorf("repository: update post: Insert revision query - %w", err)
+	}
+
+	query = `UPDATE post SET title = $1, content = $2 WHERE id = $3;`
+	if _, err := tx.ExecContext(ctx, query, post.Title, post.Content, post.ID); err != nil {
+		return fmt.Errorf("repository: update post: Update post query - %w", err)
+	}
+
+	query = `DELETE FROM post_category WHERE postID = $1;`
+	if _, err := tx.ExecContext(ctx, query, post.ID); err != nil {
+		return fmt.Errorf("repository: update post: Delete category query - %w", err)
+	}
+
+	query = `INSERT INTO post_category (postId, category) VALUES ($1, $2);`
+	for _, category := range post.Category {
+		if _, err := tx.ExecContext(ctx, query, post.ID, category.Slug); err != nil {
+			return fmt.Errorf("repository: update post: Insert category query - %w", err)
 		}
-		allPosts = append(allPosts, post)
 	}
-	return allPosts, nil
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("repository: update post: commit - %w", err)
+	}
+	return nil
 }
 
-func (r *PostRepository) GetMostDislikedPosts() ([]model.Post, error) {
+func (r *PostRepository) DeletePost(postId int, author string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
 	defer cancel()
-	query := `SELECT id, author, title, content, creation_time, likes, dislikes FROM post ORDER BY dislikes DESC;`
-	rows, err := r.db.QueryContext(ctx, query)
+	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
-		return nil, fmt.Errorf("repository: get disliked post: query - %w", err)
+		return fmt.Errorf("repository: delete post: begin tx - %w", err)
+	}
+	defer tx.Rollback()
+
+	// What hangs off the post, its comments and their votes included, goes with it through ON DELETE
+	// CASCADE and the notification trigger.
+	res, err := tx.ExecContext(ctx, `DELETE FROM post WHERE id = $1;`, postId)
+	if err != nil {
+		return fmt.Errorf("repository: delete post: Delete post query - %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("repository: delete post: rows affected - %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("repository: delete post: %w", sql.ErrNoRows)
+	}
+
+	query := `UPDATE user SET posts = posts - 1 WHERE username = $1 AND posts > 0;`
+	if _, err := tx.ExecContext(ctx, query, author); err != nil {
+		return fmt.Errorf("repository: delete post: Update user query - %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("repository: delete post: commit - %w", err)
+	}
+	return nil
+}
+
+func (r *PostRepository) GetRevisionsByPostID(postId int) ([]model.PostRevision, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	query := `SELECT id, postID, title, content, categories, editor, revision_time, diff FROM post_revision WHERE postID = $1 ORDER BY id;`
+	rows, err := r.db.QueryContext(ctx, query, postId)
+	if err != nil {
+		return nil, fmt.Errorf("repository: get revisions of the post: query - %w", err)
 	}
 	defer rows.Close()
 
-	var allPosts []model.Post
+	var revisions []model.PostRevision
 	for rows.Next() {
-		var post model.Post
-		if err := rows.Scan(&post.ID, &post.Author, &post.Title, &post.Content, &post.CreationTime, &post.Likes, &post.Dislikes); err != nil {
-			return nil, fmt.Errorf("repository: get disliked post: scan - %w", err)
+		var revision model.PostRevision
+		var categories string
+		var diff sql.NullString
+		if err := rows.Scan(&revision.ID, &revision.PostID, &revision.Title, &revision.Content, &categories, &revision.Editor, &revision.RevisionTime, &diff); err != nil {
+			return nil, fmt.Errorf("repository: get revisions of the post: scan - %w", err)
 		}
-		allPosts = append(allPosts, post)
+		if categories != "" {
+			revision.Category = strings.Split(categories, ",")
+		}
+		if diff.Valid {
+			var stored revisionDiff
+			if err := json.Unmarshal([]byte(diff.String), &stored); err != nil {
+				return nil, fmt.Errorf("repository: get revisions of the post: diff - %w", err)
+			}
+			revision.TitleDiff, revision.ContentDiff, revision.CategoryDiff = stored.Title, stored.Content, stored.Category
+		}
+		revisions = append(revisions, revision)
 	}
-	return allPosts, nil
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return revisions, nil
 }
 
-func (r *PostRepository) GetCategoriesByPostID(postId int) ([]string, error) {
+// SetRevisionDiff stores the diffs of a revision saved before they were.
+func (r *PostRepository) SetRevisionDiff(revision model.PostRevision) error {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
 	defer cancel()
-	query := `SELECT category FROM post_category WHERE postID = $1;`
-	rows, err := r.db.QueryContext(ctx, query, postId)
+	diff, err := json.Marshal(revisionDiffOf(revision))
 	if err != nil {
-		return nil, fmt.Errorf("repository: get categories of the post: query - %w", err)
+		return fmt.Errorf("repository: set revision diff: %w", err)
+	}
+	if _, err := r.db.ExecContext(ctx, `UPDATE post_revision SET diff = $1 WHERE id = $2;`, diff, revision.ID); err != nil {
+		return fmt.Errorf("repository: set revision diff: %w", err)
+	}
+	return nil
+}
+
+// revisionDiff is how the diffs of a revision are stored, as JSON.
+type revisionDiff struct {
+	Title    []model.DiffLine `json:"title"`
+	Content  []model.DiffLine `json:"content"`
+	Category []model.DiffLine `json:"category"`
+}
+
+func revisionDiffOf(revision model.PostRevision) revisionDiff {
+	return revisionDiff{Title: revision.TitleDiff, Content: revision.ContentDiff, Category: revision.CategoryDiff}
+}
+
+const (
+	snippetMatchStart = "\x02"
+	snippetMatchEnd   = "\x03"
+)
+
+func (r *PostRepository) Search(query model.SearchQuery) ([]model.SearchResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+
+	// Placeholders are numbered in the order they appear in the statement, as SQLite binds them that way.
+	var args []interface{}
+	var match string
+	if r.fts {
+		match = ftsMatchExpression(query.Terms)
+	}
+	snippet := `substr(search_index.content, 1, 200)`
+	order := `search_index.rowid DESC`
+	if match != "" {
+		args = append(args, snippetMatchStart, snippetMatchEnd)
+		snippet = `snippet(search_index, -1, $1, $2, '...', 24)`
+		order = `rank`
+	}
+
+	var conditions []string
+	if match != "" {
+		args = append(args, match)
+		conditions = append(conditions, fmt.Sprintf("search_index MATCH $%d", len(args)))
+	}
+	if !r.fts {
+		for _, pattern := range likePatterns(query.Terms) {
+			args = append(args, pattern)
+			conditions = append(conditions, fmt.Sprintf(`(search_index.title LIKE $%[1]d ESCAPE '\' OR search_index.content LIKE $%[1]d ESCAPE '\')`, len(args)))
+		}
+	}
+	if query.Author != "" {
+		args = append(args, query.Author)
+		conditions = append(conditions, fmt.Sprintf("search_index.author = $%d", len(args)))
+	}
+	if query.Category != "" {
+		args = append(args, query.Category)
+		conditions = append(conditions, fmt.Sprintf("search_index.postID IN (SELECT postID FROM post_category WHERE category = $%d COLLATE NOCASE)", len(args)))
+	}
+	if len(conditions) == 0 {
+		return nil, nil
+	}
+	args = append(args, query.Limit)
+
+	sqlQuery := fmt.Sprintf(`SELECT search_index.kind, search_index.refID, search_index.postID, search_index.author, post.title, %s
+		FROM search_index INNER JOIN post ON post.id = search_index.postID
+		WHERE %s ORDER BY %s LIMIT $%d;`, snippet, strings.Join(conditions, " AND "), order, len(args))
+	rows, err := r.db.QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("repository: search: query - %w", err)
 	}
 	defer rows.Close()
 
-	var allCategories []string
+	var results []model.SearchResult
 	for rows.Next() {
-		var category string
-		if err := rows.Scan(&category); err != nil {
-			return nil, fmt.Errorf("repository: get categories of the post: scan - %w", err)
+		var result model.SearchResult
+		var refId int
+		var snippet string
+		if err := rows.Scan(&result.Kind, &refId, &result.PostID, &result.Author, &result.Title, &snippet); err != nil {
+			return nil, fmt.Errorf("repository: search: scan - %w", err)
+		}
+		if result.Kind == "commentary" {
+			result.CommentaryID = refId
+		}
+		result.Snippet = splitSnippet(snippet)
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// ftsMatchExpression quotes every term so user input can never be read as FTS5 query syntax.
+// A trailing '*' is kept outside the quotes and turns the term into a prefix query.
+func ftsMatchExpression(terms []string) string {
+	var parts []string
+	for _, term := range terms {
+		prefix := strings.HasSuffix(term, "*")
+		term = strings.TrimRight(term, "*")
+		if strings.TrimSpace(term) == "" {
+			continue
+		}
+		part := `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+		if prefix {
+			part += "*"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, " ")
+}
+
+// likePatterns turns terms into LIKE patterns finding them anywhere, for searching without FTS5.
+// Every term is a prefix there already, so a trailing '*' is dropped.
+func likePatterns(terms []string) []string {
+	escape := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	var patterns []string
+	for _, term := range terms {
+		term = strings.TrimRight(term, "*")
+		if strings.TrimSpace(term) == "" {
+			continue
+		}
+		patterns = append(patterns, "%"+escape.Replace(term)+"%")
+	}
+	return patterns
+}
+
+func splitSnippet(snippet string) []model.SnippetPart {
+	var parts []model.SnippetPart
+	for snippet != "" {
+		start := strings.Index(snippet, snippetMatchStart)
+		if start == -1 {
+			parts = append(parts, model.SnippetPart{Text: snippet})
+			break
+		}
+		if start > 0 {
+			parts = append(parts, model.SnippetPart{Text: snippet[:start]})
+		}
+		snippet = snippet[start+len(snippetMatchStart):]
+
+		end := strings.Index(snippet, snippetMatchEnd)
+		if end == -1 {
+			parts = append(parts, model.SnippetPart{Text: snippet, Match: true})
+			break
 		}
-		allCategories = append(allCategories, category)
+		parts = append(parts, model.SnippetPart{Text: snippet[:end], Match: true})
+		snippet = snippet[end+len(snippetMatchEnd):]
 	}
-	return allCategories, nil
+	return parts
 }
@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"forum/internal/model"
+	"testing"
+)
+
+func TestDeletePostTakesEverythingUnderIt(t *testing.T) {
+	db := newTestDB(t)
+	repo := NewRepository(db, testConfig())
+	users := createTestUsers(t, repo, 2)
+	post := model.Post{
+		Author:   users[0],
+		Title:    "post",
+		Content:  "content",
+		Category: []model.Category{{Slug: "alem"}},
+		Images:   []model.Image{{Key: "image.png", ThumbKey: "thumb.png", ContentType: "image/png", Width: 1, Height: 1, Size: 1}},
+	}
+	postId, err := repo.CreatePost(post)
+	if err != nil {
+		t.Fatal(err)
+	}
+	post.ID, post.Content = postId, "edited"
+	if err := repo.UpdatePost(post, model.PostRevision{PostID: postId, Title: "post", Content: "content", Editor: users[0]}); err != nil {
+		t.Fatal(err)
+	}
+	commentId, err := repo.CreateCommentary(model.Commentary{PostID: postId, Author: users[1], Content: "comment"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.LikePost(postId, users[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.DislikeCommentary(commentId, users[0]); err != nil {
+		t.Fatal(err)
+	}
+	owner, err := repo.GetUser(users[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.CreateNotification(model.Notification{UserID: owner.ID, Actor: users[1], Kind: model.NotifyPostLike, PostID: postId}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repo.DeletePost(postId, users[0]); err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []string{"post", "post_category", "post_image", "post_revision", "commentary", "likes", "dislikes", "notification"} {
+		var rows int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM ` + table + `;`).Scan(&rows); err != nil {
+			t.Fatal(err)
+		}
+		if rows != 0 {
+			t.Errorf("%d rows left in %s", rows, table)
+		}
+	}
+	if owner, err := repo.GetUser(users[0]); err != nil || owner.Posts != 0 {
+		t.Errorf("author has %d posts, %v; want 0", owner.Posts, err)
+	}
+}
@@ -7,20 +7,34 @@ import (
 
 type Repository struct {
 	Auth
+	APIToken
 	Post
 	Commentary
 	VotePost
 	VoteComment
 	User
+	Category
+	Message
+	Notification
+	Chat
+	Outbox
+	Digest
 }
 
 func NewRepository(db *sql.DB, cfg *config.Config) *Repository {
 	return &Repository{
-		Auth:        newAuthRepository(db, cfg),
-		Post:        newPostRepository(db, cfg),
-		Commentary:  newCommentaryRepository(db, cfg),
-		VotePost:    newVotePostRepository(db, cfg),
-		VoteComment: newVoteCommentaryRepository(db, cfg),
-		User:        newUserRepository(db, cfg),
+		Auth:         newAuthRepository(db, cfg),
+		APIToken:     newAPITokenRepository(db, cfg),
+		Post:         newPostRepository(db, cfg),
+		Commentary:   newCommentaryRepository(db, cfg),
+		VotePost:     newVotePostRepository(db, cfg),
+		VoteComment:  newVoteCommentaryRepository(db, cfg),
+		User:         newUserRepository(db, cfg),
+		Category:     newCategoryRepository(db, cfg),
+		Message:      newMessageRepository(db, cfg),
+		Notification: newNotificationRepository(db, cfg),
+		Chat:         newChatRepository(db, cfg),
+		Outbox:       newOutboxRepository(db, cfg),
+		Digest:       newDigestRepository(db, cfg),
 	}
 }
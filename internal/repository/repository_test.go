@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"forum/internal/config"
+	"forum/internal/model"
+	"strings"
+	"testing"
+)
+
+// newTestDB opens a fresh in-memory database with every table created.
+func newTestDB(t testing.TB) *sql.DB {
+	t.Helper()
+	name := strings.NewReplacer("/", "_", " ", "_").Replace(t.Name())
+	db, err := sql.Open("sqlite3", withForeignKeys("file:"+name+"?mode=memory&cache=shared"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The in-memory database lives as long as one connection to it stays open.
+	db.SetMaxIdleConns(1)
+	db.SetConnMaxLifetime(0)
+	t.Cleanup(func() { db.Close() })
+	if err := CreateTables(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// newTestRepository builds the repository on a fresh in-memory database.
+func newTestRepository(t testing.TB) *Repository {
+	t.Helper()
+	return NewRepository(newTestDB(t), testConfig())
+}
+
+func testConfig() *config.Config {
+	cfg := &config.Config{}
+	cfg.Db.CtxTimeout = 5
+	return cfg
+}
+
+func createTestUsers(t testing.TB, repo *Repository, n int) []string {
+	t.Helper()
+	usernames := make([]string, n)
+	for i := range usernames {
+		usernames[i] = fmt.Sprintf("user%d", i)
+		user := model.User{Email: usernames[i] + "@example.com", Username: usernames[i], Password: "password"}
+		if err := repo.CreateUser(user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return usernames
+}
@@ -2,7 +2,11 @@ package repository
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
 	"forum/internal/config"
+	"forum/internal/model"
+	"strings"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -14,9 +18,179 @@ const (
 			username TEXT UNIQUE,
 			password TEXT,
 			posts INT DEFAULT 0,
+			role INT DEFAULT 1,
+			skeleton TEXT,
+			capitals_skeleton TEXT
+		);`
+
+	// userSkeletonIndex keeps two usernames from reading the same, the way model.UsernameSkeletons
+	// tells it.
+	userSkeletonIndex = `CREATE UNIQUE INDEX IF NOT EXISTS user_skeleton ON user (skeleton);
+		CREATE UNIQUE INDEX IF NOT EXISTS user_capitals_skeleton ON user (capitals_skeleton);`
+
+	// sessionTable holds who is signed in where. Like personal access tokens, session tokens are only
+	// kept as their SHA-256 hash.
+	sessionTable = `CREATE TABLE IF NOT EXISTS session (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			userID INTEGER,
+			token_hash TEXT,
+			user_agent TEXT,
+			ip TEXT,
+			creation_time DATETIME,
+			last_seen DATETIME,
+			expiration_time DATETIME,
+			FOREIGN KEY (userID) REFERENCES user(id) ON DELETE CASCADE
+		);`
+
+	sessionTokenIndex = `CREATE UNIQUE INDEX IF NOT EXISTS session_token_hash ON session (token_hash);`
+
+	// apiTokenTable holds personal access tokens. Only a SHA-256 hash of each token is kept, along
+	// with its last characters so the owner can tell their tokens apart.
+	apiTokenTable = `CREATE TABLE IF NOT EXISTS api_token (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			userID INTEGER,
+			name TEXT,
+			hint TEXT,
+			token_hash TEXT UNIQUE,
+			scopes INT,
+			creation_time DATETIME,
+			last_used DATETIME,
+			FOREIGN KEY (userID) REFERENCES user(id) ON DELETE CASCADE
+		);`
+
+	// emailVerificationTable holds the accounts whose email address is not confirmed yet: an account
+	// is verified once it has no row here. Only a SHA-256 hash of the emailed token is kept.
+	emailVerificationTable = `CREATE TABLE IF NOT EXISTS email_verification (
+			userID INTEGER PRIMARY KEY,
+			token_hash TEXT UNIQUE,
+			expiration_time DATETIME,
+			last_sent DATETIME,
+			creation_time DATETIME,
+			FOREIGN KEY (userID) REFERENCES user(id) ON DELETE CASCADE
+		);`
+
+	// passwordResetTable holds the password reset link last sent to each user, by the SHA-256 hash
+	// of its token. A link is forgotten once used.
+	passwordResetTable = `CREATE TABLE IF NOT EXISTS password_reset (
+			userID INTEGER PRIMARY KEY,
+			token_hash TEXT UNIQUE,
+			expiration_time DATETIME,
+			creation_time DATETIME,
+			FOREIGN KEY (userID) REFERENCES user(id) ON DELETE CASCADE
+		);`
+
+	// conversationTable holds one row per pair of users who exchanged messages, with the lower user
+	// id always in userA so a pair can only appear once.
+	conversationTable = `CREATE TABLE IF NOT EXISTS conversation (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			userA INTEGER,
+			userB INTEGER,
+			UNIQUE (userA, userB),
+			FOREIGN KEY (userA) REFERENCES user(id) ON DELETE CASCADE,
+			FOREIGN KEY (userB) REFERENCES user(id) ON DELETE CASCADE
+		);`
+
+	messageTable = `CREATE TABLE IF NOT EXISTS message (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			conversationID INTEGER,
+			senderID INTEGER,
+			content TEXT,
+			creation_time DATETIME,
+			read_time DATETIME,
+			FOREIGN KEY (conversationID) REFERENCES conversation(id) ON DELETE CASCADE,
+			FOREIGN KEY (senderID) REFERENCES user(id) ON DELETE CASCADE
+		);`
+
+	messageIndex = `CREATE INDEX IF NOT EXISTS message_conversation ON message (conversationID, read_time);`
+
+	// userBlockTable records who refuses messages from whom.
+	userBlockTable = `CREATE TABLE IF NOT EXISTS user_block (
+			blockerID INTEGER,
+			blockedID INTEGER,
+			creation_time DATETIME,
+			PRIMARY KEY (blockerID, blockedID),
+			FOREIGN KEY (blockerID) REFERENCES user(id) ON DELETE CASCADE,
+			FOREIGN KEY (blockedID) REFERENCES user(id) ON DELETE CASCADE
+		);`
+
+	notificationTable = `CREATE TABLE IF NOT EXISTS notification (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			userID INTEGER,
+			actor TEXT,
+			kind TEXT,
+			postID INTEGER,
+			commentaryID INTEGER,
+			creation_time DATETIME,
+			read_time DATETIME,
+			FOREIGN KEY (userID) REFERENCES user(id) ON DELETE CASCADE
+		);`
+
+	notificationIndex = `CREATE INDEX IF NOT EXISTS notification_user ON notification (userID, read_time);`
+
+	// notificationPostDeleteTrigger does for notifications what ON DELETE CASCADE does for the other
+	// tables under a post. A foreign key cannot be added to the notification tables already there.
+	notificationPostDeleteTrigger = `CREATE TRIGGER IF NOT EXISTS notification_post_delete AFTER DELETE ON post BEGIN
+			DELETE FROM notification WHERE postID = OLD.id;
+		END;`
+
+	// notificationPreferenceTable keeps the kinds of notification a user turned on or off. Kinds
+	// without a row are on.
+	notificationPreferenceTable = `CREATE TABLE IF NOT EXISTS notification_preference (
+			userID INTEGER,
+			kind TEXT,
+			enabled INT,
+			PRIMARY KEY (userID, kind),
+			FOREIGN KEY (userID) REFERENCES user(id) ON DELETE CASCADE
+		);`
+
+	// chatMessageTable keeps the latest messages of each category chat room, for people joining it.
+	chatMessageTable = `CREATE TABLE IF NOT EXISTS chat_message (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			categoryID INTEGER,
+			userID INTEGER,
+			content TEXT,
+			creation_time DATETIME,
+			FOREIGN KEY (categoryID) REFERENCES category(id) ON DELETE CASCADE,
+			FOREIGN KEY (userID) REFERENCES user(id) ON DELETE CASCADE
+		);`
+
+	chatMessageIndex = `CREATE INDEX IF NOT EXISTS chat_message_category ON chat_message (categoryID, id);`
 
-			token TEXT DEFAULT NULL,
-			expiration_time DATETIME DEFAULT NULL
+	// mailOutboxTable queues outgoing email. A message is pending while next_attempt is set, sent once
+	// sent_time is, and given up on when neither is.
+	mailOutboxTable = `CREATE TABLE IF NOT EXISTS mail_outbox (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			recipient TEXT,
+			subject TEXT,
+			text_body TEXT,
+			html_body TEXT,
+			headers TEXT,
+			attempts INT DEFAULT 0,
+			next_attempt DATETIME,
+			last_error TEXT DEFAULT '',
+			creation_time DATETIME,
+			sent_time DATETIME
+		);`
+
+	mailOutboxIndex = `CREATE INDEX IF NOT EXISTS mail_outbox_next_attempt ON mail_outbox (next_attempt);`
+
+	categoryFollowTable = `CREATE TABLE IF NOT EXISTS category_follow (
+			userID INTEGER,
+			categoryID INTEGER,
+			PRIMARY KEY (userID, categoryID),
+			FOREIGN KEY (userID) REFERENCES user(id) ON DELETE CASCADE,
+			FOREIGN KEY (categoryID) REFERENCES category(id) ON DELETE CASCADE
+		);`
+
+	// digestSubscriptionTable holds how often each user wants a digest of the categories they follow.
+	// Users without a row get none.
+	digestSubscriptionTable = `CREATE TABLE IF NOT EXISTS digest_subscription (
+			userID INTEGER PRIMARY KEY,
+			frequency TEXT,
+			token TEXT UNIQUE,
+			last_post_id INTEGER,
+			last_sent DATETIME,
+			FOREIGN KEY (userID) REFERENCES user(id) ON DELETE CASCADE
 		);`
 
 	postTable = `CREATE TABLE IF NOT EXISTS post (
@@ -31,22 +205,132 @@ const (
 			FOREIGN KEY (author) REFERENCES user(username)
 		);`
 
+	postImageTable = `CREATE TABLE IF NOT EXISTS post_image (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			postID INTEGER,
+			image_key TEXT,
+			thumb_key TEXT,
+			content_type TEXT,
+			width INT,
+			height INT,
+			size INT,
+			FOREIGN KEY (postID) REFERENCES post(id) ON DELETE CASCADE
+		);`
+
+	categoryTable = `CREATE TABLE IF NOT EXISTS category (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			slug TEXT UNIQUE NOT NULL,
+			name TEXT NOT NULL,
+			description TEXT DEFAULT '',
+			position INT DEFAULT 0,
+			archived INT DEFAULT 0
+		);`
+
+	// categorySeed adds the categories the forum started with. Slugs already present are left alone,
+	// so renaming or archiving one sticks across restarts.
+	categorySeed = `INSERT OR IGNORE INTO category (slug, name, position) VALUES
+			('alem', 'Alem', 1), ('study', 'Study', 2), ('teamalem', 'Teamalem', 3), ('linkedin', 'Linkedin', 4), ('offtop', 'Offtop', 5);`
+
+	// postCategoryMigration rewrites categories stored by name, as they were before the category
+	// table existed, into slugs. Rows already holding a slug are never touched.
+	postCategoryMigration = `UPDATE post_category SET category = (SELECT slug FROM category WHERE category.name = post_category.category)
+		WHERE category NOT IN (SELECT slug FROM category) AND category IN (SELECT name FROM category);`
+
 	postCategoryTable = `CREATE TABLE IF NOT EXISTS post_category (
 			postID INTEGER,
 			category TEXT,
 			FOREIGN KEY (postID) REFERENCES post(id) ON DELETE CASCADE
 		);`
 
+	postRevisionTable = `CREATE TABLE IF NOT EXISTS post_revision (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			postID INTEGER,
+			title TEXT,
+			content TEXT,
+			categories TEXT,
+			editor TEXT,
+			revision_time DATETIME DEFAULT (datetime('now','localtime')),
+			diff TEXT DEFAULT NULL,
+			FOREIGN KEY (postID) REFERENCES post(id) ON DELETE CASCADE
+		);`
+
 	commentTable = `CREATE TABLE IF NOT EXISTS commentary (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			postID INTEGER,
+			parentID INTEGER DEFAULT NULL,
 			author TEXT,
 			content TEXT,
 			likes INT DEFAULT 0,
 			dislikes INT DEFAULT 0,
-			FOREIGN KEY (postID) REFERENCES post(id) ON DELETE CASCADE
+			creation_time DATETIME DEFAULT (datetime('now','localtime')),
+			update_time DATETIME DEFAULT NULL,
+			deleted INT DEFAULT 0,
+			FOREIGN KEY (postID) REFERENCES post(id) ON DELETE CASCADE,
+			FOREIGN KEY (parentID) REFERENCES commentary(id) ON DELETE CASCADE
+		);`
+
+	// searchIndexTable holds one row per post and per commentary. Rowids are derived from the source
+	// ids (posts even, commentaries odd) so the triggers below can keep it in sync cheaply.
+	searchIndexTable = `CREATE VIRTUAL TABLE IF NOT EXISTS search_index USING fts5(
+			kind UNINDEXED,
+			refID UNINDEXED,
+			postID UNINDEXED,
+			author UNINDEXED,
+			title,
+			content,
+			tokenize = 'unicode61 remove_diacritics 2'
 		);`
 
+	// searchIndexFallbackTable stands in for searchIndexTable when SQLite lacks FTS5, as go-sqlite3
+	// does unless built with the sqlite_fts5 tag. It has the same columns, so the triggers keep it in
+	// sync all the same, and is searched with LIKE.
+	searchIndexFallbackTable = `CREATE TABLE IF NOT EXISTS search_index (
+			kind TEXT,
+			refID INTEGER,
+			postID INTEGER,
+			author TEXT,
+			title TEXT,
+			content TEXT
+		);`
+
+	postSearchInsertTrigger = `CREATE TRIGGER IF NOT EXISTS post_search_insert AFTER INSERT ON post BEGIN
+			INSERT INTO search_index (rowid, kind, refID, postID, author, title, content)
+			VALUES (NEW.id * 2, 'post', NEW.id, NEW.id, NEW.author, NEW.title, NEW.content);
+		END;`
+
+	postSearchUpdateTrigger = `CREATE TRIGGER IF NOT EXISTS post_search_update AFTER UPDATE OF title, content ON post BEGIN
+			DELETE FROM search_index WHERE rowid = OLD.id * 2;
+			INSERT INTO search_index (rowid, kind, refID, postID, author, title, content)
+			VALUES (NEW.id * 2, 'post', NEW.id, NEW.id, NEW.author, NEW.title, NEW.content);
+		END;`
+
+	postSearchDeleteTrigger = `CREATE TRIGGER IF NOT EXISTS post_search_delete AFTER DELETE ON post BEGIN
+			DELETE FROM search_index WHERE rowid = OLD.id * 2;
+		END;`
+
+	commentSearchInsertTrigger = `CREATE TRIGGER IF NOT EXISTS commentary_search_insert AFTER INSERT ON commentary BEGIN
+			INSERT INTO search_index (rowid, kind, refID, postID, author, title, content)
+			VALUES (NEW.id * 2 + 1, 'commentary', NEW.id, NEW.postID, NEW.author, '', NEW.content);
+		END;`
+
+	commentSearchUpdateTrigger = `CREATE TRIGGER IF NOT EXISTS commentary_search_update AFTER UPDATE OF content, deleted ON commentary BEGIN
+			DELETE FROM search_index WHERE rowid = OLD.id * 2 + 1;
+			INSERT INTO search_index (rowid, kind, refID, postID, author, title, content)
+			SELECT NEW.id * 2 + 1, 'commentary', NEW.id, NEW.postID, NEW.author, '', NEW.content WHERE NEW.deleted = 0;
+		END;`
+
+	commentSearchDeleteTrigger = `CREATE TRIGGER IF NOT EXISTS commentary_search_delete AFTER DELETE ON commentary BEGIN
+			DELETE FROM search_index WHERE rowid = OLD.id * 2 + 1;
+		END;`
+
+	// searchIndexBackfill indexes rows written before the search index existed.
+	searchIndexBackfill = `INSERT INTO search_index (rowid, kind, refID, postID, author, title, content)
+			SELECT id * 2, 'post', id, id, author, title, content FROM post
+			WHERE id * 2 NOT IN (SELECT rowid FROM search_index)
+		UNION ALL
+			SELECT id * 2 + 1, 'commentary', id, postID, author, '', content FROM commentary
+			WHERE deleted = 0 AND id * 2 + 1 NOT IN (SELECT rowid FROM search_index);`
+
 	likesTable = `CREATE TABLE IF NOT EXISTS likes (
 			username TEXT,
 			postID INTEGER DEFAULT NULL,
@@ -65,7 +349,7 @@ const (
 )
 
 func InitDB(cfg *config.Config) (*sql.DB, error) {
-	db, err := sql.Open(cfg.Db.Driver, cfg.Db.DBName)
+	db, err := sql.Open(cfg.Db.Driver, withForeignKeys(cfg.Db.DBName))
 	if err != nil {
 		return nil, err
 	}
@@ -77,8 +361,32 @@ func InitDB(cfg *config.Config) (*sql.DB, error) {
 	return db, nil
 }
 
+// withForeignKeys adds to a database name the option turning on foreign keys, which SQLite leaves
+// off by default. It is set on every connection the pool opens, so ON DELETE CASCADE always applies.
+func withForeignKeys(dbName string) string {
+	if strings.Contains(dbName, "?") {
+		return dbName + "&_foreign_keys=on"
+	}
+	return dbName + "?_foreign_keys=on"
+}
+
 func CreateTables(db *sql.DB) error {
-	allTables := []string{userTable, postTable, postCategoryTable, commentTable, likesTable, dislikeTable}
+	if err := addColumns(db); err != nil {
+		return err
+	}
+	searchIndex, err := searchIndexStatement(db)
+	if err != nil {
+		return err
+	}
+	allTables := []string{
+		userTable, userSkeletonIndex, sessionTable, sessionTokenIndex, apiTokenTable, emailVerificationTable, passwordResetTable, postTable, categoryTable, categorySeed, postCategoryTable, postCategoryMigration,
+		postImageTable, postRevisionTable, commentTable, likesTable, dislikeTable,
+		conversationTable, messageTable, messageIndex, userBlockTable,
+		notificationTable, notificationIndex, notificationPostDeleteTrigger, notificationPreferenceTable, chatMessageTable, chatMessageIndex,
+		mailOutboxTable, mailOutboxIndex, categoryFollowTable, digestSubscriptionTable,
+		searchIndex, postSearchInsertTrigger, postSearchUpdateTrigger, postSearchDeleteTrigger,
+		commentSearchInsertTrigger, commentSearchUpdateTrigger, commentSearchDeleteTrigger, searchIndexBackfill,
+	}
 	for _, eachTable := range allTables {
 		_, err := db.Exec(eachTable)
 		if err != nil {
@@ -87,3 +395,210 @@ func CreateTables(db *sql.DB) error {
 	}
 	return nil
 }
+
+// fts5Available tells whether SQLite was built with FTS5, which go-sqlite3 only is under the
+// sqlite_fts5 build tag.
+func fts5Available(db *sql.DB) (bool, error) {
+	var used bool
+	if err := db.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5');`).Scan(&used); err != nil {
+		return false, fmt.Errorf("repository: fts5 available: %w", err)
+	}
+	return used, nil
+}
+
+// searchIndexStatement chooses how the search index is created: with FTS5 when SQLite has it, and
+// as a plain table otherwise. A plain index left by a build without FTS5 is replaced, the backfill
+// filling the new one. An FTS5 index cannot be read without FTS5, so that is an error.
+func searchIndexStatement(db *sql.DB) (string, error) {
+	fts, err := fts5Available(db)
+	if err != nil {
+		return "", err
+	}
+	var existing string
+	err = db.QueryRow(`SELECT sql FROM sqlite_master WHERE name = 'search_index';`).Scan(&existing)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("repository: search index: %w", err)
+	}
+	isFTS := strings.Contains(strings.ToLower(existing), "using fts5")
+
+	switch {
+	case fts && existing != "" && !isFTS:
+		if _, err := db.Exec(`DROP TABLE search_index;`); err != nil {
+			return "", fmt.Errorf("repository: search index: drop plain index: %w", err)
+		}
+		return searchIndexTable, nil
+	case fts:
+		return searchIndexTable, nil
+	case isFTS:
+		return "", errors.New("repository: search index: the database has an FTS5 search index, but this build of SQLite lacks FTS5: build with -tags sqlite_fts5")
+	default:
+		return searchIndexFallbackTable, nil
+	}
+}
+
+// addedColumn is a column added to a table after the table first shipped. CREATE TABLE IF NOT
+// EXISTS leaves tables of existing databases as they were, so those get the column through ALTER
+// TABLE instead.
+type addedColumn struct {
+	table      string
+	name       string
+	definition string
+	// backfill, when set, runs once the column is added, to fill it in the rows already there. It is
+	// either an SQL statement or, for what SQL cannot work out, a func(*sql.DB) error.
+	backfill interface{}
+}
+
+var addedColumns = []addedColumn{
+	// Existing accounts are all plain users; auth.admin in the configuration names who administers.
+	{"user", "role", "INT DEFAULT 1", ""},
+	{"commentary", "parentID", "INTEGER DEFAULT NULL REFERENCES commentary(id) ON DELETE CASCADE", ""},
+	// ALTER TABLE cannot add a column defaulting to the current time, so commentaries already there
+	// take the time of their post, and new ones are given theirs by CreateCommentary.
+	{"commentary", "creation_time", "DATETIME DEFAULT NULL",
+		`UPDATE commentary SET creation_time = (SELECT creation_time FROM post WHERE post.id = commentary.postID) WHERE creation_time IS NULL;`},
+	{"commentary", "update_time", "DATETIME DEFAULT NULL", ""},
+	{"commentary", "deleted", "INT DEFAULT 0", ""},
+	{"user", "skeleton", "TEXT", ""},
+	// Once both skeleton columns are there, they are filled in for the usernames already taken.
+	{"user", "capitals_skeleton", "TEXT", backfillUsernameSkeletons},
+	// Revisions saved before their diffs were get them the first time their post is shown.
+	{"post_revision", "diff", "TEXT DEFAULT NULL", ""},
+	// Sessions were stored with their token in plain text. The tokens are hashed in place of it.
+	{"session", "token_hash", "TEXT", hashSessionTokens},
+}
+
+// addColumns adds the columns of addedColumns missing from tables that already exist. Tables that do
+// not exist yet are left to CreateTables, whose statements have every column.
+func addColumns(db *sql.DB) error {
+	for _, column := range addedColumns {
+		columns, err := tableColumns(db, column.table)
+		if err != nil {
+			return err
+		}
+		if len(columns) == 0 || columns[column.name] {
+			continue
+		}
+		if _, err := db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s;`, column.table, column.name, column.definition)); err != nil {
+			return fmt.Errorf("repository: add column %s.%s: %w", column.table, column.name, err)
+		}
+		switch backfill := column.backfill.(type) {
+		case string:
+			if backfill == "" {
+				break
+			}
+			if _, err := db.Exec(backfill); err != nil {
+				return fmt.Errorf("repository: backfill column %s.%s: %w", column.table, column.name, err)
+			}
+		case func(*sql.DB) error:
+			if err := backfill(db); err != nil {
+				return fmt.Errorf("repository: backfill column %s.%s: %w", column.table, column.name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// backfillUsernameSkeletons works out the skeletons of the usernames already taken. A username
+// reading the same as an older one keeps no skeleton, the older one's standing for both.
+func backfillUsernameSkeletons(db *sql.DB) error {
+	rows, err := db.Query(`SELECT id, username FROM user ORDER BY id;`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	usernames := make(map[int]string)
+	var ids []int
+	for rows.Next() {
+		var (
+			id       int
+			username string
+		)
+		if err := rows.Scan(&id, &username); err != nil {
+			return err
+		}
+		usernames[id] = username
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	query := `UPDATE user SET
+			skeleton = CASE WHEN EXISTS (SELECT 1 FROM user WHERE skeleton = $1) THEN NULL ELSE $1 END,
+			capitals_skeleton = CASE WHEN EXISTS (SELECT 1 FROM user WHERE capitals_skeleton = $2) THEN NULL ELSE $2 END
+		WHERE id = $3;`
+	for _, id := range ids {
+		skeleton, capitals := model.UsernameSkeletons(usernames[id])
+		if _, err := tx.Exec(query, skeleton, capitals, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// hashSessionTokens replaces the session tokens stored in plain text with their hash, as the service
+// hashes them, so whoever is signed in stays signed in.
+func hashSessionTokens(db *sql.DB) error {
+	rows, err := db.Query(`SELECT id, token FROM session WHERE token IS NOT NULL;`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	hashes := make(map[int]string)
+	for rows.Next() {
+		var (
+			id    int
+			token string
+		)
+		if err := rows.Scan(&id, &token); err != nil {
+			return err
+		}
+		hashes[id] = model.HashToken(token)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for id, hash := range hashes {
+		if _, err := tx.Exec(`UPDATE session SET token_hash = $1, token = NULL WHERE id = $2;`, hash, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// tableColumns returns the names of the columns of a table, none when the table does not exist.
+func tableColumns(db *sql.DB, table string) (map[string]bool, error) {
+	rows, err := db.Query(fmt.Sprintf(`PRAGMA table_info(%s);`, table))
+	if err != nil {
+		return nil, fmt.Errorf("repository: table info %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			name, kind       string
+			defaultValue     sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &kind, &notNull, &defaultValue, &pk); err != nil {
+			return nil, fmt.Errorf("repository: table info %s: scan - %w", table, err)
+		}
+		columns[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return columns, nil
+}
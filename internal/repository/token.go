@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"forum/internal/config"
+	"forum/internal/model"
+	"time"
+)
+
+type APIToken interface {
+	CreateAPIToken(token model.APIToken, hash string) (int, error)
+	GetAPITokensByUserID(userId int) ([]model.APIToken, error)
+	GetUserByAPITokenHash(hash string) (model.User, time.Time, error)
+	UpdateAPITokenLastUsed(hash string, lastUsed time.Time) error
+	DeleteAPIToken(userId, tokenId int) error
+}
+
+type APITokenRepository struct {
+	db  *sql.DB
+	cfg *config.Config
+}
+
+func newAPITokenRepository(db *sql.DB, cfg *config.Config) *APITokenRepository {
+	return &APITokenRepository{
+		db:  db,
+		cfg: cfg,
+	}
+}
+
+func (r *APITokenRepository) CreateAPIToken(token model.APIToken, hash string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	query := `INSERT INTO api_token (userID, name, hint, token_hash, scopes, creation_time) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id;`
+	var id int
+	if err := r.db.QueryRowContext(ctx, query, token.UserID, token.Name, token.Hint, hash, token.Scopes, token.CreationTime).Scan(&id); err != nil {
+		return 0, fmt.Errorf("repository: create api token: %w", err)
+	}
+	return id, nil
+}
+
+func (r *APITokenRepository) GetAPITokensByUserID(userId int) ([]model.APIToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	query := `SELECT id, userID, name, hint, scopes, creation_time, last_used FROM api_token WHERE userID = $1 ORDER BY creation_time DESC, id DESC;`
+	rows, err := r.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, fmt.Errorf("repository: get api tokens by user id: query - %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []model.APIToken
+	for rows.Next() {
+		var token model.APIToken
+		var lastUsed sql.NullTime
+		if err := rows.Scan(&token.ID, &token.UserID, &token.Name, &token.Hint, &token.Scopes, &token.CreationTime, &lastUsed); err != nil {
+			return nil, fmt.Errorf("repository: get api tokens by user id: scan - %w", err)
+		}
+		token.LastUsed = lastUsed.Time
+		tokens = append(tokens, token)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// GetUserByAPITokenHash returns the owner of a token, with Scopes set to what the token allows, and
+// when the token was last used, which is the zero time if it never was.
+func (r *APITokenRepository) GetUserByAPITokenHash(hash string) (model.User, time.Time, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	query := `SELECT user.id, user.email, user.username, user.posts, user.role, api_token.scopes,
+			NOT EXISTS (SELECT 1 FROM email_verification WHERE email_verification.userID = user.id), api_token.last_used
+		FROM api_token INNER JOIN user ON user.id = api_token.userID WHERE api_token.token_hash = $1;`
+	var user model.User
+	var lastUsed sql.NullTime
+	if err := r.db.QueryRowContext(ctx, query, hash).Scan(&user.ID, &user.Email, &user.Username, &user.Posts, &user.Role, &user.Scopes, &user.Verified, &lastUsed); err != nil {
+		return model.User{}, time.Time{}, fmt.Errorf("repository: get user by api token hash: %w", err)
+	}
+	return user, lastUsed.Time, nil
+}
+
+func (r *APITokenRepository) UpdateAPITokenLastUsed(hash string, lastUsed time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	query := `UPDATE api_token SET last_used = $1 WHERE token_hash = $2;`
+	if _, err := r.db.ExecContext(ctx, query, lastUsed, hash); err != nil {
+		return fmt.Errorf("repository: update api token last used: %w", err)
+	}
+	return nil
+}
+
+func (r *APITokenRepository) DeleteAPIToken(userId, tokenId int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
+	defer cancel()
+	query := `DELETE FROM api_token WHERE id = $1 AND userID = $2;`
+	res, err := r.db.ExecContext(ctx, query, tokenId, userId)
+	if err != nil {
+		return fmt.Errorf("repository: delete api token: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("repository: delete api token: rows affected - %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("repository: delete api token: %w", sql.ErrNoRows)
+	}
+	return nil
+}
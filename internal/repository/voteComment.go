@@ -121,71 +121,50 @@ func (r *VoteCommentaryRepository) CommentaryDisliked(commentaryId int, username
 }
 
 func (r *VoteCommentaryRepository) GetCommentaryLikes(postId int) (map[int][]string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
-	defer cancel()
-	queryForCommentsId := `SELECT id FROM commentary WHERE postID = $1;`
-	queryForUsers := `SELECT username FROM likes WHERE commentaryID = $1;`
-	users := make(map[int][]string)
-	rowsComment, err := r.db.QueryContext(ctx, queryForCommentsId, postId)
+	users, err := r.getCommentaryVoters("likes", postId)
 	if err != nil {
-		return nil, fmt.Errorf("repository: get commentary likes: query for comment - %w", err)
-	}
-	for rowsComment.Next() {
-		var id int
-		if err := rowsComment.Scan(&id); err != nil {
-			if err == sql.ErrNoRows {
-				return nil, nil
-			}
-			return nil, fmt.Errorf("repository: get commentary likes: scan for comment - %w", err)
-		}
-		var usernames []string
-		rowsUsers, err := r.db.QueryContext(ctx, queryForUsers, id)
-		if err != nil {
-			return nil, fmt.Errorf("repository: get commentary likes: query for users - %w", err)
-		}
-		for rowsUsers.Next() {
-			var username string
-			if err := rowsUsers.Scan(&username); err != nil {
-				return nil, fmt.Errorf("repository: get commentary likes: scan for users - %w", err)
-			}
-			usernames = append(usernames, username)
-		}
-		users[id] = usernames
+		return nil, fmt.Errorf("repository: get commentary likes: %w", err)
 	}
 	return users, nil
 }
 
 func (r *VoteCommentaryRepository) GetCommentaryDislikes(postId int) (map[int][]string, error) {
+	users, err := r.getCommentaryVoters("dislikes", postId)
+	if err != nil {
+		return nil, fmt.Errorf("repository: get commentary dislikes: %w", err)
+	}
+	return users, nil
+}
+
+// getCommentaryVoters maps every commentary of the post to the users found for it in table (likes
+// or dislikes), all in one query. Commentaries nobody voted on map to an empty list.
+func (r *VoteCommentaryRepository) getCommentaryVoters(table string, postId int) (map[int][]string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Db.CtxTimeout)*time.Second)
 	defer cancel()
-	queryForCommentsId := `SELECT id FROM commentary WHERE postID = $1;`
-	queryForUsers := `SELECT username FROM dislikes WHERE commentaryID = $1;`
-	users := make(map[int][]string)
-	rowsComment, err := r.db.QueryContext(ctx, queryForCommentsId, postId)
+	query := `SELECT commentary.id, ` + table + `.username FROM commentary
+		LEFT JOIN ` + table + ` ON ` + table + `.commentaryID = commentary.id
+		WHERE commentary.postID = $1 ORDER BY commentary.id, ` + table + `.rowid;`
+	rows, err := r.db.QueryContext(ctx, query, postId)
 	if err != nil {
-		return nil, fmt.Errorf("repository: get commentary dislikes: query for comment - %w", err)
+		return nil, fmt.Errorf("query - %w", err)
 	}
-	for rowsComment.Next() {
+	defer rows.Close()
+
+	users := make(map[int][]string)
+	for rows.Next() {
 		var id int
-		if err := rowsComment.Scan(&id); err != nil {
-			if err == sql.ErrNoRows {
-				return nil, nil
-			}
-			return nil, fmt.Errorf("repository: get commentary dislikes: scan for comment - %w", err)
+		var username sql.NullString
+		if err := rows.Scan(&id, &username); err != nil {
+			return nil, fmt.Errorf("scan - %w", err)
 		}
-		var usernames []string
-		rowsUsers, err := r.db.QueryContext(ctx, queryForUsers, id)
-		if err != nil {
-			return nil, fmt.Errorf("repository: get commentary dislikes: query for users - %w", err)
+		if !username.Valid {
+			users[id] = nil
+			continue
 		}
-		for rowsUsers.Next() {
-			var username string
-			if err := rowsUsers.Scan(&username); err != nil {
-				return nil, fmt.Errorf("repository: get commentary dislikes: scan for users - %w", err)
-			}
-			usernames = append(usernames, username)
-		}
-		users[id] = usernames
+		users[id] = append(users[id], username.String)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
 	return users, nil
 }
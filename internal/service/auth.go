@@ -1,12 +1,18 @@
 package service
 
 import (
+	"context"
+	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"forum/internal/config"
 	"forum/internal/model"
 	"forum/internal/repository"
+	"log"
 	"net/mail"
+	"net/url"
 	"time"
 
 	"github.com/google/uuid"
@@ -20,21 +26,60 @@ var (
 	ErrConfirmPassword     = errors.New("password doesn't match")
 	ErrUserNotFound        = errors.New("user not found")
 	ErrUserExist           = errors.New("user already exists")
+	ErrSessionNotFound     = errors.New("session not found")
+	ErrUsernameConfusable  = errors.New("username too similar to an existing one")
+	ErrInvalidVerification = errors.New("invalid or expired verification link")
+	ErrAlreadyVerified     = errors.New("email address already verified")
+	ErrResendCooldown      = errors.New("verification email sent recently, try again later")
+	ErrInvalidReset        = errors.New("invalid or expired password reset link")
+)
+
+const (
+	sessionTTL = 12 * time.Hour
+	// sessionRefreshInterval is how long after being extended a session is extended again. Requests
+	// in between leave it as it is, so browsing does not write to the database every time.
+	sessionRefreshInterval = 10 * time.Minute
+	// unverifiedCheckInterval is how often accounts left unverified for too long are removed.
+	unverifiedCheckInterval = time.Hour
+	// resetQueueSize is how many password reset requests may wait for Run; more are dropped.
+	resetQueueSize = 64
 )
 
 type Auth interface {
 	CreateUser(user model.User) error
-	GenerateToken(username, password string) (model.User, error)
+	CreateSession(username, password, userAgent, ip string) (model.Session, error)
 	ParseToken(token string) (model.User, error)
+	RefreshSession(user model.User, token, userAgent, ip string) (model.Session, error)
+	GetSessions(userId int) ([]model.Session, error)
+	RevokeSession(userId, sessionId int) error
 	DeleteToken(token string) error
+	VerifyEmail(token string) error
+	ResendVerification(user model.User) error
+	RequestPasswordReset(email string) error
+	CheckPasswordReset(token string) error
+	ResetPassword(token, password, confirmPassword string) error
+	Run(ctx context.Context)
 }
 type AuthService struct {
-	Repository repository.Auth
+	Repository       repository.Auth
+	mail             *MailService
+	verifyExpiry     time.Duration
+	resendCooldown   time.Duration
+	unverifiedExpiry time.Duration
+	resetExpiry      time.Duration
+	// resets holds the addresses password resets were asked for, until Run gets to them.
+	resets chan string
 }
 
-func newAuthService(repository repository.Auth) *AuthService {
+func newAuthService(repository repository.Auth, mail *MailService, cfg *config.Config) *AuthService {
 	return &AuthService{
-		Repository: repository,
+		Repository:       repository,
+		mail:             mail,
+		verifyExpiry:     time.Duration(cfg.Auth.VerifyExpiry) * time.Second,
+		resendCooldown:   time.Duration(cfg.Auth.ResendCooldown) * time.Second,
+		unverifiedExpiry: time.Duration(cfg.Auth.UnverifiedExpiry) * time.Second,
+		resetExpiry:      time.Duration(cfg.Auth.ResetExpiry) * time.Second,
+		resets:           make(chan string, resetQueueSize),
 	}
 }
 
@@ -56,13 +101,11 @@ func checkUser(user model.User) error {
 		return fmt.Errorf("service: CreateUser: checkUser err: %w", ErrInvalidEmail)
 	}
 
-	for _, char := range user.Username {
-		if char < 32 || char > 126 {
-			return fmt.Errorf("service: CreateUser: checkUser err: %w", ErrInvalidUsernameChar)
-		}
+	if !validUsername(user.Username) {
+		return fmt.Errorf("service: CreateUser: checkUser err: %w", ErrInvalidUsernameChar)
 	}
 
-	if len(user.Username) < 1 || len(user.Username) >= 36 {
+	if runeLen(user.Username) < 1 || runeLen(user.Username) >= 36 {
 		return fmt.Errorf("service: CreateUser: checkUser err: %w", ErrInvalidUsernameLen)
 	}
 
@@ -73,6 +116,7 @@ func checkUser(user model.User) error {
 }
 
 func (s *AuthService) CreateUser(user model.User) error {
+	user.Username = normalizeText(user.Username)
 	if _, err := s.Repository.GetUser(user.Username); err == nil {
 		return fmt.Errorf("service: CreateUser: get user: %w", ErrUserExist)
 	}
@@ -87,32 +131,60 @@ func (s *AuthService) CreateUser(user model.User) error {
 		return err
 	}
 
-	return s.Repository.CreateUser(user)
+	if err := s.Repository.CreateUser(user); err != nil {
+		// Usernames that read the same as an existing one, such as a Cyrillic "аdmin", are refused so
+		// nobody can pass for someone else.
+		if errors.Is(err, repository.ErrSkeletonTaken) {
+			return fmt.Errorf("service: CreateUser: %q: %w", user.Username, ErrUsernameConfusable)
+		}
+		return err
+	}
+	created, err := s.Repository.GetUser(user.Username)
+	if err != nil {
+		return err
+	}
+	// The account exists either way: should the email fail to be queued, the user can ask for another.
+	if err := s.sendVerification(created, time.Now(), time.Now()); err != nil {
+		log.Printf("service: CreateUser: send verification to user %d: %v", created.ID, err)
+	}
+	return nil
 }
 
-func (s *AuthService) GenerateToken(username, password string) (model.User, error) {
-	user, err := s.Repository.GetUser(username)
+func (s *AuthService) CreateSession(username, password, userAgent, ip string) (model.Session, error) {
+	user, err := s.Repository.GetUser(normalizeText(username))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return model.User{}, ErrUserNotFound
+			return model.Session{}, ErrUserNotFound
 		}
-		return model.User{}, err
+		return model.Session{}, err
 	}
 
 	if err := compareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-		return model.User{}, fmt.Errorf("service: compare hash and password: %w: %w", err, ErrUserNotFound)
+		return model.Session{}, fmt.Errorf("service: compare hash and password: %w: %w", err, ErrUserNotFound)
 	}
-	user.Token = uuid.NewString()
-	user.ExpirationTime = time.Now().Add(12 * time.Hour)
 
-	if err := s.Repository.SaveToken(user.Username, user.Token, user.ExpirationTime); err != nil {
-		return model.User{}, err
+	now := time.Now()
+	if err := s.Repository.DeleteExpiredSessions(user.ID, now); err != nil {
+		return model.Session{}, err
 	}
-	return user, nil
+
+	session := model.Session{
+		UserID:         user.ID,
+		Token:          uuid.NewString(),
+		UserAgent:      userAgent,
+		IP:             ip,
+		CreationTime:   now,
+		LastSeen:       now,
+		ExpirationTime: now.Add(sessionTTL),
+	}
+	if err := s.Repository.CreateSession(session, model.HashToken(session.Token)); err != nil {
+		return model.Session{}, err
+	}
+	return session, nil
 }
 
 func (s *AuthService) ParseToken(token string) (model.User, error) {
-	user, err := s.Repository.GetUserByToken(token)
+	user, err := s.Repository.GetUserByTokenHash(model.HashToken(token))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return model.User{}, ErrUserNotFound
@@ -122,6 +194,269 @@ func (s *AuthService) ParseToken(token string) (model.User, error) {
 	return user, nil
 }
 
+// RefreshSession extends the session user is signed in with, noting the device it was last seen
+// from. Sessions extended within sessionRefreshInterval are left as they are.
+func (s *AuthService) RefreshSession(user model.User, token, userAgent, ip string) (model.Session, error) {
+	now := time.Now()
+	if user.ExpirationTime.Sub(now) > sessionTTL-sessionRefreshInterval {
+		return model.Session{ID: user.SessionID, UserID: user.ID, Token: token, ExpirationTime: user.ExpirationTime}, nil
+	}
+	session := model.Session{
+		ID:             user.SessionID,
+		UserID:         user.ID,
+		Token:          token,
+		UserAgent:      userAgent,
+		IP:             ip,
+		LastSeen:       now,
+		ExpirationTime: now.Add(sessionTTL),
+	}
+	if err := s.Repository.UpdateSession(session); err != nil {
+		return model.Session{}, err
+	}
+	return session, nil
+}
+
+func (s *AuthService) GetSessions(userId int) ([]model.Session, error) {
+	return s.Repository.GetSessionsByUserID(userId)
+}
+
+func (s *AuthService) RevokeSession(userId, sessionId int) error {
+	if err := s.Repository.DeleteSession(userId, sessionId); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("service: revoke session: %w", ErrSessionNotFound)
+		}
+		return err
+	}
+	return nil
+}
+
 func (s *AuthService) DeleteToken(token string) error {
-	return s.Repository.DeleteToken(token)
+	return s.Repository.DeleteTokenByHash(model.HashToken(token))
+}
+
+// newEmailToken makes the secret token of a link sent by email, along with its hash.
+func newEmailToken() (token, hash string, err error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+	token = hex.EncodeToString(secret)
+	return token, model.HashToken(token), nil
+}
+
+// sendVerification emails user a new link to confirm their address, which replaces any earlier one.
+// created is when the account was made, from which it expires if never verified.
+func (s *AuthService) sendVerification(user model.User, created, now time.Time) error {
+	token, hash, err := newEmailToken()
+	if err != nil {
+		return fmt.Errorf("service: send verification: %w", err)
+	}
+	if err := s.Repository.SetEmailVerification(model.EmailVerification{
+		UserID:         user.ID,
+		TokenHash:      hash,
+		ExpirationTime: now.Add(s.verifyExpiry),
+		LastSent:       now,
+		CreationTime:   created,
+	}); err != nil {
+		return err
+	}
+
+	data := map[string]interface{}{
+		"Username":  user.Username,
+		"VerifyURL": s.mail.link("/auth/verify?token=" + url.QueryEscape(token)),
+		"Expiry":    humanDuration(s.verifyExpiry),
+		"ForumURL":  s.mail.link("/"),
+	}
+	return s.mail.queue(user.Email, "Confirm your email address", "verify", data, nil)
+}
+
+// VerifyEmail confirms the address of the account a verification link was sent for.
+func (s *AuthService) VerifyEmail(token string) error {
+	if token == "" {
+		return fmt.Errorf("service: verify email: %w", ErrInvalidVerification)
+	}
+	verification, err := s.Repository.GetEmailVerificationByHash(model.HashToken(token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("service: verify email: %w", ErrInvalidVerification)
+		}
+		return err
+	}
+	if time.Now().After(verification.ExpirationTime) {
+		return fmt.Errorf("service: verify email: expired: %w", ErrInvalidVerification)
+	}
+	return s.Repository.DeleteEmailVerification(verification.UserID)
+}
+
+// ResendVerification sends user a new verification link, at most once per cooldown.
+func (s *AuthService) ResendVerification(user model.User) error {
+	if user.ID == 0 {
+		return fmt.Errorf("service: resend verification: %w", ErrPermissionDenied)
+	}
+	verification, err := s.Repository.GetEmailVerification(user.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("service: resend verification: %w", ErrAlreadyVerified)
+		}
+		return err
+	}
+	now := time.Now()
+	if now.Sub(verification.LastSent) < s.resendCooldown {
+		return fmt.Errorf("service: resend verification: %w", ErrResendCooldown)
+	}
+	return s.sendVerification(user, verification.CreationTime, now)
+}
+
+// RequestPasswordReset emails a password reset link to the account with the given address. It
+// succeeds the same whether or not there is such an account, so it cannot be used to find out who
+// is registered, and sends nothing when a link went out within the resend cooldown. The account is
+// looked up later by Run, so it takes as long either way; when too many requests are waiting, the
+// new one is dropped.
+func (s *AuthService) RequestPasswordReset(email string) error {
+	address, err := mail.ParseAddress(email)
+	if err != nil {
+		return fmt.Errorf("service: request password reset: %w", ErrInvalidEmail)
+	}
+	select {
+	case s.resets <- address.Address:
+	default:
+		log.Printf("service: request password reset: %d requests waiting, dropped one", resetQueueSize)
+	}
+	return nil
+}
+
+func (s *AuthService) sendPasswordReset(email string) error {
+	user, err := s.Repository.GetUserByEmail(email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+
+	now := time.Now()
+	reset, err := s.Repository.GetPasswordReset(user.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if err == nil && now.Sub(reset.CreationTime) < s.resendCooldown {
+		return nil
+	}
+
+	token, hash, err := newEmailToken()
+	if err != nil {
+		return err
+	}
+	if err := s.Repository.SetPasswordReset(model.PasswordReset{
+		UserID:         user.ID,
+		TokenHash:      hash,
+		ExpirationTime: now.Add(s.resetExpiry),
+		CreationTime:   now,
+	}); err != nil {
+		return err
+	}
+
+	data := map[string]interface{}{
+		"Username": user.Username,
+		"ResetURL": s.mail.link("/auth/reset?token=" + url.QueryEscape(token)),
+		"Expiry":   humanDuration(s.resetExpiry),
+		"ForumURL": s.mail.link("/"),
+	}
+	return s.mail.queue(user.Email, "Reset your password", "reset", data, nil)
+}
+
+func (s *AuthService) getPasswordReset(token string) (model.PasswordReset, error) {
+	if token == "" {
+		return model.PasswordReset{}, ErrInvalidReset
+	}
+	reset, err := s.Repository.GetPasswordResetByHash(model.HashToken(token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.PasswordReset{}, ErrInvalidReset
+		}
+		return model.PasswordReset{}, err
+	}
+	if time.Now().After(reset.ExpirationTime) {
+		return model.PasswordReset{}, fmt.Errorf("expired: %w", ErrInvalidReset)
+	}
+	return reset, nil
+}
+
+// CheckPasswordReset tells whether a password reset link can still be used.
+func (s *AuthService) CheckPasswordReset(token string) error {
+	if _, err := s.getPasswordReset(token); err != nil {
+		return fmt.Errorf("service: check password reset: %w", err)
+	}
+	return nil
+}
+
+// ResetPassword sets a new password for the account a reset link was sent for. The link works only
+// once, and every session and API token of the account ends.
+func (s *AuthService) ResetPassword(token, password, confirmPassword string) error {
+	reset, err := s.getPasswordReset(token)
+	if err != nil {
+		return fmt.Errorf("service: reset password: %w", err)
+	}
+	if password != confirmPassword {
+		return fmt.Errorf("service: reset password: %w", ErrConfirmPassword)
+	}
+	hash, err := generateHashPassword(password)
+	if err != nil {
+		return err
+	}
+	if err := s.Repository.ResetPassword(reset, hash); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("service: reset password: used: %w", ErrInvalidReset)
+		}
+		return err
+	}
+	return nil
+}
+
+// Run sends the password reset links asked for, and removes the accounts left unverified for too
+// long, checking regularly, until ctx is done. A zero expiry keeps unverified accounts forever.
+func (s *AuthService) Run(ctx context.Context) {
+	var check <-chan time.Time
+	if s.unverifiedExpiry > 0 {
+		ticker := time.NewTicker(unverifiedCheckInterval)
+		defer ticker.Stop()
+		check = ticker.C
+		s.deleteUnverifiedUsers()
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case email := <-s.resets:
+			if err := s.sendPasswordReset(email); err != nil {
+				log.Printf("service: request password reset: %v", err)
+			}
+		case <-check:
+			s.deleteUnverifiedUsers()
+		}
+	}
+}
+
+func (s *AuthService) deleteUnverifiedUsers() {
+	n, err := s.Repository.DeleteUnverifiedUsers(time.Now().Add(-s.unverifiedExpiry))
+	if err != nil {
+		log.Printf("service: delete unverified users: %v", err)
+	} else if n > 0 {
+		log.Printf("service: deleted %d unverified users", n)
+	}
+}
+
+// humanDuration writes d the way a person would say it, in whole days, hours or minutes.
+func humanDuration(d time.Duration) string {
+	unit, name := time.Minute, "minute"
+	if d >= 48*time.Hour && d%(24*time.Hour) == 0 {
+		unit, name = 24*time.Hour, "day"
+	} else if d >= time.Hour && d%time.Hour == 0 {
+		unit, name = time.Hour, "hour"
+	}
+	n := int(d / unit)
+	if n == 1 {
+		return "1 " + name
+	}
+	return fmt.Sprintf("%d %ss", n, name)
 }
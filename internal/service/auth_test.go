@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"forum/internal/model"
+	"testing"
+	"time"
+)
+
+func TestPasswordResetSentByRun(t *testing.T) {
+	svc, repo, _ := newTestService(t)
+	if err := svc.Auth.CreateUser(model.User{Email: "alice@example.com", Username: "alice", Password: "Passw0rd1", ConfirmPassword: "Passw0rd1"}); err != nil {
+		t.Fatal(err)
+	}
+	resets := func() int {
+		mails, err := repo.GetDueMail(time.Now().Add(time.Hour), 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := 0
+		for _, mail := range mails {
+			if mail.Subject == "Reset your password" {
+				n++
+			}
+		}
+		return n
+	}
+
+	for _, email := range []string{"Alice@example.com", "nobody@example.com"} {
+		if err := svc.Auth.RequestPasswordReset(email); err != nil {
+			t.Fatalf("request for %s: %v", email, err)
+		}
+	}
+	if n := resets(); n != 0 {
+		t.Fatalf("%d reset mails queued before Run, want none", n)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		svc.Auth.Run(ctx)
+		close(done)
+	}()
+	for deadline := time.Now().Add(5 * time.Second); resets() == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("no reset mail queued by Run")
+		}
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run still going after ctx was cancelled")
+	}
+	if n := resets(); n != 1 {
+		t.Errorf("%d reset mails queued, want 1", n)
+	}
+}
+
+func TestPasswordResetQueueBounded(t *testing.T) {
+	svc, _, _ := newTestService(t)
+	for i := 0; i < resetQueueSize+10; i++ {
+		if err := svc.Auth.RequestPasswordReset("nobody@example.com"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if waiting := len(svc.Auth.(*AuthService).resets); waiting != resetQueueSize {
+		t.Errorf("%d requests waiting, want %d", waiting, resetQueueSize)
+	}
+}
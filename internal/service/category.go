@@ -0,0 +1,190 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"forum/internal/model"
+	"forum/internal/repository"
+	"strings"
+)
+
+var (
+	ErrInvalidCategory  = errors.New("invalid category")
+	ErrCategoryNotFound = errors.New("category not found")
+	ErrCategoryExists   = errors.New("category already exists")
+)
+
+type Category interface {
+	GetCategories() ([]model.Category, error)
+	GetAllCategories(actor model.User) ([]model.Category, error)
+	GetCategoryIndex() ([]model.Category, error)
+	GetCategory(slug string) (model.Category, error)
+	CreateCategory(actor model.User, category model.Category) error
+	UpdateCategory(actor model.User, category model.Category) error
+	SetCategoryArchived(actor model.User, slug string, archived bool) error
+}
+
+type CategoryService struct {
+	Repository repository.Category
+}
+
+func newCategoryService(repository repository.Category) *CategoryService {
+	return &CategoryService{
+		Repository: repository,
+	}
+}
+
+func checkCategory(category model.Category) error {
+	if len(category.Slug) == 0 || len(category.Slug) > 32 {
+		return fmt.Errorf("service: check category: slug length: %w", ErrInvalidCategory)
+	}
+	for i, char := range category.Slug {
+		if (char < 'a' || char > 'z') && (char < '0' || char > '9') && char != '-' {
+			return fmt.Errorf("service: check category: slug characters: %w", ErrInvalidCategory)
+		}
+		if char == '-' && (i == 0 || i == len(category.Slug)-1) {
+			return fmt.Errorf("service: check category: slug characters: %w", ErrInvalidCategory)
+		}
+	}
+
+	name := strings.TrimSpace(category.Name)
+	if name == "" || runeLen(name) > 32 {
+		return fmt.Errorf("service: check category: name length: %w", ErrInvalidCategory)
+	}
+	if !validText(name, false) {
+		return fmt.Errorf("service: check category: name characters: %w", ErrInvalidCategory)
+	}
+
+	if runeLen(category.Description) > 200 {
+		return fmt.Errorf("service: check category: description length: %w", ErrInvalidCategory)
+	}
+	if !validText(category.Description, true) {
+		return fmt.Errorf("service: check category: description characters: %w", ErrInvalidCategory)
+	}
+	return nil
+}
+
+// GetCategories returns the categories new posts can be filed under.
+func (s *CategoryService) GetCategories() ([]model.Category, error) {
+	return s.Repository.GetCategories(false)
+}
+
+// GetAllCategories returns every category, archived ones included, for managing them.
+func (s *CategoryService) GetAllCategories(actor model.User) ([]model.Category, error) {
+	if !hasPermission(actor, model.PermManageCategories) {
+		return nil, fmt.Errorf("service: get all categories: %w", ErrPermissionDenied)
+	}
+	return s.Repository.GetCategories(true)
+}
+
+func (s *CategoryService) GetCategoryIndex() ([]model.Category, error) {
+	return s.Repository.GetCategoryStats()
+}
+
+func (s *CategoryService) CreateCategory(actor model.User, category model.Category) error {
+	if !hasPermission(actor, model.PermManageCategories) {
+		return fmt.Errorf("service: create category: %w", ErrPermissionDenied)
+	}
+
+	category.Slug = strings.ToLower(strings.TrimSpace(category.Slug))
+	category.Name = normalizeText(strings.TrimSpace(category.Name))
+	category.Description = normalizeText(category.Description)
+	if err := checkCategory(category); err != nil {
+		return err
+	}
+
+	if _, err := s.Repository.GetCategoryBySlug(category.Slug); err == nil {
+		return fmt.Errorf("service: create category: %w", ErrCategoryExists)
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	return s.Repository.CreateCategory(category)
+}
+
+// UpdateCategory renames, describes or moves the category with the given slug.
+func (s *CategoryService) UpdateCategory(actor model.User, category model.Category) error {
+	if !hasPermission(actor, model.PermManageCategories) {
+		return fmt.Errorf("service: update category: %w", ErrPermissionDenied)
+	}
+
+	current, err := s.getCategory(category.Slug)
+	if err != nil {
+		return err
+	}
+
+	category.Name = normalizeText(strings.TrimSpace(category.Name))
+	category.Description = normalizeText(category.Description)
+	if err := checkCategory(category); err != nil {
+		return err
+	}
+	category.Archived = current.Archived
+	return s.Repository.UpdateCategory(category)
+}
+
+// SetCategoryArchived hides a category from new posts and listings, or brings it back. Posts already
+// filed under it keep it.
+func (s *CategoryService) SetCategoryArchived(actor model.User, slug string, archived bool) error {
+	if !hasPermission(actor, model.PermManageCategories) {
+		return fmt.Errorf("service: set category archived: %w", ErrPermissionDenied)
+	}
+
+	category, err := s.getCategory(slug)
+	if err != nil {
+		return err
+	}
+	category.Archived = archived
+	return s.Repository.UpdateCategory(category)
+}
+
+// GetCategory returns the category with the given slug, archived or not.
+func (s *CategoryService) GetCategory(slug string) (model.Category, error) {
+	return s.getCategory(slug)
+}
+
+func (s *CategoryService) getCategory(slug string) (model.Category, error) {
+	category, err := s.Repository.GetCategoryBySlug(slug)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.Category{}, fmt.Errorf("service: get category %q: %w", slug, ErrCategoryNotFound)
+		}
+		return model.Category{}, err
+	}
+	return category, nil
+}
+
+// resolveCategories checks that every chosen category exists and is open for posting, and returns
+// them in full. Categories listed in kept are accepted even when archived, so editing a post does
+// not force dropping them.
+func resolveCategories(repo repository.Category, chosen []model.Category, kept []model.Category) ([]model.Category, error) {
+	if len(chosen) == 0 {
+		return nil, fmt.Errorf("service: resolve categories: none chosen: %w", ErrInvalidCategory)
+	}
+
+	keep := make(map[string]bool, len(kept))
+	for _, category := range kept {
+		keep[category.Slug] = true
+	}
+
+	seen := make(map[string]bool, len(chosen))
+	var resolved []model.Category
+	for _, choice := range chosen {
+		if seen[choice.Slug] {
+			continue
+		}
+		seen[choice.Slug] = true
+
+		category, err := repo.GetCategoryBySlug(choice.Slug)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, fmt.Errorf("service: resolve categories: unknown %q: %w", choice.Slug, ErrInvalidCategory)
+			}
+			return nil, err
+		}
+		if category.Archived && !keep[category.Slug] {
+			return nil, fmt.Errorf("service: resolve categories: archived %q: %w", choice.Slug, ErrInvalidCategory)
+		}
+		resolved = append(resolved, category)
+	}
+	return resolved, nil
+}
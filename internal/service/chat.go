@@ -0,0 +1,157 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"forum/internal/event"
+	"forum/internal/model"
+	"forum/internal/repository"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidChatMessage = errors.New("chat message cannot be empty or contain control characters")
+	ErrChatMessageLen     = errors.New("chat message must not exceed 500 characters")
+	ErrChatArchived       = errors.New("the chat of an archived category is read-only")
+	ErrChatRateLimited    = errors.New("you are sending messages too fast, slow down")
+)
+
+// EventChatMessage is the type of the events published on the topic of a chat room.
+const EventChatMessage = "chat"
+
+// ChatTopic is the event topic of the chat room of a category.
+func ChatTopic(categoryId int) string {
+	return "chat:" + strconv.Itoa(categoryId)
+}
+
+type Chat interface {
+	SendChatMessage(user model.User, slug, content string) (model.ChatMessage, error)
+	GetChatHistory(slug string) (model.Category, []model.ChatMessage, error)
+}
+
+// ChatService runs a chat room for every category. Messages reach the people in a room through the
+// event bus, and the latest ones are kept for those joining it later.
+type ChatService struct {
+	Repository repository.Chat
+	// HistorySize is how many of the latest messages of a room are kept.
+	HistorySize int
+	categories  *CategoryService
+	limiter     *rateLimiter
+	events      *event.Bus
+}
+
+func newChatService(repository repository.Chat, historySize, rateLimit int, ratePeriod time.Duration, categories *CategoryService,
+	events *event.Bus,
+) *ChatService {
+	return &ChatService{
+		Repository:  repository,
+		HistorySize: historySize,
+		categories:  categories,
+		limiter:     newRateLimiter(rateLimit, ratePeriod),
+		events:      events,
+	}
+}
+
+// SendChatMessage stores a message in the chat room of the category with the given slug and sends it
+// to everyone there.
+func (s *ChatService) SendChatMessage(user model.User, slug, content string) (model.ChatMessage, error) {
+	if !hasPermission(user, model.PermChat) {
+		return model.ChatMessage{}, fmt.Errorf("service: send chat message: %w", ErrPermissionDenied)
+	}
+	category, err := s.categories.getCategory(slug)
+	if err != nil {
+		return model.ChatMessage{}, fmt.Errorf("service: send chat message: %w", err)
+	}
+	if category.Archived {
+		return model.ChatMessage{}, fmt.Errorf("service: send chat message: %w", ErrChatArchived)
+	}
+
+	content = strings.TrimSpace(normalizeText(content))
+	if runeLen(content) > 500 {
+		return model.ChatMessage{}, fmt.Errorf("service: send chat message: %w", ErrChatMessageLen)
+	}
+	if content == "" || !validText(content, false) {
+		return model.ChatMessage{}, fmt.Errorf("service: send chat message: %w", ErrInvalidChatMessage)
+	}
+	if !s.limiter.allow(user.ID, time.Now()) {
+		return model.ChatMessage{}, fmt.Errorf("service: send chat message: %w", ErrChatRateLimited)
+	}
+
+	message := model.ChatMessage{
+		CategoryID:   category.ID,
+		Author:       user.Username,
+		Content:      content,
+		CreationTime: time.Now(),
+	}
+	if message.ID, err = s.Repository.CreateChatMessage(message, user.ID, s.HistorySize); err != nil {
+		return model.ChatMessage{}, err
+	}
+	s.events.Publish(ChatTopic(category.ID), EventChatMessage, message)
+	return message, nil
+}
+
+// GetChatHistory returns the category with the given slug and the latest messages of its chat room,
+// oldest first.
+func (s *ChatService) GetChatHistory(slug string) (model.Category, []model.ChatMessage, error) {
+	category, err := s.categories.getCategory(slug)
+	if err != nil {
+		return model.Category{}, nil, fmt.Errorf("service: get chat history: %w", err)
+	}
+	messages, err := s.Repository.GetChatMessages(category.ID, s.HistorySize)
+	if err != nil {
+		return model.Category{}, nil, err
+	}
+	return category, messages, nil
+}
+
+// rateLimiter lets each user do something at most limit times within any period. A limit below one
+// lets everything through.
+type rateLimiter struct {
+	mu        sync.Mutex
+	limit     int
+	period    time.Duration
+	recent    map[int][]time.Time
+	lastSweep time.Time
+}
+
+func newRateLimiter(limit int, period time.Duration) *rateLimiter {
+	return &rateLimiter{
+		limit:  limit,
+		period: period,
+		recent: make(map[int][]time.Time),
+	}
+}
+
+// allow records an attempt of the user at now and reports whether it is within the limit. Refused
+// attempts are not recorded, so waiting is enough to be allowed again.
+func (l *rateLimiter) allow(userId int, now time.Time) bool {
+	if l.limit < 1 {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > l.period {
+		// Forget users quiet for a whole period, so the map only holds recent senders.
+		for id, times := range l.recent {
+			if now.Sub(times[len(times)-1]) > l.period {
+				delete(l.recent, id)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	times := l.recent[userId]
+	for len(times) > 0 && now.Sub(times[0]) > l.period {
+		times = times[1:]
+	}
+	if len(times) >= l.limit {
+		l.recent[userId] = times
+		return false
+	}
+	l.recent[userId] = append(times, now)
+	return true
+}
@@ -1,8 +1,10 @@
 package service
 
 import (
+	"database/sql"
 	"errors"
 	"fmt"
+	"forum/internal/event"
 	"forum/internal/model"
 	"forum/internal/repository"
 	"strings"
@@ -12,53 +14,81 @@ var (
 	ErrInvalidComment     = errors.New("invalid comment")
 	ErrInvalidCommentChar = errors.New("invalid characters")
 	ErrCommentLen         = errors.New("comment length out of range")
+	ErrInvalidParent      = errors.New("invalid parent comment")
+	ErrCommentDeleted     = errors.New("comment is deleted")
 )
 
 type Commentary interface {
-	CreateCommentary(comment model.Commentary) error
+	CreateCommentary(comment model.Commentary) (int, error)
 	GetCommentaryById(commentId int) (model.Commentary, error)
-	GetCommentariesByPostID(postId int) ([]model.Commentary, error)
+	GetCommentariesByPostID(postId int, cursor string) ([]model.Commentary, model.Page, error)
+	UpdateCommentary(user model.User, comment model.Commentary) error
+	DeleteCommentary(user model.User, commentId int) error
 }
 
 type CommentaryService struct {
 	Repository repository.Commentary
+	// MaxDepth is the deepest reply level shown nested; deeper replies are listed flat at that level.
+	MaxDepth      int
+	notifications *NotificationService
+	events        *event.Bus
 }
 
-func newCommentaryService(repository repository.Commentary) *CommentaryService {
+func newCommentaryService(repository repository.Commentary, maxDepth int, notifications *NotificationService, events *event.Bus) *CommentaryService {
 	return &CommentaryService{
-		Repository: repository,
+		Repository:    repository,
+		MaxDepth:      maxDepth,
+		notifications: notifications,
+		events:        events,
 	}
 }
 
 func checkCommentary(comment model.Commentary) error {
-	if len(comment.Content) > 700 {
+	if runeLen(comment.Content) > 700 {
 		return fmt.Errorf("service: create comment: %w", ErrCommentLen)
 	}
 
-	comment.Content = strings.Trim(comment.Content, " \n\r")
-
-	for _, char := range comment.Content {
-		if (char != 13 && char != 10) && (char < 32 || char > 126) {
-			return fmt.Errorf("service: Create Comment: check comment err: %w", ErrInvalidCommentChar)
-		}
-	}
-
-	if comment.Content == "" {
+	comment.Content = strings.TrimSpace(comment.Content)
+	if comment.Content == "" || !validText(comment.Content, true) {
 		return fmt.Errorf("service: Create Comment: check comment err: %w", ErrInvalidCommentChar)
 	}
 
 	return nil
 }
 
-func (s *CommentaryService) CreateCommentary(comment model.Commentary) error {
+// CreateCommentary validates and stores a new comment or reply, returning its id.
+func (s *CommentaryService) CreateCommentary(comment model.Commentary) (int, error) {
+	comment.Content = normalizeText(comment.Content)
 	if err := checkCommentary(comment); err != nil {
-		return err
+		return 0, err
 	}
 
-	if err := s.Repository.CreateCommentary(comment); err != nil {
-		return err
+	if comment.ParentID != 0 {
+		parent, err := s.Repository.GetCommentaryByID(comment.ParentID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return 0, fmt.Errorf("service: create comment: %w", ErrInvalidParent)
+			}
+			return 0, err
+		}
+		if parent.PostID != comment.PostID {
+			return 0, fmt.Errorf("service: create comment: parent from another post: %w", ErrInvalidParent)
+		}
+		if parent.Deleted {
+			return 0, fmt.Errorf("service: create comment: %w", ErrCommentDeleted)
+		}
 	}
-	return nil
+
+	id, err := s.Repository.CreateCommentary(comment)
+	if err != nil {
+		return 0, err
+	}
+	comment.ID = id
+	s.notifications.notifyComment(comment)
+	if created, err := s.Repository.GetCommentaryByID(id); err == nil {
+		s.publishComment(created)
+	}
+	return id, nil
 }
 
 func (s *CommentaryService) GetCommentaryById(commentId int) (model.Commentary, error) {
@@ -69,10 +99,123 @@ func (s *CommentaryService) GetCommentaryById(commentId int) (model.Commentary,
 	return commentary, nil
 }
 
-func (s *CommentaryService) GetCommentariesByPostID(postId int) ([]model.Commentary, error) {
-	commentaries, err := s.Repository.GetCommentariesByPostID(postId)
+// GetCommentariesByPostID returns one page of the post's comment threads, paged by their top-level
+// comment, and the cursors of the pages around it. An empty cursor selects the first page.
+func (s *CommentaryService) GetCommentariesByPostID(postId int, cursor string) ([]model.Commentary, model.Page, error) {
+	var from model.Cursor
+	if cursor != "" {
+		var err error
+		if from, err = decodeCursor(cursor, ""); err != nil {
+			return nil, model.Page{}, err
+		}
+	}
+
+	commentaries, err := s.Repository.GetCommentariesByPostID(postId, from, defaultPageSize+1)
 	if err != nil {
-		return nil, err
+		return nil, model.Page{}, err
+	}
+	threads := s.buildTree(commentaries)
+
+	extra, hasPrev, hasNext := pageBounds(from, len(threads), defaultPageSize)
+	if extra {
+		if from.Backward {
+			threads = threads[1:]
+		} else {
+			threads = threads[:defaultPageSize]
+		}
+	}
+
+	var page model.Page
+	if len(threads) != 0 {
+		if hasPrev {
+			page.Prev = encodeCursor("", model.Cursor{ID: threads[0].ID, Backward: true})
+		}
+		if hasNext {
+			page.Next = encodeCursor("", model.Cursor{ID: threads[len(threads)-1].ID})
+		}
+	}
+	return threads, page, nil
+}
+
+func (s *CommentaryService) UpdateCommentary(user model.User, comment model.Commentary) error {
+	oldComment, err := s.Repository.GetCommentaryByID(comment.ID)
+	if err != nil {
+		return err
+	}
+
+	if oldComment.Deleted {
+		return fmt.Errorf("service: update comment: %w", ErrCommentDeleted)
+	}
+
+	if !canModify(user, oldComment.Author, model.PermComment, model.PermEditAnyComment) {
+		return fmt.Errorf("service: update comment: %w", ErrPermissionDenied)
+	}
+
+	comment.Content = normalizeText(comment.Content)
+	if err := checkCommentary(comment); err != nil {
+		return err
+	}
+
+	return s.Repository.UpdateCommentary(comment)
+}
+
+func (s *CommentaryService) DeleteCommentary(user model.User, commentId int) error {
+	comment, err := s.Repository.GetCommentaryByID(commentId)
+	if err != nil {
+		return err
+	}
+
+	if comment.Deleted {
+		return fmt.Errorf("service: delete comment: %w", ErrCommentDeleted)
+	}
+
+	if !canModify(user, comment.Author, model.PermComment, model.PermDeleteAnyComment) {
+		return fmt.Errorf("service: delete comment: %w", ErrPermissionDenied)
+	}
+
+	return s.Repository.DeleteCommentary(commentId)
+}
+
+// buildTree nests replies under their parents. Replies to comments missing from the list are
+// treated as top-level ones.
+func (s *CommentaryService) buildTree(commentaries []model.Commentary) []model.Commentary {
+	known := make(map[int]bool, len(commentaries))
+	for _, commentary := range commentaries {
+		known[commentary.ID] = true
+	}
+
+	children := make(map[int][]model.Commentary)
+	for _, commentary := range commentaries {
+		parentId := commentary.ParentID
+		if !known[parentId] {
+			parentId = 0
+		}
+		children[parentId] = append(children[parentId], commentary)
+	}
+	return s.buildLevel(children, 0, 0)
+}
+
+func (s *CommentaryService) buildLevel(children map[int][]model.Commentary, parentId, depth int) []model.Commentary {
+	var level []model.Commentary
+	for _, commentary := range children[parentId] {
+		commentary.Depth = depth
+		if depth < s.MaxDepth {
+			commentary.Replies = s.buildLevel(children, commentary.ID, depth+1)
+			level = append(level, commentary)
+			continue
+		}
+		level = append(level, commentary)
+		level = append(level, flattenReplies(children, commentary.ID, depth)...)
+	}
+	return level
+}
+
+func flattenReplies(children map[int][]model.Commentary, parentId, depth int) []model.Commentary {
+	var replies []model.Commentary
+	for _, commentary := range children[parentId] {
+		commentary.Depth = depth
+		replies = append(replies, commentary)
+		replies = append(replies, flattenReplies(children, commentary.ID, depth)...)
 	}
-	return commentaries, nil
+	return replies
 }
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"forum/internal/model"
+	"strings"
+)
+
+// diffRevision sets the diffs of a revision to the state the post had after it.
+func diffRevision(revision *model.PostRevision, next model.PostRevision) {
+	revision.TitleDiff = diffLines(revision.Title, next.Title)
+	revision.ContentDiff = diffLines(revision.Content, next.Content)
+	revision.CategoryDiff = diffLines(strings.Join(revision.Category, "\n"), strings.Join(next.Category, "\n"))
+}
+
+// diffLines returns a line-based diff turning oldText into newText, computed from the longest common subsequence.
+func diffLines(oldText, newText string) []model.DiffLine {
+	a := splitLines(oldText)
+	b := splitLines(newText)
+
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var diff []model.DiffLine
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			diff = append(diff, model.DiffLine{Op: model.DiffEqual, Text: a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, model.DiffLine{Op: model.DiffDelete, Text: a[i]})
+			i++
+		default:
+			diff = append(diff, model.DiffLine{Op: model.DiffInsert, Text: b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		diff = append(diff, model.DiffLine{Op: model.DiffDelete, Text: a[i]})
+	}
+	for ; j < len(b); j++ {
+		diff = append(diff, model.DiffLine{Op: model.DiffInsert, Text: b[j]})
+	}
+	return diff
+}
+
+func splitLines(text string) []string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
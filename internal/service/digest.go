@@ -0,0 +1,249 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"forum/internal/model"
+	"forum/internal/repository"
+	"log"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrInvalidDigestFrequency = errors.New("invalid digest frequency")
+	ErrInvalidUnsubscribe     = errors.New("invalid or outdated unsubscribe link")
+)
+
+const (
+	// digestPostLimit is how many posts one digest lists at most.
+	digestPostLimit = 50
+	// digestCheckInterval is how often digests are looked for that are due.
+	digestCheckInterval = 10 * time.Minute
+)
+
+type Digest interface {
+	GetFollowedCategories(user model.User) ([]model.Category, error)
+	FollowCategory(user model.User, slug string) error
+	UnfollowCategory(user model.User, slug string) error
+	GetDigestFrequency(user model.User) (model.DigestFrequency, error)
+	SetDigestFrequency(user model.User, frequency model.DigestFrequency) error
+	CheckUnsubscribe(token string) error
+	Unsubscribe(token string) error
+	Run(ctx context.Context)
+}
+
+// DigestService emails users, daily or weekly as they choose, the posts published since the last
+// digest in the categories they follow.
+type DigestService struct {
+	Repository repository.Digest
+	categories *CategoryService
+	mail       *MailService
+}
+
+func newDigestService(repository repository.Digest, categories *CategoryService, mail *MailService) *DigestService {
+	return &DigestService{
+		Repository: repository,
+		categories: categories,
+		mail:       mail,
+	}
+}
+
+// digestPost is a post as listed in a digest.
+type digestPost struct {
+	Title  string
+	Author string
+	URL    string
+}
+
+func (s *DigestService) GetFollowedCategories(user model.User) ([]model.Category, error) {
+	if user.ID == 0 {
+		return nil, fmt.Errorf("service: get followed categories: %w", ErrPermissionDenied)
+	}
+	return s.Repository.GetFollowedCategories(user.ID)
+}
+
+func (s *DigestService) FollowCategory(user model.User, slug string) error {
+	if user.ID == 0 {
+		return fmt.Errorf("service: follow category: %w", ErrPermissionDenied)
+	}
+	category, err := s.categories.getCategory(slug)
+	if err != nil {
+		return fmt.Errorf("service: follow category: %w", err)
+	}
+	return s.Repository.FollowCategory(user.ID, category.ID)
+}
+
+func (s *DigestService) UnfollowCategory(user model.User, slug string) error {
+	if user.ID == 0 {
+		return fmt.Errorf("service: unfollow category: %w", ErrPermissionDenied)
+	}
+	category, err := s.categories.getCategory(slug)
+	if err != nil {
+		return fmt.Errorf("service: unfollow category: %w", err)
+	}
+	return s.Repository.UnfollowCategory(user.ID, category.ID)
+}
+
+// GetDigestFrequency tells how often user gets a digest. Digests are off until turned on.
+func (s *DigestService) GetDigestFrequency(user model.User) (model.DigestFrequency, error) {
+	if user.ID == 0 {
+		return "", fmt.Errorf("service: get digest frequency: %w", ErrPermissionDenied)
+	}
+	subscription, err := s.Repository.GetDigestSubscription(user.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.DigestOff, nil
+		}
+		return "", err
+	}
+	return subscription.Frequency, nil
+}
+
+// SetDigestFrequency changes how often user gets a digest. Turning digests on starts from now:
+// the first one comes a period later, with the posts published in between.
+func (s *DigestService) SetDigestFrequency(user model.User, frequency model.DigestFrequency) error {
+	if user.ID == 0 {
+		return fmt.Errorf("service: set digest frequency: %w", ErrPermissionDenied)
+	}
+	if !frequency.Valid() {
+		return fmt.Errorf("service: set digest frequency: %q: %w", frequency, ErrInvalidDigestFrequency)
+	}
+
+	subscription, err := s.Repository.GetDigestSubscription(user.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		token := make([]byte, 32)
+		if _, err := rand.Read(token); err != nil {
+			return fmt.Errorf("service: set digest frequency: %w", err)
+		}
+		subscription = model.DigestSubscription{UserID: user.ID, Frequency: model.DigestOff, Token: hex.EncodeToString(token)}
+	}
+	if subscription.Frequency == model.DigestOff && frequency != model.DigestOff {
+		if subscription.LastPostID, err = s.Repository.GetLatestPostID(); err != nil {
+			return err
+		}
+		subscription.LastSent = time.Now()
+	}
+	subscription.Frequency = frequency
+	return s.Repository.SetDigestSubscription(subscription)
+}
+
+// CheckUnsubscribe tells whether token is the token of a subscription, without changing it.
+func (s *DigestService) CheckUnsubscribe(token string) error {
+	if token == "" {
+		return fmt.Errorf("service: check unsubscribe: %w", ErrInvalidUnsubscribe)
+	}
+	if _, err := s.Repository.GetDigestSubscriptionByToken(token); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("service: check unsubscribe: %w", ErrInvalidUnsubscribe)
+		}
+		return err
+	}
+	return nil
+}
+
+// Unsubscribe turns off the digests of the subscription a link from a digest points to.
+func (s *DigestService) Unsubscribe(token string) error {
+	if token == "" {
+		return fmt.Errorf("service: unsubscribe: %w", ErrInvalidUnsubscribe)
+	}
+	if err := s.Repository.UnsubscribeDigest(token); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("service: unsubscribe: %w", ErrInvalidUnsubscribe)
+		}
+		return err
+	}
+	return nil
+}
+
+// Run queues the digests that are due, checking regularly until ctx is done.
+func (s *DigestService) Run(ctx context.Context) {
+	ticker := time.NewTicker(digestCheckInterval)
+	defer ticker.Stop()
+	for {
+		if err := s.sendDue(time.Now()); err != nil {
+			log.Printf("service: send digests: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sendDue queues a digest for every subscription whose period has passed at now. Subscriptions with
+// nothing new get no email, and wait another period.
+func (s *DigestService) sendDue(now time.Time) error {
+	subscriptions, err := s.Repository.GetActiveDigests()
+	if err != nil {
+		return err
+	}
+	for _, subscription := range subscriptions {
+		if now.Sub(subscription.LastSent) < subscription.Frequency.Period() {
+			continue
+		}
+		if err := s.send(subscription, now); err != nil {
+			log.Printf("service: send digest to user %d: %v", subscription.UserID, err)
+		}
+	}
+	return nil
+}
+
+func (s *DigestService) send(subscription model.DigestSubscription, now time.Time) error {
+	latest, err := s.Repository.GetLatestPostID()
+	if err != nil {
+		return err
+	}
+	posts, err := s.Repository.GetDigestPosts(subscription.UserID, subscription.LastPostID, digestPostLimit+1)
+	if err != nil {
+		return err
+	}
+	// Posts published since latest was read are left for the next digest.
+	for len(posts) > 0 && posts[len(posts)-1].ID > latest {
+		posts = posts[:len(posts)-1]
+	}
+
+	if len(posts) > 0 {
+		more := len(posts) > digestPostLimit
+		if more {
+			posts = posts[:digestPostLimit]
+		}
+		listed := make([]digestPost, len(posts))
+		for i, post := range posts {
+			listed[i] = digestPost{Title: post.Title, Author: post.Author, URL: s.mail.link("/post/" + strconv.Itoa(post.ID))}
+		}
+		unsubscribe := s.mail.link("/mail/unsubscribe?token=" + url.QueryEscape(subscription.Token))
+		data := map[string]interface{}{
+			"Username":       subscription.Username,
+			"Frequency":      subscription.Frequency,
+			"Posts":          listed,
+			"More":           more,
+			"ForumURL":       s.mail.link("/"),
+			"SettingsURL":    s.mail.link("/notifications"),
+			"UnsubscribeURL": unsubscribe,
+		}
+		headers := map[string]string{
+			"List-Unsubscribe":      "<" + unsubscribe + ">",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		}
+		subject := fmt.Sprintf("Your %s forum digest: %d new posts", subscription.Frequency, len(posts))
+		if len(posts) == 1 {
+			subject = fmt.Sprintf("Your %s forum digest: 1 new post", subscription.Frequency)
+		} else if more {
+			subject = fmt.Sprintf("Your %s forum digest: more than %d new posts", subscription.Frequency, digestPostLimit)
+		}
+		if err := s.mail.queue(subscription.Email, subject, "digest", data, headers); err != nil {
+			return err
+		}
+	}
+	return s.Repository.MarkDigestSent(subscription.UserID, latest, now)
+}
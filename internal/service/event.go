@@ -0,0 +1,60 @@
+package service
+
+import (
+	"forum/internal/model"
+	"log"
+	"strconv"
+)
+
+// Types of the events published on the topic of a post.
+const (
+	EventComment      = "comment"
+	EventPostVotes    = "votes"
+	EventCommentVotes = "comment-votes"
+)
+
+// PostTopic is the event topic of everything happening on a post.
+func PostTopic(postId int) string {
+	return "post:" + strconv.Itoa(postId)
+}
+
+// VoteCount is the data of vote events: the new totals of the post or comment with the given id.
+type VoteCount struct {
+	ID       int `json:"id"`
+	Likes    int `json:"likes"`
+	Dislikes int `json:"dislikes"`
+}
+
+// publishPostVotes tells the pages of a post its new vote totals. Like notifications, events only
+// follow from a change already made, so failures are logged instead of failing it.
+func (s *VotePostService) publishPostVotes(postId int) {
+	post, err := s.PostRepository.GetPostByID(postId)
+	if err != nil {
+		log.Printf("service: publish post votes: %v", err)
+		return
+	}
+	s.events.Publish(PostTopic(postId), EventPostVotes, VoteCount{ID: post.ID, Likes: post.Likes, Dislikes: post.Dislikes})
+}
+
+func (s *VoteCommentaryService) publishCommentVotes(commentId int) {
+	comment, err := s.CommentaryRepository.GetCommentaryByID(commentId)
+	if err != nil {
+		log.Printf("service: publish comment votes: %v", err)
+		return
+	}
+	s.events.Publish(PostTopic(comment.PostID), EventCommentVotes, VoteCount{ID: comment.ID, Likes: comment.Likes, Dislikes: comment.Dislikes})
+}
+
+// publishComment sends a new comment to the pages of its post, with the depth it is shown at so they
+// can place it among the others.
+func (s *CommentaryService) publishComment(comment model.Commentary) {
+	for parentId := comment.ParentID; parentId != 0 && comment.Depth < s.MaxDepth; comment.Depth++ {
+		parent, err := s.Repository.GetCommentaryByID(parentId)
+		if err != nil {
+			log.Printf("service: publish comment: %v", err)
+			break
+		}
+		parentId = parent.ParentID
+	}
+	s.events.Publish(PostTopic(comment.PostID), EventComment, comment)
+}
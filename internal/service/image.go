@@ -0,0 +1,285 @@
+package service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"forum/internal/config"
+	"forum/internal/model"
+	"forum/internal/storage"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrInvalidImage    = errors.New("only JPEG, PNG and GIF images can be attached")
+	ErrImageTooLarge   = errors.New("image file too large")
+	ErrImageDimensions = errors.New("image dimensions too large")
+	ErrTooManyImages   = errors.New("too many images")
+	ErrImageNotFound   = errors.New("image not found")
+	ErrImageURLExpired = errors.New("image link expired")
+	ErrInvalidImageURL = errors.New("invalid image link")
+)
+
+const (
+	thumbnailSize = 320
+	jpegQuality   = 90
+	maxGIFFrames  = 200
+	// maxGIFPixels bounds the pixels of all the frames of an animation together, as each one is
+	// decoded at a byte a pixel.
+	maxGIFPixels = 64 << 20
+
+	defaultImageURLExpiry = time.Hour
+)
+
+// imageFormats are the formats images can be attached in, by the content type sniffed from them.
+var imageFormats = map[string]string{
+	"image/jpeg": "jpeg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+}
+
+var imageContentTypes = map[string]string{
+	".jpg": "image/jpeg",
+	".png": "image/png",
+	".gif": "image/gif",
+}
+
+type Image interface {
+	GetImage(key string) (io.ReadCloser, string, error)
+	ImageURL(key string) string
+	VerifyImageURL(key, expires, signature string) (time.Time, error)
+	UploadLimit() int64
+}
+
+type ImageService struct {
+	Storage      storage.Storage
+	maxSize      int64
+	maxDimension int
+	maxImages    int
+	urlSecret    []byte
+	urlExpiry    time.Duration
+}
+
+func newImageService(storage storage.Storage, cfg *config.Config) *ImageService {
+	expiry := time.Duration(cfg.Uploads.URLExpiry) * time.Second
+	if expiry <= 0 {
+		expiry = defaultImageURLExpiry
+	}
+
+	return &ImageService{
+		Storage:      storage,
+		maxSize:      cfg.Uploads.MaxImageSize,
+		maxDimension: cfg.Uploads.MaxImageDimension,
+		maxImages:    cfg.Uploads.MaxImagesPerPost,
+		urlSecret:    []byte(cfg.Uploads.URLSecret),
+		urlExpiry:    expiry,
+	}
+}
+
+// UploadLimit is the largest request body a post with the most and largest images allowed can take,
+// with room left for the text fields.
+func (s *ImageService) UploadLimit() int64 {
+	return int64(s.maxImages)*s.maxSize + 1<<20
+}
+
+type processedImage struct {
+	image model.Image
+	data  []byte
+	thumb []byte
+}
+
+// processImages checks and cleans up the images attached to a post, without storing anything yet.
+func (s *ImageService) processImages(files []io.Reader) ([]processedImage, error) {
+	if len(files) > s.maxImages {
+		return nil, fmt.Errorf("service: process images: %d of at most %d: %w", len(files), s.maxImages, ErrTooManyImages)
+	}
+
+	processed := make([]processedImage, 0, len(files))
+	for _, file := range files {
+		p, err := s.processImage(file)
+		if err != nil {
+			return nil, err
+		}
+		processed = append(processed, p)
+	}
+	return processed, nil
+}
+
+// storeImages stores processed images along with their thumbnails. Should one fail, the images
+// returned are those it got to, so the caller can remove them again.
+func (s *ImageService) storeImages(processed []processedImage) ([]model.Image, error) {
+	images := make([]model.Image, 0, len(processed))
+	for _, p := range processed {
+		images = append(images, p.image)
+		if err := s.Storage.Put(p.image.Key, p.data, p.image.ContentType); err != nil {
+			return images, fmt.Errorf("service: store images: %w", err)
+		}
+		if err := s.Storage.Put(p.image.ThumbKey, p.thumb, imageContentTypes[path.Ext(p.image.ThumbKey)]); err != nil {
+			return images, fmt.Errorf("service: store images: %w", err)
+		}
+	}
+	return images, nil
+}
+
+// processImage identifies an image by its content rather than its name, checks its size, and
+// encodes it again. Re-encoding drops EXIF and any other metadata, so JPEGs are turned upright
+// first since their orientation would be lost with it.
+func (s *ImageService) processImage(file io.Reader) (processedImage, error) {
+	data, err := io.ReadAll(io.LimitReader(file, s.maxSize+1))
+	if err != nil {
+		return processedImage{}, fmt.Errorf("service: process image: %w", err)
+	}
+	if int64(len(data)) > s.maxSize {
+		return processedImage{}, fmt.Errorf("service: process image: %w", ErrImageTooLarge)
+	}
+
+	contentType := http.DetectContentType(data)
+	format, ok := imageFormats[contentType]
+	if !ok {
+		return processedImage{}, fmt.Errorf("service: process image: %s: %w", contentType, ErrInvalidImage)
+	}
+
+	// The header gives the dimensions without decoding, so oversized images are refused before
+	// they take up memory.
+	cfg, decoded, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || decoded != format {
+		return processedImage{}, fmt.Errorf("service: process image: %w", ErrInvalidImage)
+	}
+	if cfg.Width < 1 || cfg.Height < 1 || cfg.Width > s.maxDimension || cfg.Height > s.maxDimension {
+		return processedImage{}, fmt.Errorf("service: process image: %dx%d: %w", cfg.Width, cfg.Height, ErrImageDimensions)
+	}
+
+	var img image.Image
+	var encoded, thumb bytes.Buffer
+	ext, thumbExt := ".png", ".png"
+	switch format {
+	case "gif":
+		// Frames are counted from their headers first, since decoding them all is what would take the memory.
+		frames, pixels, ok := gifFrames(data)
+		if !ok || frames == 0 {
+			return processedImage{}, fmt.Errorf("service: process image: %w", ErrInvalidImage)
+		}
+		if frames > maxGIFFrames || pixels > maxGIFPixels {
+			return processedImage{}, fmt.Errorf("service: process image: %d frames of %d pixels: %w", frames, pixels, ErrImageDimensions)
+		}
+		animation, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil || len(animation.Image) == 0 {
+			return processedImage{}, fmt.Errorf("service: process image: %w", ErrInvalidImage)
+		}
+		if err := gif.EncodeAll(&encoded, animation); err != nil {
+			return processedImage{}, fmt.Errorf("service: process image: %w", err)
+		}
+		first := animation.Image[0]
+		canvas := image.NewRGBA(image.Rect(0, 0, cfg.Width, cfg.Height))
+		draw.Draw(canvas, first.Bounds(), first, first.Bounds().Min, draw.Over)
+		img = canvas
+		ext = ".gif"
+	case "png":
+		if img, err = png.Decode(bytes.NewReader(data)); err != nil {
+			return processedImage{}, fmt.Errorf("service: process image: %w", ErrInvalidImage)
+		}
+		if err := png.Encode(&encoded, img); err != nil {
+			return processedImage{}, fmt.Errorf("service: process image: %w", err)
+		}
+	case "jpeg":
+		if img, err = jpeg.Decode(bytes.NewReader(data)); err != nil {
+			return processedImage{}, fmt.Errorf("service: process image: %w", ErrInvalidImage)
+		}
+		img = orient(img, jpegOrientation(data))
+		if err := jpeg.Encode(&encoded, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return processedImage{}, fmt.Errorf("service: process image: %w", err)
+		}
+		ext, thumbExt = ".jpg", ".jpg"
+	}
+
+	small := thumbnail(img, thumbnailSize)
+	if thumbExt == ".jpg" {
+		err = jpeg.Encode(&thumb, small, &jpeg.Options{Quality: jpegQuality})
+	} else {
+		err = png.Encode(&thumb, small)
+	}
+	if err != nil {
+		return processedImage{}, fmt.Errorf("service: process image: thumbnail: %w", err)
+	}
+
+	return processedImage{
+		image: model.Image{
+			Key:         contentKey(encoded.Bytes()) + ext,
+			ThumbKey:    contentKey(thumb.Bytes()) + thumbExt,
+			ContentType: imageContentTypes[ext],
+			Width:       img.Bounds().Dx(),
+			Height:      img.Bounds().Dy(),
+			Size:        encoded.Len(),
+		},
+		data:  encoded.Bytes(),
+		thumb: thumb.Bytes(),
+	}, nil
+}
+
+func contentKey(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// GetImage opens a stored image or thumbnail and tells its content type.
+func (s *ImageService) GetImage(key string) (io.ReadCloser, string, error) {
+	contentType, ok := imageContentTypes[path.Ext(key)]
+	if !ok || !storage.ValidKey(key) {
+		return nil, "", fmt.Errorf("service: get image: %w", ErrImageNotFound)
+	}
+	file, err := s.Storage.Get(key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidKey) {
+			return nil, "", fmt.Errorf("service: get image: %w", ErrImageNotFound)
+		}
+		return nil, "", err
+	}
+	return file, contentType, nil
+}
+
+// ImageURL links to a stored image with a signature that runs out after the configured expiry.
+// Expiry times are rounded to a whole period, so pages rendered a little apart link to the same URL
+// and browsers can cache the image; each link stays valid for one to two periods.
+func (s *ImageService) ImageURL(key string) string {
+	expires := time.Now().Truncate(s.urlExpiry).Add(2 * s.urlExpiry).Unix()
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	query.Set("signature", s.imageSignature(key, expires))
+	return "/images/" + key + "?" + query.Encode()
+}
+
+// VerifyImageURL checks the expiry and signature of a link made by ImageURL, and tells when it
+// expires.
+func (s *ImageService) VerifyImageURL(key, expires, signature string) (time.Time, error) {
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("service: verify image url: %w", ErrInvalidImageURL)
+	}
+	if !hmac.Equal([]byte(signature), []byte(s.imageSignature(key, unix))) {
+		return time.Time{}, fmt.Errorf("service: verify image url: %w", ErrInvalidImageURL)
+	}
+	expiresAt := time.Unix(unix, 0)
+	if time.Now().After(expiresAt) {
+		return time.Time{}, fmt.Errorf("service: verify image url: %w", ErrImageURLExpired)
+	}
+	return expiresAt, nil
+}
+
+func (s *ImageService) imageSignature(key string, expires int64) string {
+	mac := hmac.New(sha256.New, s.urlSecret)
+	mac.Write([]byte(key + "\n" + strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
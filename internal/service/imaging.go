@@ -0,0 +1,241 @@
+package service
+
+import (
+	"encoding/binary"
+	"image"
+	"image/draw"
+)
+
+// jpegOrientation reads the EXIF orientation of a JPEG: 1 when upright, up to 8 for the rotated
+// and mirrored variants. Files without a readable orientation count as upright.
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		switch {
+		case marker == 0xFF:
+			i++
+			continue
+		case marker == 0x01 || marker >= 0xD0 && marker <= 0xD7:
+			i += 2
+			continue
+		case marker == 0xD9 || marker == 0xDA:
+			// The image data starts here, and metadata always comes before it.
+			return 1
+		}
+
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return 1
+		}
+		if segment := data[i+4 : i+2+length]; marker == 0xE1 && len(segment) >= 6 && string(segment[:6]) == "Exif\x00\x00" {
+			return exifOrientation(segment[6:])
+		}
+		i += 2 + length
+	}
+	return 1
+}
+
+// gifFrames walks the blocks of a GIF without decoding any pixels, and tells how many frames it
+// has and how many pixels they add up to. Frames reaching outside the canvas, and files cut short,
+// are refused.
+func gifFrames(data []byte) (frames, pixels int, ok bool) {
+	if len(data) < 13 || string(data[:3]) != "GIF" {
+		return 0, 0, false
+	}
+	width, height := int(binary.LittleEndian.Uint16(data[6:])), int(binary.LittleEndian.Uint16(data[8:]))
+	i := 13
+	if flags := data[10]; flags&0x80 != 0 {
+		i += 3 << (flags&0x07 + 1)
+	}
+
+	// skipSubBlocks returns where the run of data sub-blocks starting at i ends, or -1.
+	skipSubBlocks := func(i int) int {
+		for i < len(data) {
+			size := int(data[i])
+			i++
+			if size == 0 {
+				return i
+			}
+			i += size
+		}
+		return -1
+	}
+
+	for i < len(data) {
+		switch data[i] {
+		case 0x21:
+			if i += 2; i > len(data) {
+				return 0, 0, false
+			}
+		case 0x2C:
+			if i+11 > len(data) {
+				return 0, 0, false
+			}
+			left, top := int(binary.LittleEndian.Uint16(data[i+1:])), int(binary.LittleEndian.Uint16(data[i+3:]))
+			w, h := int(binary.LittleEndian.Uint16(data[i+5:])), int(binary.LittleEndian.Uint16(data[i+7:]))
+			if left+w > width || top+h > height {
+				return 0, 0, false
+			}
+			frames++
+			pixels += w * h
+			flags := data[i+9]
+			i += 10
+			if flags&0x80 != 0 {
+				i += 3 << (flags&0x07 + 1)
+			}
+			// The LZW code size comes before the image data.
+			i++
+		case 0x3B:
+			return frames, pixels, true
+		default:
+			return 0, 0, false
+		}
+		if i = skipSubBlocks(i); i < 0 {
+			return 0, 0, false
+		}
+	}
+	return 0, 0, false
+}
+
+// exifOrientation finds the orientation tag in the first directory of EXIF data.
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	offset := int(order.Uint32(tiff[4:]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 1
+	}
+	count := int(order.Uint16(tiff[offset:]))
+	for i := 0; i < count; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) != 0x0112 {
+			continue
+		}
+		if orientation := int(order.Uint16(tiff[entry+8:])); orientation >= 1 && orientation <= 8 {
+			return orientation
+		}
+		return 1
+	}
+	return 1
+}
+
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Rect.Min == (image.Point{}) {
+		return rgba
+	}
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Rect, img, bounds.Min, draw.Src)
+	return rgba
+}
+
+// orient turns an image stored with the given EXIF orientation upright.
+func orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	src := toRGBA(img)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			}
+			copy(dst.Pix[dst.PixOffset(x, y):dst.PixOffset(x, y)+4], src.Pix[src.PixOffset(sx, sy):src.PixOffset(sx, sy)+4])
+		}
+	}
+	return dst
+}
+
+// thumbnail scales img down to fit within size×size, averaging the pixels each thumbnail pixel
+// covers. Images that already fit are returned as they are.
+func thumbnail(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w <= size && h <= size {
+		return img
+	}
+
+	tw, th := size, h*size/w
+	if h > w {
+		tw, th = w*size/h, size
+	}
+	if tw < 1 {
+		tw = 1
+	}
+	if th < 1 {
+		th = 1
+	}
+
+	src := toRGBA(img)
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := y*h/th, (y+1)*h/th
+		if y1 == y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < tw; x++ {
+			x0, x1 := x*w/tw, (x+1)*w/tw
+			if x1 == x0 {
+				x1 = x0 + 1
+			}
+
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[src.PixOffset(x0, sy):src.PixOffset(x1, sy)]
+				for i := 0; i < len(row); i += 4 {
+					sum[0] += int(row[i])
+					sum[1] += int(row[i+1])
+					sum[2] += int(row[i+2])
+					sum[3] += int(row[i+3])
+				}
+			}
+			n := (x1 - x0) * (y1 - y0)
+			offset := dst.PixOffset(x, y)
+			for c := 0; c < 4; c++ {
+				dst.Pix[offset+c] = uint8(sum[c] / n)
+			}
+		}
+	}
+	return dst
+}
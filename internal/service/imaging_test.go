@@ -0,0 +1,233 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func newTestImageService() *ImageService {
+	return &ImageService{maxSize: 1 << 20, maxDimension: 1024, maxImages: 4}
+}
+
+// halves is a w×h image, red on the left half and blue on the right.
+func halves(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if x < w/2 {
+				img.Set(x, y, color.RGBA{255, 0, 0, 255})
+			} else {
+				img.Set(x, y, color.RGBA{0, 0, 255, 255})
+			}
+		}
+	}
+	return img
+}
+
+func encodeTestImage(t *testing.T, format string, img image.Image) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	var err error
+	switch format {
+	case "png":
+		err = png.Encode(&b, img)
+	case "jpeg":
+		err = jpeg.Encode(&b, img, &jpeg.Options{Quality: jpegQuality})
+	case "gif":
+		err = gif.Encode(&b, img, nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// withOrientation puts an EXIF segment holding the given orientation in front of a JPEG's own.
+func withOrientation(data []byte, orientation int) []byte {
+	tiff := []byte("II*\x00\x08\x00\x00\x00\x01\x00")
+	entry := make([]byte, 12)
+	binary.LittleEndian.PutUint16(entry, 0x0112)
+	binary.LittleEndian.PutUint16(entry[2:], 3)
+	binary.LittleEndian.PutUint32(entry[4:], 1)
+	binary.LittleEndian.PutUint16(entry[8:], uint16(orientation))
+	tiff = append(append(tiff, entry...), 0, 0, 0, 0)
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	header := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(header[2:], uint16(len(segment)+2))
+	out := append([]byte{}, data[:2]...)
+	out = append(append(out, header...), segment...)
+	return append(out, data[2:]...)
+}
+
+// gifBomb is a GIF whose frames each cover a size×size canvas, with barely any data behind them.
+func gifBomb(size, frames int) []byte {
+	data := []byte("GIF89a")
+	data = binary.LittleEndian.AppendUint16(data, uint16(size))
+	data = binary.LittleEndian.AppendUint16(data, uint16(size))
+	data = append(data, 0x80, 0, 0, 0, 0, 0, 0xFF, 0xFF, 0xFF)
+	for i := 0; i < frames; i++ {
+		data = append(data, 0x2C, 0, 0, 0, 0)
+		data = binary.LittleEndian.AppendUint16(data, uint16(size))
+		data = binary.LittleEndian.AppendUint16(data, uint16(size))
+		data = append(data, 0, 2, 2, 0x4C, 0x01, 0)
+	}
+	return append(data, 0x3B)
+}
+
+func TestProcessImageRefusesTruncated(t *testing.T) {
+	s := newTestImageService()
+	img := halves(16, 8)
+	for _, format := range []string{"png", "jpeg", "gif"} {
+		data := encodeTestImage(t, format, img)
+		if _, err := s.processImage(bytes.NewReader(data)); err != nil {
+			t.Fatalf("%s: whole image: %v", format, err)
+		}
+		// The last bytes of a JPEG only end the image, which the decoder does without.
+		end := len(data) - 1
+		if format == "jpeg" {
+			end = len(data) - 2
+		}
+		for n := 0; n < end; n++ {
+			if _, err := s.processImage(bytes.NewReader(data[:n])); err == nil {
+				t.Errorf("%s cut to %d of %d bytes accepted", format, n, len(data))
+			}
+		}
+	}
+}
+
+func TestProcessImageRefusesOversized(t *testing.T) {
+	s := newTestImageService()
+	for _, format := range []string{"png", "jpeg", "gif"} {
+		t.Run(format, func(t *testing.T) {
+			wide := encodeTestImage(t, format, image.NewRGBA(image.Rect(0, 0, s.maxDimension+1, 1)))
+			if _, err := s.processImage(bytes.NewReader(wide)); !errors.Is(err, ErrImageDimensions) {
+				t.Errorf("too wide: %v, want ErrImageDimensions", err)
+			}
+			tall := encodeTestImage(t, format, image.NewRGBA(image.Rect(0, 0, 1, s.maxDimension+1)))
+			if _, err := s.processImage(bytes.NewReader(tall)); !errors.Is(err, ErrImageDimensions) {
+				t.Errorf("too tall: %v, want ErrImageDimensions", err)
+			}
+			large := append(encodeTestImage(t, format, halves(16, 8)), make([]byte, s.maxSize)...)
+			if _, err := s.processImage(bytes.NewReader(large)); !errors.Is(err, ErrImageTooLarge) {
+				t.Errorf("too large: %v, want ErrImageTooLarge", err)
+			}
+		})
+	}
+}
+
+func TestProcessImageRefusesGIFBomb(t *testing.T) {
+	s := newTestImageService()
+	s.maxDimension = 4096
+	tests := []struct {
+		name   string
+		data   []byte
+		frames int
+	}{
+		{"pixels", gifBomb(4096, maxGIFPixels/(4096*4096)+1), maxGIFPixels/(4096*4096) + 1},
+		{"frames", gifBomb(1, maxGIFFrames+1), maxGIFFrames + 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if frames, _, ok := gifFrames(tt.data); !ok || frames != tt.frames {
+				t.Fatalf("counted %d frames, ok %t; want %d", frames, ok, tt.frames)
+			}
+			// Decoding would refuse these frames too, only after allocating them; ErrImageDimensions
+			// shows they were refused from their headers.
+			if _, err := s.processImage(bytes.NewReader(tt.data)); !errors.Is(err, ErrImageDimensions) {
+				t.Errorf("got %v, want ErrImageDimensions", err)
+			}
+		})
+	}
+
+	// A frame reaching outside the canvas is refused as well.
+	outside := gifBomb(8, 1)
+	binary.LittleEndian.PutUint16(outside[13+6+1:], 1)
+	if _, _, ok := gifFrames(outside); ok {
+		t.Error("frame outside the canvas accepted")
+	}
+}
+
+func TestProcessImageAppliesOrientation(t *testing.T) {
+	s := newTestImageService()
+	plain := encodeTestImage(t, "jpeg", halves(16, 8))
+	tests := []struct {
+		orientation int
+		width       int
+		height      int
+		top         color.RGBA
+	}{
+		{1, 16, 8, color.RGBA{255, 0, 0, 255}},
+		{6, 8, 16, color.RGBA{255, 0, 0, 255}},
+		{8, 8, 16, color.RGBA{0, 0, 255, 255}},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.orientation), func(t *testing.T) {
+			data := withOrientation(plain, tt.orientation)
+			if got := jpegOrientation(data); got != tt.orientation {
+				t.Fatalf("read orientation %d, want %d", got, tt.orientation)
+			}
+			p, err := s.processImage(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Contains(p.data, []byte("Exif")) || bytes.Contains(p.thumb, []byte("Exif")) {
+				t.Error("EXIF kept in the stored image")
+			}
+			img, err := jpeg.Decode(bytes.NewReader(p.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bounds := img.Bounds(); bounds.Dx() != tt.width || bounds.Dy() != tt.height || p.image.Width != tt.width || p.image.Height != tt.height {
+				t.Fatalf("%dx%d, recorded as %dx%d; want %dx%d", bounds.Dx(), bounds.Dy(), p.image.Width, p.image.Height, tt.width, tt.height)
+			}
+			// The top left corner is checked for the color expected there, give or take JPEG's losses.
+			r, _, b, _ := img.At(1, 1).RGBA()
+			if (r>>8 > 128) != (tt.top.R > 128) || (b>>8 > 128) != (tt.top.B > 128) {
+				t.Errorf("top left is %d,%d (red, blue), want %v", r>>8, b>>8, tt.top)
+			}
+		})
+	}
+}
+
+func TestJPEGOrientationTruncated(t *testing.T) {
+	data := withOrientation(encodeTestImage(t, "jpeg", halves(16, 8)), 6)
+	// Cut anywhere in the EXIF segment, the orientation reads as upright rather than panicking.
+	end := 4 + int(binary.BigEndian.Uint16(data[4:]))
+	for n := 0; n < end; n++ {
+		if got := jpegOrientation(data[:n]); got != 1 {
+			t.Errorf("cut to %d bytes: orientation %d, want 1", n, got)
+		}
+	}
+}
+
+func TestThumbnailBounds(t *testing.T) {
+	tests := []struct {
+		width, height int
+		want          image.Point
+	}{
+		{1000, 500, image.Pt(320, 160)},
+		{500, 1000, image.Pt(160, 320)},
+		{640, 640, image.Pt(320, 320)},
+		{320, 100, image.Pt(320, 100)},
+		{100, 100, image.Pt(100, 100)},
+		{10000, 1, image.Pt(320, 1)},
+		{1, 10000, image.Pt(1, 320)},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%dx%d", tt.width, tt.height), func(t *testing.T) {
+			thumb := thumbnail(halves(tt.width, tt.height), thumbnailSize)
+			if got := thumb.Bounds().Size(); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"forum/internal/config"
+	"forum/internal/mail"
+	"forum/internal/model"
+	"forum/internal/repository"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	// mailBatchSize is how many messages of the outbox are sent in one go.
+	mailBatchSize = 50
+	// maxRetryDelay caps the growing wait between attempts to send a message.
+	maxRetryDelay = 24 * time.Hour
+	// defaultPollInterval is how often the outbox is checked when the configuration does not say.
+	defaultPollInterval = time.Minute
+	// mailRetention is how long sent and failed messages are kept, for their recipient, subject and
+	// error, and mailPruneInterval how often older ones are deleted.
+	mailRetention     = 30 * 24 * time.Hour
+	mailPruneInterval = time.Hour
+)
+
+type Mail interface {
+	Run(ctx context.Context)
+}
+
+// MailService sends email through an outbox: messages are stored first and delivered by Run, which
+// retries failures with a growing delay, so a mail server being down loses nothing.
+type MailService struct {
+	Repository   repository.Outbox
+	Sender       mail.Sender
+	templates    *mail.Templates
+	baseURL      string
+	pollInterval time.Duration
+	retryDelay   time.Duration
+	maxAttempts  int
+	// wake tells Run a message was queued, so it goes out without waiting for the next poll.
+	wake chan struct{}
+}
+
+func newMailService(repository repository.Outbox, sender mail.Sender, templates *mail.Templates, cfg *config.Config) *MailService {
+	pollInterval := time.Duration(cfg.Mail.PollInterval) * time.Second
+	if pollInterval <= 0 {
+		pollInterval = defaultPollInterval
+	}
+	return &MailService{
+		Repository:   repository,
+		Sender:       sender,
+		templates:    templates,
+		baseURL:      strings.TrimSuffix(cfg.Mail.BaseURL, "/"),
+		pollInterval: pollInterval,
+		retryDelay:   time.Duration(cfg.Mail.RetryDelay) * time.Second,
+		maxAttempts:  cfg.Mail.MaxAttempts,
+		wake:         make(chan struct{}, 1),
+	}
+}
+
+// link turns a path of the forum into an absolute URL, for links in email.
+func (s *MailService) link(path string) string {
+	return s.baseURL + path
+}
+
+// queue renders the message named template for data and puts it in the outbox.
+func (s *MailService) queue(to, subject, template string, data interface{}, headers map[string]string) error {
+	text, html, err := s.templates.Render(template, data)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if err := s.Repository.EnqueueMail(model.OutgoingMail{
+		To:           to,
+		Subject:      subject,
+		Text:         text,
+		HTML:         html,
+		Headers:      headers,
+		NextAttempt:  now,
+		CreationTime: now,
+	}); err != nil {
+		return err
+	}
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Run sends the messages of the outbox as they become due, and deletes old finished ones, until ctx
+// is done.
+func (s *MailService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+	prune := time.NewTicker(mailPruneInterval)
+	defer prune.Stop()
+	s.prune(time.Now())
+	for {
+		if err := s.deliver(time.Now()); err != nil {
+			log.Printf("service: deliver mail: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		case <-prune.C:
+			s.prune(time.Now())
+		}
+	}
+}
+
+func (s *MailService) prune(now time.Time) {
+	n, err := s.Repository.DeleteFinishedMail(now.Add(-mailRetention))
+	if err != nil {
+		log.Printf("service: delete finished mail: %v", err)
+	} else if n > 0 {
+		log.Printf("service: deleted %d finished mails", n)
+	}
+}
+
+// deliver tries to send the messages due at now, a batch at a time. A failed message is tried again
+// later, unless the failure is permanent or it has run out of attempts.
+func (s *MailService) deliver(now time.Time) error {
+	mails, err := s.Repository.GetDueMail(now, mailBatchSize)
+	if err != nil {
+		return err
+	}
+	for _, outgoing := range mails {
+		err := s.Sender.Send(mail.Message{
+			To:      outgoing.To,
+			Subject: outgoing.Subject,
+			Text:    outgoing.Text,
+			HTML:    outgoing.HTML,
+			Headers: outgoing.Headers,
+		})
+		if err == nil {
+			if err := s.Repository.MarkMailSent(outgoing.ID, time.Now()); err != nil {
+				return err
+			}
+			continue
+		}
+
+		attempts := outgoing.Attempts + 1
+		var next time.Time
+		var permanent *mail.PermanentError
+		if !errors.As(err, &permanent) && attempts < s.maxAttempts {
+			next = now.Add(s.backoff(attempts))
+		}
+		log.Printf("service: send mail %d to %s, attempt %d: %v", outgoing.ID, outgoing.To, attempts, err)
+		if err := s.Repository.MarkMailFailed(outgoing.ID, attempts, next, err.Error()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backoff is the wait before the next attempt after attempts failed ones: the retry delay, doubled
+// after each failure.
+func (s *MailService) backoff(attempts int) time.Duration {
+	delay := s.retryDelay
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay
+}
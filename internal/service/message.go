@@ -0,0 +1,168 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"forum/internal/model"
+	"forum/internal/repository"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidMessage = errors.New("message cannot be empty or contain control characters")
+	ErrMessageLen     = errors.New("message must not exceed 1000 characters")
+	ErrMessageSelf    = errors.New("you cannot message yourself")
+	ErrMessageBlocked = errors.New("this user does not accept messages from you")
+	ErrPeerBlocked    = errors.New("unblock this user to message them")
+	ErrBlockSelf      = errors.New("you cannot block yourself")
+)
+
+// messageLimit is how many of the latest messages of a conversation are shown.
+const messageLimit = 200
+
+type Message interface {
+	SendMessage(sender model.User, recipient, content string) (int, error)
+	GetConversations(user model.User) ([]model.Conversation, error)
+	GetMessages(user model.User, peer string) ([]model.Message, error)
+	MarkRead(user model.User, peer string) error
+	CountUnread(user model.User) (int, error)
+	BlockUser(user model.User, username string) error
+	UnblockUser(user model.User, username string) error
+	IsBlocked(blocker model.User, username string) (bool, error)
+	GetBlockedUsers(user model.User) ([]string, error)
+}
+
+type MessageService struct {
+	Repository     repository.Message
+	UserRepository repository.User
+}
+
+func newMessageService(repository repository.Message, userRepository repository.User) *MessageService {
+	return &MessageService{
+		Repository:     repository,
+		UserRepository: userRepository,
+	}
+}
+
+// peer looks up the other user of a conversation. Messages are only ever exchanged with someone
+// else, and only by signed-in users.
+func (s *MessageService) peer(user model.User, username string) (model.User, error) {
+	if user.ID == 0 {
+		return model.User{}, ErrPermissionDenied
+	}
+	peer, err := s.UserRepository.GetUserByUsername(username)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.User{}, ErrUserNotFound
+		}
+		return model.User{}, err
+	}
+	if peer.ID == user.ID {
+		return model.User{}, ErrMessageSelf
+	}
+	return peer, nil
+}
+
+// SendMessage delivers a message unless either user has blocked the other: a blocked sender is
+// refused, and a sender has to unblock someone before writing to them.
+func (s *MessageService) SendMessage(sender model.User, recipient, content string) (int, error) {
+	if !hasPermission(sender, model.PermMessage) {
+		return 0, fmt.Errorf("service: send message: %w", ErrPermissionDenied)
+	}
+	peer, err := s.peer(sender, recipient)
+	if err != nil {
+		return 0, fmt.Errorf("service: send message: %w", err)
+	}
+
+	content = strings.TrimSpace(normalizeText(content))
+	if runeLen(content) > 1000 {
+		return 0, fmt.Errorf("service: send message: %w", ErrMessageLen)
+	}
+	if content == "" || !validText(content, true) {
+		return 0, fmt.Errorf("service: send message: %w", ErrInvalidMessage)
+	}
+
+	blocked, err := s.Repository.IsBlocked(peer.ID, sender.ID)
+	if err != nil {
+		return 0, err
+	}
+	if blocked {
+		return 0, fmt.Errorf("service: send message: %w", ErrMessageBlocked)
+	}
+	if blocked, err = s.Repository.IsBlocked(sender.ID, peer.ID); err != nil {
+		return 0, err
+	}
+	if blocked {
+		return 0, fmt.Errorf("service: send message: %w", ErrPeerBlocked)
+	}
+
+	return s.Repository.CreateMessage(sender.ID, peer.ID, content, time.Now())
+}
+
+func (s *MessageService) GetConversations(user model.User) ([]model.Conversation, error) {
+	if user.ID == 0 {
+		return nil, fmt.Errorf("service: get conversations: %w", ErrPermissionDenied)
+	}
+	return s.Repository.GetConversations(user.ID)
+}
+
+func (s *MessageService) GetMessages(user model.User, peer string) ([]model.Message, error) {
+	other, err := s.peer(user, peer)
+	if err != nil {
+		return nil, fmt.Errorf("service: get messages: %w", err)
+	}
+	return s.Repository.GetMessages(user.ID, other.ID, messageLimit)
+}
+
+// MarkRead marks the messages peer sent to user as read.
+func (s *MessageService) MarkRead(user model.User, peer string) error {
+	other, err := s.peer(user, peer)
+	if err != nil {
+		return fmt.Errorf("service: mark read: %w", err)
+	}
+	return s.Repository.MarkMessagesRead(user.ID, other.ID, time.Now())
+}
+
+func (s *MessageService) CountUnread(user model.User) (int, error) {
+	if user.ID == 0 {
+		return 0, nil
+	}
+	return s.Repository.CountUnreadMessages(user.ID)
+}
+
+func (s *MessageService) BlockUser(user model.User, username string) error {
+	other, err := s.peer(user, username)
+	if err != nil {
+		if errors.Is(err, ErrMessageSelf) {
+			err = ErrBlockSelf
+		}
+		return fmt.Errorf("service: block user: %w", err)
+	}
+	return s.Repository.BlockUser(user.ID, other.ID, time.Now())
+}
+
+func (s *MessageService) UnblockUser(user model.User, username string) error {
+	other, err := s.peer(user, username)
+	if err != nil {
+		return fmt.Errorf("service: unblock user: %w", err)
+	}
+	return s.Repository.UnblockUser(user.ID, other.ID)
+}
+
+// IsBlocked reports whether blocker refuses messages from the user called username.
+func (s *MessageService) IsBlocked(blocker model.User, username string) (bool, error) {
+	other, err := s.peer(blocker, username)
+	if err != nil {
+		return false, fmt.Errorf("service: is blocked: %w", err)
+	}
+	return s.Repository.IsBlocked(blocker.ID, other.ID)
+}
+
+func (s *MessageService) GetBlockedUsers(user model.User) ([]string, error) {
+	if user.ID == 0 {
+		return nil, fmt.Errorf("service: get blocked users: %w", ErrPermissionDenied)
+	}
+	return s.Repository.GetBlockedUsers(user.ID)
+}
@@ -0,0 +1,214 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"forum/internal/model"
+	"forum/internal/repository"
+	"log"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var ErrInvalidNotificationKind = errors.New("invalid notification kind")
+
+const (
+	// notificationLimit is how many of the latest notifications are listed.
+	notificationLimit = 100
+	// maxMentions caps the users one post or comment can notify by mentioning them.
+	maxMentions = 10
+)
+
+type Notification interface {
+	GetNotifications(user model.User) ([]model.Notification, error)
+	CountUnread(user model.User) (int, error)
+	MarkAllRead(user model.User) error
+	GetPreferences(user model.User) ([]model.NotificationPreference, error)
+	UpdatePreferences(user model.User, enabled []model.NotificationKind) error
+}
+
+type NotificationService struct {
+	Repository           repository.Notification
+	PostRepository       repository.Post
+	CommentaryRepository repository.Commentary
+	UserRepository       repository.User
+}
+
+func newNotificationService(repository repository.Notification, postRepository repository.Post, commentaryRepository repository.Commentary,
+	userRepository repository.User,
+) *NotificationService {
+	return &NotificationService{
+		Repository:           repository,
+		PostRepository:       postRepository,
+		CommentaryRepository: commentaryRepository,
+		UserRepository:       userRepository,
+	}
+}
+
+func (s *NotificationService) GetNotifications(user model.User) ([]model.Notification, error) {
+	if user.ID == 0 {
+		return nil, fmt.Errorf("service: get notifications: %w", ErrPermissionDenied)
+	}
+	return s.Repository.GetNotifications(user.ID, notificationLimit)
+}
+
+func (s *NotificationService) CountUnread(user model.User) (int, error) {
+	if user.ID == 0 {
+		return 0, nil
+	}
+	return s.Repository.CountUnreadNotifications(user.ID)
+}
+
+func (s *NotificationService) MarkAllRead(user model.User) error {
+	if user.ID == 0 {
+		return fmt.Errorf("service: mark notifications read: %w", ErrPermissionDenied)
+	}
+	return s.Repository.MarkNotificationsRead(user.ID, time.Now())
+}
+
+// GetPreferences tells for every kind of notification whether user wants it. Everything is on
+// until turned off.
+func (s *NotificationService) GetPreferences(user model.User) ([]model.NotificationPreference, error) {
+	if user.ID == 0 {
+		return nil, fmt.Errorf("service: get notification preferences: %w", ErrPermissionDenied)
+	}
+	stored, err := s.Repository.GetNotificationPreferences(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	preferences := make([]model.NotificationPreference, 0, len(model.NotificationKinds()))
+	for _, kind := range model.NotificationKinds() {
+		enabled, ok := stored[kind]
+		preferences = append(preferences, model.NotificationPreference{Kind: kind, Enabled: enabled || !ok})
+	}
+	return preferences, nil
+}
+
+// UpdatePreferences turns on the kinds listed in enabled and turns off all others.
+func (s *NotificationService) UpdatePreferences(user model.User, enabled []model.NotificationKind) error {
+	if user.ID == 0 {
+		return fmt.Errorf("service: update notification preferences: %w", ErrPermissionDenied)
+	}
+	on := make(map[model.NotificationKind]bool, len(enabled))
+	for _, kind := range enabled {
+		if !kind.Valid() {
+			return fmt.Errorf("service: update notification preferences: %q: %w", kind, ErrInvalidNotificationKind)
+		}
+		on[kind] = true
+	}
+	for _, kind := range model.NotificationKinds() {
+		if err := s.Repository.SetNotificationPreference(user.ID, kind, on[kind]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// notifyComment tells the author of the post about a new comment, the author of the parent comment
+// about a reply, and anyone mentioned in it. Notifications are a side effect of the comment, so
+// failures are logged instead of failing it.
+func (s *NotificationService) notifyComment(comment model.Commentary) {
+	post, err := s.PostRepository.GetPostByID(comment.PostID)
+	if err != nil {
+		log.Printf("service: notify comment: %v", err)
+		return
+	}
+	notified := map[string]bool{comment.Author: true}
+
+	event := model.Notification{Actor: comment.Author, PostID: comment.PostID, CommentID: comment.ID}
+	if comment.ParentID != 0 {
+		parent, err := s.CommentaryRepository.GetCommentaryByID(comment.ParentID)
+		if err != nil {
+			log.Printf("service: notify comment: %v", err)
+		} else if !notified[parent.Author] {
+			notified[parent.Author] = true
+			event.Kind = model.NotifyReply
+			s.notify(parent.Author, event)
+		}
+	}
+	if !notified[post.Author] {
+		notified[post.Author] = true
+		event.Kind = model.NotifyComment
+		s.notify(post.Author, event)
+	}
+	s.notifyMentions(comment.Content, event, notified)
+}
+
+// notifyPostLike tells the author of a post someone liked it.
+func (s *NotificationService) notifyPostLike(postId int, username string) {
+	post, err := s.PostRepository.GetPostByID(postId)
+	if err != nil {
+		log.Printf("service: notify post like: %v", err)
+		return
+	}
+	if post.Author != username {
+		s.notify(post.Author, model.Notification{Actor: username, Kind: model.NotifyPostLike, PostID: postId})
+	}
+}
+
+// notifyPostMentions tells the users mentioned in a new post about it.
+func (s *NotificationService) notifyPostMentions(post model.Post) {
+	s.notifyMentions(post.Content, model.Notification{Actor: post.Author, PostID: post.ID}, map[string]bool{post.Author: true})
+}
+
+func (s *NotificationService) notifyMentions(content string, event model.Notification, notified map[string]bool) {
+	event.Kind = model.NotifyMention
+	for _, username := range mentionedUsernames(content) {
+		if !notified[username] {
+			notified[username] = true
+			s.notify(username, event)
+		}
+	}
+}
+
+// notify stores event for the user called username, if they want to hear about its kind. Unknown
+// usernames, which mentions often are, are skipped.
+func (s *NotificationService) notify(username string, event model.Notification) {
+	user, err := s.UserRepository.GetUserByUsername(username)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("service: notify: %v", err)
+		}
+		return
+	}
+	preferences, err := s.Repository.GetNotificationPreferences(user.ID)
+	if err != nil {
+		log.Printf("service: notify: %v", err)
+		return
+	}
+	if enabled, ok := preferences[event.Kind]; ok && !enabled {
+		return
+	}
+
+	event.UserID = user.ID
+	event.CreationTime = time.Now()
+	if err := s.Repository.CreateNotification(event); err != nil {
+		log.Printf("service: notify: %v", err)
+	}
+}
+
+// mentionedUsernames finds the @username mentions in text. A mention runs up to the next space,
+// without trailing punctuation, and an @ inside a word such as an email address is not one.
+func mentionedUsernames(text string) []string {
+	var usernames []string
+	seen := make(map[string]bool)
+	runes := []rune(text)
+	for i := 0; i < len(runes) && len(usernames) < maxMentions; i++ {
+		if runes[i] != '@' || i > 0 && (unicode.IsLetter(runes[i-1]) || unicode.IsNumber(runes[i-1])) {
+			continue
+		}
+		end := i + 1
+		for end < len(runes) && !unicode.IsSpace(runes[end]) {
+			end++
+		}
+		username := strings.TrimRight(string(runes[i+1:end]), ".,;:!?)]}'\"*_~`")
+		i = end - 1
+		if username != "" && !seen[username] {
+			seen[username] = true
+			usernames = append(usernames, username)
+		}
+	}
+	return usernames
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"forum/internal/model"
+	"forum/internal/repository"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// cursorToken is what an opaque cursor carries. The sort is kept so that a cursor taken from one
+// ordering is refused by another, where its key would mean something else.
+type cursorToken struct {
+	Sort     model.PostSort `json:"s,omitempty"`
+	Key      string         `json:"k,omitempty"`
+	ID       int            `json:"i"`
+	Backward bool           `json:"b,omitempty"`
+}
+
+func encodeCursor(sort model.PostSort, cursor model.Cursor) string {
+	data, _ := json.Marshal(cursorToken{Sort: sort, Key: cursor.Key, ID: cursor.ID, Backward: cursor.Backward})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(value string, sort model.PostSort) (model.Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return model.Cursor{}, fmt.Errorf("service: decode cursor: %w", ErrInvalidQuery)
+	}
+	var token cursorToken
+	if err := json.Unmarshal(data, &token); err != nil || token.ID <= 0 || token.Sort != sort {
+		return model.Cursor{}, fmt.Errorf("service: decode cursor: %w", ErrInvalidQuery)
+	}
+
+	switch sort {
+	case model.SortNew, model.SortOld:
+		if _, err := time.Parse(repository.SQLiteTimeFormat, token.Key); err != nil {
+			return model.Cursor{}, fmt.Errorf("service: decode cursor: key: %w", ErrInvalidQuery)
+		}
+	case model.SortLiked, model.SortDisliked, model.SortCommented:
+		if _, err := strconv.Atoi(token.Key); err != nil {
+			return model.Cursor{}, fmt.Errorf("service: decode cursor: key: %w", ErrInvalidQuery)
+		}
+	}
+	return model.Cursor{Key: token.Key, ID: token.ID, Backward: token.Backward}, nil
+}
+
+func postSortKey(post model.Post, sort model.PostSort) string {
+	switch sort {
+	case model.SortLiked:
+		return strconv.Itoa(post.Likes)
+	case model.SortDisliked:
+		return strconv.Itoa(post.Dislikes)
+	case model.SortCommented:
+		return strconv.Itoa(post.Comments)
+	default:
+		return post.CreationTime.Format(repository.SQLiteTimeFormat)
+	}
+}
+
+// pageBounds takes the number of rows fetched, one more than the page size being asked for, and
+// tells whether the extra row came back and which neighbouring pages exist.
+func pageBounds(cursor model.Cursor, fetched, size int) (extra, hasPrev, hasNext bool) {
+	extra = fetched > size
+	if cursor.Backward {
+		return extra, extra, true
+	}
+	return extra, cursor.ID != 0, extra
+}
+
+// getPostsPage loads the page of posts selected by filter, with their categories, and the cursors
+// of the pages around it.
+func getPostsPage(repo repository.Post, filter model.PostFilter) ([]model.Post, model.Page, error) {
+	size := filter.Limit
+	if size <= 0 {
+		size = defaultPageSize
+	}
+	filter.Limit = size + 1
+
+	posts, err := repo.GetPosts(filter)
+	if err != nil {
+		return nil, model.Page{}, err
+	}
+
+	extra, hasPrev, hasNext := pageBounds(filter.Cursor, len(posts), size)
+	if extra {
+		if filter.Cursor.Backward {
+			posts = posts[1:]
+		} else {
+			posts = posts[:size]
+		}
+	}
+
+	var page model.Page
+	if len(posts) != 0 {
+		if hasPrev {
+			first := posts[0]
+			page.Prev = encodeCursor(filter.Sort, model.Cursor{Key: postSortKey(first, filter.Sort), ID: first.ID, Backward: true})
+		}
+		if hasNext {
+			last := posts[len(posts)-1]
+			page.Next = encodeCursor(filter.Sort, model.Cursor{Key: postSortKey(last, filter.Sort), ID: last.ID})
+		}
+	}
+
+	ids := make([]int, len(posts))
+	for i, post := range posts {
+		ids[i] = post.ID
+	}
+	categories, err := repo.GetCategoriesByPostIDs(ids)
+	if err != nil {
+		return nil, model.Page{}, err
+	}
+	for i := range posts {
+		posts[i].Category = categories[posts[i].ID]
+	}
+	return posts, page, nil
+}
@@ -5,7 +5,13 @@ import (
 	"fmt"
 	"forum/internal/model"
 	"forum/internal/repository"
+	"io"
+	"log"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+	"unicode"
 )
 
 var (
@@ -13,82 +19,122 @@ var (
 	ErrInvalidPostContent = errors.New("invalid post content characters")
 	ErrPostTitleLen       = errors.New("title length out of range")
 	ErrPostContentLen     = errors.New("content length out of range")
+	ErrInvalidSearch      = errors.New("invalid search query")
 )
 
+const searchResultsLimit = 50
+
 type Post interface {
-	CreatePost(post model.Post) error
-	GetAllPosts() ([]model.Post, error)
+	CreatePost(post model.Post, images []io.Reader) (int, error)
+	GetAllPosts(filter model.PostFilter) ([]model.Post, model.Page, error)
 	GetPostByID(postId int) (model.Post, error)
-	GetAllPostsByFilter(user model.User, query map[string][]string) ([]model.Post, error)
+	UpdatePost(user model.User, post model.Post) error
+	DeletePost(user model.User, postId int) error
+	GetPostRevisions(post model.Post) ([]model.PostRevision, error)
+	Search(query string) ([]model.SearchResult, error)
 }
 
 type PostService struct {
-	Repository repository.Post
+	Repository         repository.Post
+	CategoryRepository repository.Category
+	images             *ImageService
+	notifications      *NotificationService
+	// imagesMu keeps stored image files in step with the posts using them: a file one post is
+	// removing cannot be taken up by another at the same time.
+	imagesMu sync.Mutex
 }
 
-func newPostService(repository repository.Post) *PostService {
+func newPostService(repository repository.Post, categoryRepository repository.Category, images *ImageService, notifications *NotificationService) *PostService {
 	return &PostService{
-		Repository: repository,
+		Repository:         repository,
+		CategoryRepository: categoryRepository,
+		images:             images,
+		notifications:      notifications,
 	}
 }
 
 func checkPost(post model.Post) error {
-	if len(post.Title) > 100 {
+	if runeLen(post.Title) > 100 {
 		return ErrPostTitleLen
 	}
 
-	if len(post.Content) > 1500 {
+	if runeLen(post.Content) > 1500 {
 		return ErrPostContentLen
 	}
 
-	post.Title = strings.Trim(post.Title, " \n\r")
-
-	for _, char := range post.Title {
-		if (char != 13 && char != 10 && char != 9) && (char < 32 || char > 126) {
-			return fmt.Errorf("service: Create Post: check post: %w", ErrInvalidPostTitle)
-		}
-	}
-
-	if post.Title == "" {
+	post.Title = strings.TrimSpace(post.Title)
+	if post.Title == "" || !validText(post.Title, true) {
 		return fmt.Errorf("service: Create Post: check post: %w", ErrInvalidPostTitle)
 	}
 
-	post.Content = strings.Trim(post.Content, " \n\r")
-	for _, char := range post.Content {
-		if (char != 13 && char != 10 && char != 9) && (char < 32 || char > 126) {
-			return fmt.Errorf("service: Create Post: check post: %w", ErrInvalidPostContent)
-		}
-	}
-	if post.Content == "" {
+	post.Content = strings.TrimSpace(post.Content)
+	if post.Content == "" || !validText(post.Content, true) {
 		return fmt.Errorf("service: Create Post: check post: %w", ErrInvalidPostContent)
 	}
 
 	return nil
 }
 
-func (s *PostService) CreatePost(post model.Post) error {
+// CreatePost validates and stores a new post with the images attached to it, returning its id.
+// Image files are only stored once everything checked out, and removed again if the post cannot be
+// saved.
+func (s *PostService) CreatePost(post model.Post, images []io.Reader) (int, error) {
+	post.Title, post.Content = normalizeText(post.Title), normalizeText(post.Content)
 	if err := checkPost(post); err != nil {
-		return err
+		return 0, err
 	}
-	if err := s.Repository.CreatePost(post); err != nil {
-		return err
+	var err error
+	if post.Category, err = resolveCategories(s.CategoryRepository, post.Category, nil); err != nil {
+		return 0, err
 	}
-	return nil
+	processed, err := s.images.processImages(images)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(processed) != 0 {
+		s.imagesMu.Lock()
+		defer s.imagesMu.Unlock()
+		if post.Images, err = s.images.storeImages(processed); err != nil {
+			s.removeImages(post.Images)
+			return 0, err
+		}
+	}
+	if post.ID, err = s.Repository.CreatePost(post); err != nil {
+		s.removeImages(post.Images)
+		return 0, err
+	}
+	s.notifications.notifyPostMentions(post)
+	return post.ID, nil
 }
 
-func (s *PostService) GetAllPosts() ([]model.Post, error) {
-	allPosts, err := s.Repository.GetAllPosts()
+// removeImages deletes the files of images no post uses any longer. The caller holds imagesMu.
+// Failures are only logged: the post they belonged to is already gone, or was never saved.
+func (s *PostService) removeImages(images []model.Image) {
+	if len(images) == 0 {
+		return
+	}
+	keys := make([]string, 0, 2*len(images))
+	for _, image := range images {
+		keys = append(keys, image.Key, image.ThumbKey)
+	}
+	used, err := s.Repository.ImageKeysInUse(keys)
 	if err != nil {
-		return nil, err
+		log.Printf("service: remove images: %v", err)
+		return
 	}
-	for i := range allPosts {
-		category, err := s.Repository.GetCategoriesByPostID(allPosts[i].ID)
-		if err != nil {
-			return nil, err
+	for _, key := range keys {
+		if used[key] {
+			continue
+		}
+		if err := s.images.Storage.Delete(key); err != nil {
+			log.Printf("service: remove images: %s: %v", key, err)
 		}
-		allPosts[i].Category = category
 	}
-	return allPosts, nil
+}
+
+func (s *PostService) GetAllPosts(filter model.PostFilter) ([]model.Post, model.Page, error) {
+	return getPostsPage(s.Repository, filter)
 }
 
 func (s *PostService) GetPostByID(postId int) (model.Post, error) {
@@ -102,61 +148,238 @@ func (s *PostService) GetPostByID(postId int) (model.Post, error) {
 		return model.Post{}, err
 	}
 
+	post.Images, err = s.Repository.GetImagesByPostID(postId)
+	if err != nil {
+		return model.Post{}, err
+	}
+
 	return post, nil
 }
 
-func (s *PostService) GetAllPostsByFilter(user model.User, query map[string][]string) ([]model.Post, error) {
-	var allPosts []model.Post
-	var err error
+// postSorts maps the values of each parameter that sets the order of posts to that order.
+var postSorts = map[string]map[string]model.PostSort{
+	"sort": {
+		string(model.SortNew):       model.SortNew,
+		string(model.SortOld):       model.SortOld,
+		string(model.SortLiked):     model.SortLiked,
+		string(model.SortDisliked):  model.SortDisliked,
+		string(model.SortCommented): model.SortCommented,
+	},
+	"time": {"new": model.SortNew, "old": model.SortOld},
+	"vote": {"like": model.SortLiked, "dislike": model.SortDisliked},
+}
 
-	for key, value := range query {
+// ParsePostFilter builds a post filter from URL query parameters: category (repeatable), author,
+// from and to (YYYY-MM-DD), minScore, sort, and cursor and limit for paging. The older time=new|old
+// and vote=like|dislike parameters are still understood as sort orders, giving way to sort. Other
+// parameters, such as those links pick up when shared, are ignored.
+func ParsePostFilter(query map[string][]string) (model.PostFilter, error) {
+	filter := model.PostFilter{Sort: model.SortNew, Limit: defaultPageSize}
+	var cursor string
+	for key, values := range query {
+		value := strings.Join(values, "")
 		switch key {
 		case "category":
-			allPosts, err = s.Repository.GetPostsByCategory(strings.Join(value, ""))
-			if err != nil {
-				return nil, err
+			for _, category := range values {
+				if category != "" {
+					filter.Categories = append(filter.Categories, category)
+				}
 			}
-		case "time":
-			switch strings.Join(value, "") {
-			case "new":
-				allPosts, err = s.Repository.GetNewestPosts()
-			case "old":
-				allPosts, err = s.Repository.GetOldestPosts()
-			default:
-				return nil, err
+		case "author":
+			filter.Author = value
+		case "from", "to":
+			if value == "" {
+				continue
 			}
+			date, err := time.ParseInLocation("2006-01-02", value, time.Local)
 			if err != nil {
-				return nil, err
+				return model.PostFilter{}, fmt.Errorf("service: parse post filter: %s: %w", key, ErrInvalidQuery)
 			}
-		case "vote":
-			switch strings.Join(value, "") {
-			case "like":
-				allPosts, err = s.Repository.GetMostLikedPosts()
-			case "dislike":
-				allPosts, err = s.Repository.GetMostDislikedPosts()
-			default:
-				return nil, err
+			if key == "from" {
+				filter.From = date
+			} else {
+				filter.To = date
 			}
+		case "minScore":
+			if value == "" {
+				continue
+			}
+			score, err := strconv.Atoi(value)
 			if err != nil {
-				return nil, err
+				return model.PostFilter{}, fmt.Errorf("service: parse post filter: minScore: %w", ErrInvalidQuery)
+			}
+			filter.MinScore = score
+			filter.HasMinScore = true
+		case "cursor":
+			cursor = value
+		case "limit":
+			if value == "" {
+				continue
+			}
+			limit, err := strconv.Atoi(value)
+			if err != nil || limit < 1 || limit > maxPageSize {
+				return model.PostFilter{}, fmt.Errorf("service: parse post filter: limit: %w", ErrInvalidQuery)
 			}
-		case "clean":
-			switch strings.Join(value, "") {
-			case "true":
-				allPosts, err = s.Repository.GetAllPosts()
+			filter.Limit = limit
+		}
+	}
+
+	// Several parameters can name the order, so they are read one after the other rather than
+	// in map order: sort wins, then the older time, then vote.
+	for _, key := range []string{"vote", "time", "sort"} {
+		value := strings.Join(query[key], "")
+		if value == "" {
+			continue
+		}
+		sort, ok := postSorts[key][value]
+		if !ok {
+			return model.PostFilter{}, fmt.Errorf("service: parse post filter: %s: %w", key, ErrInvalidQuery)
+		}
+		filter.Sort = sort
+	}
+
+	// The cursor is read last since it only makes sense for the sort it was taken from.
+	if cursor != "" {
+		var err error
+		if filter.Cursor, err = decodeCursor(cursor, filter.Sort); err != nil {
+			return model.PostFilter{}, err
+		}
+	}
+
+	if !filter.From.IsZero() && !filter.To.IsZero() && filter.To.Before(filter.From) {
+		return model.PostFilter{}, fmt.Errorf("service: parse post filter: empty date range: %w", ErrInvalidQuery)
+	}
+	return filter, nil
+}
+
+func (s *PostService) UpdatePost(user model.User, post model.Post) error {
+	oldPost, err := s.GetPostByID(post.ID)
+	if err != nil {
+		return err
+	}
+
+	if !canModify(user, oldPost.Author, model.PermCreatePost, model.PermEditAnyPost) {
+		return fmt.Errorf("service: update post: %w", ErrPermissionDenied)
+	}
+
+	post.Title, post.Content = normalizeText(post.Title), normalizeText(post.Content)
+	if err := checkPost(post); err != nil {
+		return err
+	}
+	if post.Category, err = resolveCategories(s.CategoryRepository, post.Category, oldPost.Category); err != nil {
+		return err
+	}
+
+	revision := model.PostRevision{
+		PostID:   oldPost.ID,
+		Title:    oldPost.Title,
+		Content:  oldPost.Content,
+		Category: model.CategorySlugs(oldPost.Category),
+		Editor:   user.Username,
+	}
+	diffRevision(&revision, model.PostRevision{Title: post.Title, Content: post.Content, Category: model.CategorySlugs(post.Category)})
+	return s.Repository.UpdatePost(post, revision)
+}
+
+func (s *PostService) DeletePost(user model.User, postId int) error {
+	post, err := s.Repository.GetPostByID(postId)
+	if err != nil {
+		return err
+	}
 
+	if !canModify(user, post.Author, model.PermCreatePost, model.PermDeleteAnyPost) {
+		return fmt.Errorf("service: delete post: %w", ErrPermissionDenied)
+	}
+
+	images, err := s.Repository.GetImagesByPostID(post.ID)
+	if err != nil {
+		return err
+	}
+	if len(images) != 0 {
+		s.imagesMu.Lock()
+		defer s.imagesMu.Unlock()
+	}
+	if err := s.Repository.DeletePost(post.ID, post.Author); err != nil {
+		return err
+	}
+	s.removeImages(images)
+	return nil
+}
+
+// GetPostRevisions returns the edit history of a post, newest first. Each revision holds the state
+// the post had before an edit, along with the diff to the state that edit produced. Diffs are worked
+// out when a post is edited; revisions saved before that get theirs here, once.
+func (s *PostService) GetPostRevisions(post model.Post) ([]model.PostRevision, error) {
+	revisions, err := s.Repository.GetRevisionsByPostID(post.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	next := model.PostRevision{Title: post.Title, Content: post.Content, Category: model.CategorySlugs(post.Category)}
+	for i := len(revisions) - 1; i >= 0; i-- {
+		// A title is never empty, so neither is the diff of one.
+		if revisions[i].TitleDiff == nil {
+			diffRevision(&revisions[i], next)
+			if err := s.Repository.SetRevisionDiff(revisions[i]); err != nil {
+				log.Printf("service: get post revisions: %v", err)
 			}
+		}
+		next = revisions[i]
+	}
+
+	for i, j := 0, len(revisions)-1; i < j; i, j = i+1, j-1 {
+		revisions[i], revisions[j] = revisions[j], revisions[i]
+	}
+	return revisions, nil
+}
+
+// Search looks posts and comments up by words, "quoted phrases", prefix* terms and the author: and
+// category: operators. Results are ranked by relevance unless only operators are given.
+func (s *PostService) Search(query string) ([]model.SearchResult, error) {
+	searchQuery := parseSearchQuery(query)
+	if len(searchQuery.Terms) == 0 && searchQuery.Author == "" && searchQuery.Category == "" {
+		return nil, fmt.Errorf("service: search: %w", ErrInvalidSearch)
+	}
+	searchQuery.Limit = searchResultsLimit
+	return s.Repository.Search(searchQuery)
+}
+
+func parseSearchQuery(query string) model.SearchQuery {
+	var searchQuery model.SearchQuery
+	for _, token := range tokenizeSearchQuery(query) {
+		switch {
+		case strings.HasPrefix(token, "author:") && len(token) > len("author:"):
+			searchQuery.Author = strings.TrimPrefix(token, "author:")
+		case strings.HasPrefix(token, "category:") && len(token) > len("category:"):
+			searchQuery.Category = strings.TrimPrefix(token, "category:")
 		default:
-			return nil, errors.New("post filter service")
+			searchQuery.Terms = append(searchQuery.Terms, token)
 		}
+	}
+	return searchQuery
+}
 
-		for i := range allPosts {
-			categories, err := s.Repository.GetCategoriesByPostID(allPosts[i].ID)
-			if err != nil {
-				return nil, err
+// tokenizeSearchQuery splits a query on whitespace, keeping double-quoted parts (including quoted
+// operator values such as author:"john doe") together as one token without the quotes.
+func tokenizeSearchQuery(query string) []string {
+	var tokens []string
+	var token strings.Builder
+	quoted := false
+	for _, char := range query {
+		switch {
+		case char == '"':
+			quoted = !quoted
+		case !quoted && unicode.IsSpace(char):
+			if token.Len() > 0 {
+				tokens = append(tokens, token.String())
+				token.Reset()
 			}
-			allPosts[i].Category = categories
+		default:
+			token.WriteRune(char)
 		}
 	}
-	return allPosts, nil
+	if token.Len() > 0 {
+		tokens = append(tokens, token.String())
+	}
+	return tokens
 }
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"forum/internal/model"
+	"forum/internal/repository"
+	"net/url"
+	"testing"
+)
+
+// createTestPosts writes n posts in two categories each, by a user made for them.
+func createTestPosts(t testing.TB, repo *repository.Repository, n int) {
+	t.Helper()
+	if err := repo.CreateUser(model.User{Email: "author@example.com", Username: "author", Password: "password"}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		post := model.Post{
+			Author:   "author",
+			Title:    fmt.Sprintf("post %d", i),
+			Content:  "content",
+			Category: []model.Category{{Slug: "alem"}, {Slug: "study"}},
+		}
+		if _, err := repo.CreatePost(post); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestParsePostFilterSort(t *testing.T) {
+	tests := []struct {
+		query string
+		sort  model.PostSort
+		err   error
+	}{
+		{"", model.SortNew, nil},
+		{"sort=&time=&vote=", model.SortNew, nil},
+		{"time=old", model.SortOld, nil},
+		{"vote=dislike", model.SortDisliked, nil},
+		{"sort=old&time=new", model.SortOld, nil},
+		{"time=new&sort=old", model.SortOld, nil},
+		{"time=old&vote=like", model.SortOld, nil},
+		{"vote=like&time=old&sort=commented", model.SortCommented, nil},
+		{"sort=&time=old", model.SortOld, nil},
+		{"sort=old&time=sideways", "", ErrInvalidQuery},
+		{"vote=meh", "", ErrInvalidQuery},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			query, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Go randomises map order, so a few runs catch a result that depends on it.
+			for i := 0; i < 20; i++ {
+				filter, err := ParsePostFilter(query)
+				if !errors.Is(err, tt.err) || filter.Sort != tt.sort {
+					t.Fatalf("got %q, %v; want %q, %v", filter.Sort, err, tt.sort, tt.err)
+				}
+			}
+		})
+	}
+}
+
+func TestGetAllPostsQueryCount(t *testing.T) {
+	for _, posts := range []int{5, 50} {
+		t.Run(fmt.Sprint(posts), func(t *testing.T) {
+			svc, repo, connector := newTestService(t)
+			createTestPosts(t, repo, posts)
+
+			var page []model.Post
+			queries := countQueries(connector, func() {
+				var err error
+				if page, _, err = svc.GetAllPosts(model.PostFilter{Sort: model.SortNew, Limit: posts}); err != nil {
+					t.Fatal(err)
+				}
+			})
+			if len(page) != posts {
+				t.Fatalf("got %d posts, want %d", len(page), posts)
+			}
+			for _, post := range page {
+				if len(post.Category) != 2 {
+					t.Fatalf("post %d has %d categories, want 2", post.ID, len(post.Category))
+				}
+			}
+			if queries != 2 {
+				t.Errorf("a page of %d posts ran %d queries, want 2", posts, queries)
+			}
+		})
+	}
+}
+
+func BenchmarkGetAllPosts(b *testing.B) {
+	svc, repo, _ := newTestService(b)
+	createTestPosts(b, repo, maxPageSize)
+	filter := model.PostFilter{Sort: model.SortNew, Limit: maxPageSize}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := svc.GetAllPosts(filter); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"forum/internal/model"
+	"forum/internal/repository"
+)
+
+var (
+	ErrPermissionDenied = errors.New("permission denied")
+	ErrInvalidRole      = errors.New("invalid role")
+	ErrUnverified       = errors.New("confirm your email address first")
+)
+
+var rolePermissions = map[model.Role][]model.Permission{
+	model.RoleGuest: {},
+	model.RoleUser: {
+		model.PermCreatePost,
+		model.PermComment,
+		model.PermVote,
+		model.PermMessage,
+		model.PermChat,
+	},
+	model.RoleModerator: {
+		model.PermCreatePost,
+		model.PermComment,
+		model.PermVote,
+		model.PermEditAnyPost,
+		model.PermDeleteAnyPost,
+		model.PermEditAnyComment,
+		model.PermDeleteAnyComment,
+		model.PermMessage,
+		model.PermChat,
+	},
+	model.RoleAdmin: {
+		model.PermCreatePost,
+		model.PermComment,
+		model.PermVote,
+		model.PermEditAnyPost,
+		model.PermDeleteAnyPost,
+		model.PermEditAnyComment,
+		model.PermDeleteAnyComment,
+		model.PermManageRoles,
+		model.PermManageCategories,
+		model.PermMessage,
+		model.PermChat,
+	},
+}
+
+// permissionScopes is the token scope each permission needs. Permissions missing here, such as
+// managing roles, are never available through a personal access token.
+var permissionScopes = map[model.Permission]model.Scope{
+	model.PermCreatePost:       model.ScopePost,
+	model.PermComment:          model.ScopePost,
+	model.PermVote:             model.ScopeVote,
+	model.PermEditAnyPost:      model.ScopeModerate,
+	model.PermDeleteAnyPost:    model.ScopeModerate,
+	model.PermEditAnyComment:   model.ScopeModerate,
+	model.PermDeleteAnyComment: model.ScopeModerate,
+}
+
+// hasPermission reports whether user may do what permission allows. Users who have not confirmed
+// their email address may do nothing beyond browsing, whatever their role.
+func hasPermission(user model.User, permission model.Permission) bool {
+	if user.ID == 0 || !user.Verified {
+		return false
+	}
+	if user.Scopes != 0 && user.Scopes&permissionScopes[permission] == 0 {
+		return false
+	}
+	for _, p := range rolePermissions[user.Role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// canModify reports whether user may change content written by author: either through a moderation
+// permission, or as the author as long as their role still allows them to publish such content.
+func canModify(user model.User, author string, own, any model.Permission) bool {
+	if hasPermission(user, any) {
+		return true
+	}
+	return user.Username == author && hasPermission(user, own)
+}
+
+type Role interface {
+	CheckPermission(user model.User, permission model.Permission) error
+	CanModify(user model.User, author string, own, any model.Permission) bool
+	GetAllUsers(actor model.User) ([]model.User, error)
+	SetRole(actor model.User, username string, role model.Role) error
+}
+
+type RoleService struct {
+	Repository repository.User
+}
+
+func newRoleService(repository repository.User) *RoleService {
+	return &RoleService{
+		Repository: repository,
+	}
+}
+
+func (s *RoleService) CheckPermission(user model.User, permission model.Permission) error {
+	if user.ID != 0 && !user.Verified {
+		return fmt.Errorf("service: check permission: %w: %w", ErrPermissionDenied, ErrUnverified)
+	}
+	if !hasPermission(user, permission) {
+		return fmt.Errorf("service: check permission: %w", ErrPermissionDenied)
+	}
+	return nil
+}
+
+func (s *RoleService) CanModify(user model.User, author string, own, any model.Permission) bool {
+	return canModify(user, author, own, any)
+}
+
+func (s *RoleService) GetAllUsers(actor model.User) ([]model.User, error) {
+	if err := s.CheckPermission(actor, model.PermManageRoles); err != nil {
+		return nil, err
+	}
+	return s.Repository.GetAllUsers()
+}
+
+func (s *RoleService) SetRole(actor model.User, username string, role model.Role) error {
+	if err := s.CheckPermission(actor, model.PermManageRoles); err != nil {
+		return err
+	}
+
+	if _, ok := rolePermissions[role]; !ok {
+		return fmt.Errorf("service: set role: %w", ErrInvalidRole)
+	}
+
+	// Admins cannot change their own role so the forum is never left without one by accident.
+	if actor.Username == username {
+		return fmt.Errorf("service: set role: own role: %w", ErrPermissionDenied)
+	}
+
+	if err := s.Repository.UpdateUserRole(username, role); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("service: set role: %w", ErrUserNotFound)
+		}
+		return err
+	}
+	return nil
+}
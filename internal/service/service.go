@@ -1,25 +1,67 @@
 package service
 
 import (
+	"forum/internal/config"
+	"forum/internal/event"
+	"forum/internal/mail"
 	"forum/internal/repository"
+	"forum/internal/storage"
+	"time"
 )
 
 type Service struct {
 	Auth
+	APIToken
 	Post
 	Commentary
 	VotePost
 	VoteComment
 	User
+	Role
+	Category
+	Image
+	Message
+	Notification
+	Chat
+	Mail
+	Digest
+
+	// Events carries what happens on posts and in chat rooms to the pages showing them.
+	Events *event.Bus
 }
 
-func NewService(repository *repository.Repository) *Service {
+const (
+	// eventHistorySize is how many events of each post are kept for pages reconnecting.
+	eventHistorySize = 64
+	// eventHistoryAge is how long the events of a post nobody watches are kept after the last one.
+	eventHistoryAge = 10 * time.Minute
+	// eventBufferSize is how many events may wait for a page before it is disconnected.
+	eventBufferSize = 32
+)
+
+func NewService(repository *repository.Repository, storage storage.Storage, sender mail.Sender, templates *mail.Templates, cfg *config.Config) *Service {
+	events := event.NewBus(eventHistorySize, eventHistoryAge, eventBufferSize)
+	category := newCategoryService(repository.Category)
+	mailer := newMailService(repository.Outbox, sender, templates, cfg)
+	notification := newNotificationService(repository.Notification, repository.Post, repository.Commentary, repository.User)
+	image := newImageService(storage, cfg)
 	return &Service{
-		Auth:        newAuthService(repository.Auth),
-		Post:        newPostService(repository.Post),
-		Commentary:  newCommentaryService(repository.Commentary),
-		VotePost:    newVotePostService(repository.VotePost),
-		VoteComment: newVoteCommentaryService(repository.VoteComment),
-		User:        newUserService(repository.User),
+		Auth:         newAuthService(repository.Auth, mailer, cfg),
+		APIToken:     newAPITokenService(repository.APIToken),
+		Post:         newPostService(repository.Post, repository.Category, image, notification),
+		Commentary:   newCommentaryService(repository.Commentary, cfg.Forum.CommentMaxDepth, notification, events),
+		VotePost:     newVotePostService(repository.VotePost, repository.Post, notification, events),
+		VoteComment:  newVoteCommentaryService(repository.VoteComment, repository.Commentary, events),
+		User:         newUserService(repository.User, repository.Post),
+		Role:         newRoleService(repository.User),
+		Category:     category,
+		Image:        image,
+		Message:      newMessageService(repository.Message, repository.User),
+		Notification: notification,
+		Chat: newChatService(repository.Chat, cfg.Chat.HistorySize, cfg.Chat.RateLimit, time.Duration(cfg.Chat.RatePeriod)*time.Second,
+			category, events),
+		Mail:   mailer,
+		Digest: newDigestService(repository.Digest, category, mailer),
+		Events: events,
 	}
 }
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"forum/internal/config"
+	"forum/internal/mail"
+	"forum/internal/repository"
+	"forum/internal/storage"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// countingConnector opens SQLite connections that count the statements run on them.
+type countingConnector struct {
+	dsn     string
+	queries int64
+}
+
+func (c *countingConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Driver().Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &countingConn{SQLiteConn: conn.(*sqlite3.SQLiteConn), queries: &c.queries}, nil
+}
+
+func (c *countingConnector) Driver() driver.Driver {
+	return &sqlite3.SQLiteDriver{}
+}
+
+type countingConn struct {
+	*sqlite3.SQLiteConn
+	queries *int64
+}
+
+func (c *countingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	atomic.AddInt64(c.queries, 1)
+	return c.SQLiteConn.QueryContext(ctx, query, args)
+}
+
+func (c *countingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	atomic.AddInt64(c.queries, 1)
+	return c.SQLiteConn.ExecContext(ctx, query, args)
+}
+
+// countQueries returns how many statements f ran against the database.
+func countQueries(connector *countingConnector, f func()) int64 {
+	before := atomic.LoadInt64(&connector.queries)
+	f()
+	return atomic.LoadInt64(&connector.queries) - before
+}
+
+// newTestService builds the services on a fresh in-memory database, configured as configs/config.json
+// is, and returns them with the repository underneath, to set up what a test needs.
+func newTestService(t testing.TB) (*Service, *repository.Repository, *countingConnector) {
+	t.Helper()
+	cfg := config.NewConfig("../../configs/config.json")
+	if cfg == nil {
+		t.Fatal("cannot read configs/config.json")
+	}
+	cfg.Uploads.Dir = t.TempDir()
+	cfg.Uploads.URLSecret = "secret"
+
+	name := strings.NewReplacer("/", "_", " ", "_").Replace(t.Name())
+	connector := &countingConnector{dsn: "file:" + name + "?mode=memory&cache=shared&_foreign_keys=on"}
+	db := sql.OpenDB(connector)
+	// The in-memory database lives as long as one connection to it stays open.
+	db.SetMaxIdleConns(1)
+	db.SetConnMaxLifetime(0)
+	t.Cleanup(func() { db.Close() })
+	if err := repository.CreateTables(db); err != nil {
+		t.Fatal(err)
+	}
+
+	storage, err := storage.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender, err := mail.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	templates, err := mail.ParseTemplates("../../web/mail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := repository.NewRepository(db, cfg)
+	return NewService(repo, storage, sender, templates, cfg), repo, connector
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// normalizeText puts user text into NFC, so the same words typed with precomposed or combining
+// characters are stored, counted and compared alike.
+func normalizeText(text string) string {
+	return norm.NFC.String(text)
+}
+
+// isBidiControl reports whether char overrides or isolates text direction. These can make text
+// read differently from how it is stored, so they are never accepted.
+func isBidiControl(char rune) bool {
+	return char >= '\u202a' && char <= '\u202e' || char >= '\u2066' && char <= '\u2069'
+}
+
+// validText reports whether text is valid UTF-8 free of control and direction override characters.
+// Multiline text may also hold tabs and line breaks.
+func validText(text string, multiline bool) bool {
+	if !utf8.ValidString(text) {
+		return false
+	}
+	for _, char := range text {
+		if multiline && (char == '\n' || char == '\r' || char == '\t') {
+			continue
+		}
+		if unicode.IsControl(char) || isBidiControl(char) {
+			return false
+		}
+	}
+	return true
+}
+
+// validUsername reports whether username only holds letters, combining marks and digits in any
+// script, plus the printable ASCII characters usernames could always contain.
+func validUsername(username string) bool {
+	if !utf8.ValidString(username) {
+		return false
+	}
+	for _, char := range username {
+		if char >= 32 && char <= 126 {
+			continue
+		}
+		if !unicode.IsLetter(char) && !unicode.IsMark(char) && !unicode.IsNumber(char) {
+			return false
+		}
+	}
+	return true
+}
+
+// runeLen counts characters rather than bytes, so limits are the same in every language.
+func runeLen(text string) int {
+	return utf8.RuneCountInString(text)
+}
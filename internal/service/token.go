@@ -0,0 +1,115 @@
+package service
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"forum/internal/model"
+	"forum/internal/repository"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	ErrInvalidTokenName = errors.New("token name must be 1 to 50 characters")
+	ErrInvalidScope     = errors.New("invalid token scope")
+	ErrTokenNotFound    = errors.New("token not found")
+)
+
+// apiTokenUseInterval is how long after the last use of a token is recorded it is recorded again.
+// Requests in between leave it as it is, so scripts do not write to the database on every call.
+const apiTokenUseInterval = 10 * time.Minute
+
+type APIToken interface {
+	CreateAPIToken(actor model.User, name string, scopes model.Scope) (string, error)
+	GetAPITokens(userId int) ([]model.APIToken, error)
+	RevokeAPIToken(actor model.User, tokenId int) error
+	ParseAPIToken(token string) (model.User, error)
+}
+
+type APITokenService struct {
+	Repository repository.APIToken
+}
+
+func newAPITokenService(repository repository.APIToken) *APITokenService {
+	return &APITokenService{
+		Repository: repository,
+	}
+}
+
+// CreateAPIToken issues a personal access token for actor and returns it. The token itself is not
+// stored, so this is the only time it can be shown. Tokens cannot be used to issue more tokens.
+func (s *APITokenService) CreateAPIToken(actor model.User, name string, scopes model.Scope) (string, error) {
+	if actor.ID == 0 || actor.Scopes != 0 {
+		return "", fmt.Errorf("service: create api token: %w", ErrPermissionDenied)
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > 50 {
+		return "", fmt.Errorf("service: create api token: %w", ErrInvalidTokenName)
+	}
+	var all model.Scope
+	for _, scope := range model.Scopes() {
+		all |= scope
+	}
+	if scopes == 0 || scopes&^all != 0 {
+		return "", fmt.Errorf("service: create api token: %w", ErrInvalidScope)
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("service: create api token: %w", err)
+	}
+	token := model.APITokenPrefix + hex.EncodeToString(secret)
+
+	apiToken := model.APIToken{
+		UserID:       actor.ID,
+		Name:         name,
+		Hint:         token[len(token)-4:],
+		Scopes:       scopes,
+		CreationTime: time.Now(),
+	}
+	if _, err := s.Repository.CreateAPIToken(apiToken, model.HashToken(token)); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func (s *APITokenService) GetAPITokens(userId int) ([]model.APIToken, error) {
+	return s.Repository.GetAPITokensByUserID(userId)
+}
+
+func (s *APITokenService) RevokeAPIToken(actor model.User, tokenId int) error {
+	if actor.ID == 0 || actor.Scopes != 0 {
+		return fmt.Errorf("service: revoke api token: %w", ErrPermissionDenied)
+	}
+	if err := s.Repository.DeleteAPIToken(actor.ID, tokenId); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("service: revoke api token: %w", ErrTokenNotFound)
+		}
+		return err
+	}
+	return nil
+}
+
+// ParseAPIToken returns the owner of a personal access token, limited to the token's scopes. When
+// the token was last used is kept to within apiTokenUseInterval.
+func (s *APITokenService) ParseAPIToken(token string) (model.User, error) {
+	hash := model.HashToken(token)
+	user, lastUsed, err := s.Repository.GetUserByAPITokenHash(hash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.User{}, ErrUserNotFound
+		}
+		return model.User{}, err
+	}
+	if now := time.Now(); now.Sub(lastUsed) >= apiTokenUseInterval {
+		if err := s.Repository.UpdateAPITokenLastUsed(hash, now); err != nil {
+			return model.User{}, err
+		}
+	}
+	return user, nil
+}
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"forum/internal/model"
+	"testing"
+	"time"
+)
+
+func TestParseAPITokenRecordsUseOnlyWhenDue(t *testing.T) {
+	svc, repo, connector := newTestService(t)
+	if err := repo.CreateUser(model.User{Email: "alice@example.com", Username: "alice", Password: "password"}); err != nil {
+		t.Fatal(err)
+	}
+	user, err := repo.GetUser("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := svc.CreateAPIToken(user, "script", model.ScopeRead)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		lastUsed time.Time
+		queries  int64
+	}{
+		{"never used", time.Time{}, 2},
+		{"just used", time.Now(), 1},
+		{"due", time.Now().Add(-apiTokenUseInterval - time.Minute), 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !tt.lastUsed.IsZero() {
+				if err := repo.UpdateAPITokenLastUsed(model.HashToken(token), tt.lastUsed); err != nil {
+					t.Fatal(err)
+				}
+			}
+			queries := countQueries(connector, func() {
+				if _, err := svc.ParseAPIToken(token); err != nil {
+					t.Fatal(err)
+				}
+			})
+			if queries != tt.queries {
+				t.Errorf("%d queries, want %d", queries, tt.queries)
+			}
+		})
+	}
+}
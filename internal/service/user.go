@@ -10,53 +10,55 @@ import (
 var ErrInvalidQuery = errors.New("invalid query request")
 
 type User interface {
-	GetPostByUsername(username string, query map[string][]string) ([]model.Post, error)
+	GetPostByUsername(username string, query map[string][]string) ([]model.Post, model.Page, error)
 	GetUserByUsername(username string) (model.User, error)
 }
 
 type UserService struct {
-	Repository repository.User
+	Repository     repository.User
+	PostRepository repository.Post
 }
 
-func newUserService(repository repository.User) *UserService {
+func newUserService(repository repository.User, postRepository repository.Post) *UserService {
 	return &UserService{
-		Repository: repository,
+		Repository:     repository,
+		PostRepository: postRepository,
 	}
 }
 
-func (s *UserService) GetPostByUsername(username string, query map[string][]string) ([]model.Post, error) {
-	var posts []model.Post
-	var err error
-
+// GetPostByUsername returns the posts the user created, liked, disliked or commented on, as chosen
+// by the posts parameter. The remaining parameters narrow the list like on the home page.
+func (s *UserService) GetPostByUsername(username string, query map[string][]string) ([]model.Post, model.Page, error) {
 	search, ok := query["posts"]
 	if !ok {
-		return nil, ErrInvalidQuery
+		return nil, model.Page{}, ErrInvalidQuery
+	}
+
+	rest := make(map[string][]string, len(query))
+	for key, value := range query {
+		if key != "posts" {
+			rest[key] = value
+		}
+	}
+	filter, err := ParsePostFilter(rest)
+	if err != nil {
+		return nil, model.Page{}, err
 	}
 
 	switch strings.Join(search, "") {
 	case "created":
-		posts, err = s.Repository.GetPostByUsername(username)
+		filter.Author = username
 	case "liked":
-		posts, err = s.Repository.GetLikedPostByUsername(username)
+		filter.LikedBy = username
 	case "disliked":
-		posts, err = s.Repository.GetDislikedPostByUsername(username)
+		filter.DislikedBy = username
 	case "commented":
-		posts, err = s.Repository.GetCommentedPostByUsername(username)
+		filter.CommentedBy = username
 	default:
-		return nil, ErrInvalidQuery
-	}
-	if err != nil {
-		return nil, err
+		return nil, model.Page{}, ErrInvalidQuery
 	}
 
-	for i := range posts {
-		category, err := s.Repository.GetAllCategoriesByPostId(posts[i].ID)
-		if err != nil {
-			return nil, err
-		}
-		posts[i].Category = category
-	}
-	return posts, nil
+	return getPostsPage(s.PostRepository, filter)
 }
 
 func (s *UserService) GetUserByUsername(username string) (model.User, error) {
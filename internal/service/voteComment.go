@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"forum/internal/event"
 	"forum/internal/repository"
 )
 
@@ -15,15 +16,36 @@ type VoteComment interface {
 }
 
 type VoteCommentaryService struct {
-	Repository repository.VoteComment
+	Repository           repository.VoteComment
+	CommentaryRepository repository.Commentary
+	events               *event.Bus
 }
 
-func newVoteCommentaryService(repository repository.VoteComment) *VoteCommentaryService {
+func newVoteCommentaryService(repository repository.VoteComment, commentaryRepository repository.Commentary, events *event.Bus) *VoteCommentaryService {
 	return &VoteCommentaryService{
-		Repository: repository,
+		Repository:           repository,
+		CommentaryRepository: commentaryRepository,
+		events:               events,
 	}
 }
+
 func (s *VoteCommentaryService) LikeCommentary(commentId int, username string) error {
+	if err := s.likeCommentary(commentId, username); err != nil {
+		return err
+	}
+	s.publishCommentVotes(commentId)
+	return nil
+}
+
+func (s *VoteCommentaryService) DislikeCommentary(commentId int, username string) error {
+	if err := s.dislikeCommentary(commentId, username); err != nil {
+		return err
+	}
+	s.publishCommentVotes(commentId)
+	return nil
+}
+
+func (s *VoteCommentaryService) likeCommentary(commentId int, username string) error {
 	if err := s.Repository.CommentaryLiked(commentId, username); err == nil {
 		if err := s.Repository.RemoveLikeFromCommentary(commentId, username); err != nil {
 			return err
@@ -47,7 +69,7 @@ func (s *VoteCommentaryService) LikeCommentary(commentId int, username string) e
 	return nil
 }
 
-func (s *VoteCommentaryService) DislikeCommentary(commentId int, username string) error {
+func (s *VoteCommentaryService) dislikeCommentary(commentId int, username string) error {
 	if err := s.Repository.CommentaryDisliked(commentId, username); err == nil {
 		if err := s.Repository.RemoveDislikeFromCommentary(commentId, username); err != nil {
 			return err
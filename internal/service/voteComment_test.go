@@ -0,0 +1,69 @@
+package service
+
+import (
+	"fmt"
+	"forum/internal/model"
+	"testing"
+)
+
+func TestCommentVotesQueryCount(t *testing.T) {
+	for _, comments := range []int{5, 50} {
+		t.Run(fmt.Sprint(comments), func(t *testing.T) {
+			svc, repo, connector := newTestService(t)
+			voters := []string{"user0", "user1", "user2"}
+			for _, username := range voters {
+				if err := repo.CreateUser(model.User{Email: username + "@example.com", Username: username, Password: "password"}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			postId, err := repo.CreatePost(model.Post{Author: voters[0], Title: "post", Content: "content"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			parentId := 0
+			for i := 0; i < comments; i++ {
+				id, err := repo.CreateCommentary(model.Commentary{PostID: postId, ParentID: parentId, Author: voters[0], Content: "comment"})
+				if err != nil {
+					t.Fatal(err)
+				}
+				// Every other comment answers the one before it, so the thread has replies too.
+				if i%2 == 0 {
+					parentId = id
+				} else {
+					parentId = 0
+				}
+				if err := repo.LikeCommentary(id, voters[1]); err != nil {
+					t.Fatal(err)
+				}
+				if err := repo.LikeCommentary(id, voters[2]); err != nil {
+					t.Fatal(err)
+				}
+				if err := repo.DislikeCommentary(id, voters[0]); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var likes, dislikes map[int][]string
+			queries := countQueries(connector, func() {
+				var err error
+				if likes, err = svc.GetCommentaryLikes(postId); err != nil {
+					t.Fatal(err)
+				}
+				if dislikes, err = svc.GetCommentaryDislikes(postId); err != nil {
+					t.Fatal(err)
+				}
+			})
+			if len(likes) != comments || len(dislikes) != comments {
+				t.Fatalf("got voters for %d and %d comments, want %d", len(likes), len(dislikes), comments)
+			}
+			for id, users := range likes {
+				if len(users) != 2 || len(dislikes[id]) != 1 {
+					t.Fatalf("comment %d has %d likes and %d dislikes, want 2 and 1", id, len(users), len(dislikes[id]))
+				}
+			}
+			if queries != 2 {
+				t.Errorf("the voters of %d comments took %d queries, want 2", comments, queries)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"forum/internal/event"
 	"forum/internal/repository"
 )
 
@@ -15,16 +16,38 @@ type VotePost interface {
 }
 
 type VotePostService struct {
-	Repository repository.VotePost
+	Repository     repository.VotePost
+	PostRepository repository.Post
+	notifications  *NotificationService
+	events         *event.Bus
 }
 
-func newVotePostService(repository repository.VotePost) *VotePostService {
+func newVotePostService(repository repository.VotePost, postRepository repository.Post, notifications *NotificationService, events *event.Bus) *VotePostService {
 	return &VotePostService{
-		Repository: repository,
+		Repository:     repository,
+		PostRepository: postRepository,
+		notifications:  notifications,
+		events:         events,
 	}
 }
 
 func (s *VotePostService) LikePost(postId int, username string) error {
+	if err := s.likePost(postId, username); err != nil {
+		return err
+	}
+	s.publishPostVotes(postId)
+	return nil
+}
+
+func (s *VotePostService) DislikePost(postId int, username string) error {
+	if err := s.dislikePost(postId, username); err != nil {
+		return err
+	}
+	s.publishPostVotes(postId)
+	return nil
+}
+
+func (s *VotePostService) likePost(postId int, username string) error {
 	if err := s.Repository.PostLiked(postId, username); err == nil {
 		if err := s.Repository.RemoveLikeFromPost(postId, username); err != nil {
 			return err
@@ -45,10 +68,11 @@ func (s *VotePostService) LikePost(postId int, username string) error {
 	if err := s.Repository.LikePost(postId, username); err != nil {
 		return err
 	}
+	s.notifications.notifyPostLike(postId, username)
 	return nil
 }
 
-func (s *VotePostService) DislikePost(postId int, username string) error {
+func (s *VotePostService) dislikePost(postId int, username string) error {
 	if err := s.Repository.PostDisliked(postId, username); err == nil {
 		if err := s.Repository.RemoveDislikeFromPost(postId, username); err != nil {
 			return err
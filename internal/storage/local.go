@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Local stores files in a directory on disk, spread over subdirectories named after the first two
+// characters of their keys.
+type Local struct {
+	dir string
+}
+
+func NewLocal(dir string) (*Local, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("storage: local: %w", err)
+	}
+	return &Local{dir: dir}, nil
+}
+
+func (s *Local) path(key string) string {
+	return filepath.Join(s.dir, key[:2], key)
+}
+
+// Put writes the file through a temporary file and a rename, so a partly written file is never
+// served. A key that is already stored is left alone since it holds the same bytes.
+func (s *Local) Put(key string, data []byte, contentType string) error {
+	if !ValidKey(key) || len(key) < 3 {
+		return ErrInvalidKey
+	}
+	path := s.path(key)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("storage: local: put: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("storage: local: put: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("storage: local: put: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("storage: local: put: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return fmt.Errorf("storage: local: put: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("storage: local: put: %w", err)
+	}
+	return nil
+}
+
+func (s *Local) Get(key string) (io.ReadCloser, error) {
+	if !ValidKey(key) || len(key) < 3 {
+		return nil, ErrInvalidKey
+	}
+	file, err := os.Open(s.path(key))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("storage: local: get: %w", err)
+	}
+	return file, nil
+}
+
+func (s *Local) Delete(key string) error {
+	if !ValidKey(key) || len(key) < 3 {
+		return ErrInvalidKey
+	}
+	if err := os.Remove(s.path(key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("storage: local: delete: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,250 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	s3Timeout       = 30 * time.Second
+	s3DateFormat    = "20060102T150405Z"
+	s3SignAlgorithm = "AWS4-HMAC-SHA256"
+)
+
+// S3 stores files as objects in a bucket of an S3-compatible service, such as AWS S3 or MinIO.
+// Requests are signed with AWS Signature Version 4.
+type S3 struct {
+	client    *http.Client
+	endpoint  *url.URL
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	pathStyle bool
+}
+
+// NewS3 returns storage for bucket at endpoint. With pathStyle set the bucket is named in the path
+// (http://host/bucket/key), as MinIO expects; otherwise it is part of the host name
+// (http://bucket.host/key), as AWS prefers.
+func NewS3(endpoint, region, bucket, accessKey, secretKey string, pathStyle bool) (*S3, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("storage: s3: invalid endpoint %q", endpoint)
+	}
+	if region == "" || bucket == "" || accessKey == "" || secretKey == "" {
+		return nil, errors.New("storage: s3: region, bucket and credentials are required")
+	}
+	return &S3{
+		client:    &http.Client{Timeout: s3Timeout},
+		endpoint:  u,
+		region:    region,
+		bucket:    bucket,
+		accessKey: accessKey,
+		secretKey: secretKey,
+		pathStyle: pathStyle,
+	}, nil
+}
+
+func (s *S3) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	if s.pathStyle {
+		u.Path += "/" + s.bucket + "/" + key
+	} else {
+		u.Host = s.bucket + "." + u.Host
+		u.Path += "/" + key
+	}
+	u.RawQuery = ""
+	return &u
+}
+
+func (s *S3) do(method, key string, body []byte, contentType string) (*http.Response, error) {
+	req, err := http.NewRequest(method, s.objectURL(key).String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		req.Body, req.GetBody, req.ContentLength = nil, nil, 0
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	sum := sha256.Sum256(body)
+	signRequest(req, hex.EncodeToString(sum[:]), s.accessKey, s.secretKey, s.region, time.Now())
+	return s.client.Do(req)
+}
+
+// Put uploads an object unless the key is already stored: it holds the same bytes, so asking
+// costs less than sending them again.
+func (s *S3) Put(key string, data []byte, contentType string) error {
+	if !ValidKey(key) {
+		return ErrInvalidKey
+	}
+	head, err := s.do(http.MethodHead, key, nil, "")
+	if err != nil {
+		return fmt.Errorf("storage: s3: put: %w", err)
+	}
+	head.Body.Close()
+	switch head.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+	default:
+		return fmt.Errorf("storage: s3: put: %w", responseError(head))
+	}
+
+	if data == nil {
+		data = []byte{}
+	}
+	resp, err := s.do(http.MethodPut, key, data, contentType)
+	if err != nil {
+		return fmt.Errorf("storage: s3: put: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("storage: s3: put: %w", responseError(resp))
+	}
+	return nil
+}
+
+func (s *S3) Get(key string) (io.ReadCloser, error) {
+	if !ValidKey(key) {
+		return nil, ErrInvalidKey
+	}
+	resp, err := s.do(http.MethodGet, key, nil, "")
+	if err != nil {
+		return nil, fmt.Errorf("storage: s3: get: %w", err)
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	defer resp.Body.Close()
+	return nil, fmt.Errorf("storage: s3: get: %w", responseError(resp))
+}
+
+func (s *S3) Delete(key string) error {
+	if !ValidKey(key) {
+		return ErrInvalidKey
+	}
+	resp, err := s.do(http.MethodDelete, key, nil, "")
+	if err != nil {
+		return fmt.Errorf("storage: s3: delete: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("storage: s3: delete: %w", responseError(resp))
+	}
+	return nil
+}
+
+// responseError describes a failed request by its status and the start of the error document the
+// service sent back.
+func responseError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(body))
+}
+
+// signRequest adds AWS Signature Version 4 headers to req. Every header already set is signed along
+// with the host, so nothing the signature covers can be changed on the way.
+func signRequest(req *http.Request, payloadHash, accessKey, secretKey, region string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format(s3DateFormat)
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalPath(req.URL.Path),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := s3SignAlgorithm + "\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3SignAlgorithm, accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalPath encodes each segment of path the way S3 expects, keeping the slashes between them.
+func canonicalPath(path string) string {
+	if path == "" {
+		return "/"
+	}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = uriEncode(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+func canonicalQuery(query url.Values) string {
+	pairs := make([]string, 0, len(query))
+	for name, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, uriEncode(name)+"="+uriEncode(value))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode percent-encodes everything but the unreserved characters of RFC 3986, which is the
+// encoding signatures are computed over.
+func uriEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
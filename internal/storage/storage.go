@@ -0,0 +1,55 @@
+// Package storage keeps uploaded files. Files are stored under keys chosen by the caller, which
+// are content hashes, so a key always refers to the same bytes and a stored file never changes.
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"forum/internal/config"
+	"io"
+)
+
+var (
+	ErrNotFound   = errors.New("storage: object not found")
+	ErrInvalidKey = errors.New("storage: invalid key")
+)
+
+type Storage interface {
+	Put(key string, data []byte, contentType string) error
+	Get(key string) (io.ReadCloser, error)
+	Delete(key string) error
+}
+
+// ValidKey reports whether key is safe to use as a file name or object name: lower case letters,
+// digits and dots, not starting with a dot.
+func ValidKey(key string) bool {
+	if key == "" || len(key) > 128 || key[0] == '.' {
+		return false
+	}
+	for _, char := range key {
+		if (char < 'a' || char > 'z') && (char < '0' || char > '9') && char != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+// New returns the storage backend chosen in the configuration: "local" for files on disk, which is
+// the default, or "s3" for an S3-compatible bucket.
+func New(cfg *config.Config) (Storage, error) {
+	var storage Storage
+	var err error
+	switch cfg.Uploads.Storage {
+	case "", "local":
+		storage, err = NewLocal(cfg.Uploads.Dir)
+	case "s3":
+		s3 := cfg.Uploads.S3
+		storage, err = NewS3(s3.Endpoint, s3.Region, s3.Bucket, s3.AccessKey, s3.SecretKey, s3.PathStyle)
+	default:
+		err = fmt.Errorf("storage: unknown backend %q", cfg.Uploads.Storage)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return storage, nil
+}
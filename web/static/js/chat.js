@@ -0,0 +1,94 @@
+// Connects the chat page of a category to its WebSocket: the room's history and new messages arrive
+// on it, and the form sends messages over it. A dropped connection is retried with a growing delay.
+(function () {
+    "use strict";
+
+    var list = document.getElementById("chat-messages");
+    var form = document.getElementById("chat-form");
+    var status = document.getElementById("chat-status");
+    if (!list || !form || !window.WebSocket) {
+        return;
+    }
+    var username = list.getAttribute("data-username");
+    var url = (location.protocol === "https:" ? "wss://" : "ws://") + location.host + form.getAttribute("data-socket");
+    var socket = null;
+    var retryDelay = 1000;
+
+    function pad(n) {
+        return n < 10 ? "0" + n : String(n);
+    }
+
+    function render(message) {
+        var element = document.createElement("div");
+        element.className = "chat-message" + (message.author === username ? " chat-message-own" : "");
+        var author = document.createElement("span");
+        author.className = "chat-author";
+        author.textContent = message.author;
+        var time = document.createElement("span");
+        time.className = "chat-time";
+        var created = new Date(message.creationTime);
+        time.textContent = pad(created.getHours()) + ":" + pad(created.getMinutes());
+        var text = document.createElement("p");
+        text.className = "chat-text";
+        text.textContent = message.content;
+        element.append(author, time, text);
+        return element;
+    }
+
+    function append(message) {
+        var empty = list.querySelector(".chat-empty");
+        if (empty) {
+            empty.remove();
+        }
+        var atBottom = list.scrollHeight - list.scrollTop - list.clientHeight < 40;
+        list.appendChild(render(message));
+        if (atBottom || message.author === username) {
+            list.scrollTop = list.scrollHeight;
+        }
+    }
+
+    function connect() {
+        socket = new WebSocket(url);
+        socket.onopen = function () {
+            retryDelay = 1000;
+            status.textContent = "";
+        };
+        socket.onmessage = function (e) {
+            var frame = JSON.parse(e.data);
+            if (frame.type === "history") {
+                list.replaceChildren();
+                (frame.messages || []).forEach(append);
+                list.scrollTop = list.scrollHeight;
+            } else if (frame.type === "message") {
+                append(frame.message);
+            } else if (frame.type === "error") {
+                status.textContent = frame.error;
+            }
+        };
+        socket.onclose = function (e) {
+            socket = null;
+            // 1008 is sent once the session has ended, when reconnecting is of no use.
+            if (e.code === 1008) {
+                status.textContent = "Your session has ended. Sign in again to chat.";
+                return;
+            }
+            status.textContent = "Disconnected, reconnecting...";
+            setTimeout(connect, retryDelay);
+            retryDelay = Math.min(retryDelay * 2, 30000);
+        };
+    }
+
+    form.addEventListener("submit", function (e) {
+        e.preventDefault();
+        var input = form.elements.content;
+        if (!socket || socket.readyState !== WebSocket.OPEN || !input.value.trim()) {
+            return;
+        }
+        status.textContent = "";
+        socket.send(JSON.stringify({ content: input.value }));
+        input.value = "";
+    });
+
+    list.scrollTop = list.scrollHeight;
+    connect();
+})();
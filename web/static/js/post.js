@@ -0,0 +1,76 @@
+// Keeps an open post page up to date: new comments and like/dislike counts arrive as server-sent
+// events from /post/{id}/events. The browser reconnects on its own, sending the id of the last event
+// it got so nothing is missed in between.
+(function () {
+    "use strict";
+
+    var container = document.querySelector("[data-events]");
+    if (!container || !window.EventSource) {
+        return;
+    }
+    var lastPage = container.hasAttribute("data-last-page");
+    var source = new EventSource(container.getAttribute("data-events"));
+
+    function setText(element, value) {
+        if (element) {
+            element.textContent = value;
+        }
+    }
+
+    source.addEventListener("votes", function (e) {
+        var votes = JSON.parse(e.data);
+        setText(document.getElementById("post-likes"), votes.likes);
+        setText(document.getElementById("post-dislikes"), votes.dislikes);
+    });
+
+    source.addEventListener("comment-votes", function (e) {
+        var votes = JSON.parse(e.data);
+        var comment = document.getElementById("comment-" + votes.id);
+        if (!comment) {
+            return;
+        }
+        setText(comment.querySelector(":scope > .comment-reaction .comment-likes"), votes.likes);
+        setText(comment.querySelector(":scope > .comment-reaction .comment-dislikes"), votes.dislikes);
+    });
+
+    source.addEventListener("comment", function (e) {
+        var comment = JSON.parse(e.data);
+        if (document.getElementById("comment-" + comment.id)) {
+            // Already on the page, which was rendered after the comment was posted.
+            return;
+        }
+        var template = document.createElement("template");
+        template.innerHTML = comment.html.trim();
+        var element = template.content.firstElementChild;
+
+        if (!comment.parentId) {
+            // New threads are listed last, so only the last page shows them.
+            if (!lastPage) {
+                return;
+            }
+            var list = container.querySelector(".all-comments");
+            var empty = list.querySelector(".no-comment");
+            if (empty) {
+                empty.remove();
+            }
+            list.insertBefore(element, list.querySelector(":scope > .pagination"));
+            return;
+        }
+
+        var parent = document.getElementById("comment-" + comment.parentId);
+        if (!parent) {
+            return;
+        }
+        if (comment.depth > Number(parent.getAttribute("data-depth"))) {
+            parent.appendChild(element);
+        } else {
+            // Replies past the deepest level are listed flat, after the comment they answer.
+            var level = parent.parentNode;
+            level.insertBefore(element, level.querySelector(":scope > .pagination"));
+        }
+    });
+
+    source.addEventListener("reload", function () {
+        document.getElementById("live-notice").hidden = false;
+    });
+})();